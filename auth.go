@@ -0,0 +1,457 @@
+package runn
+
+import (
+	"context"
+	"crypto/md5" //nolint:gosec
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/k1LoW/maskedio"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	authTypeBearer = "bearer"
+	authTypeBasic  = "basic"
+	authTypeDigest = "digest"
+	authTypeOAuth2 = "oauth2"
+)
+
+const (
+	oauth2GrantClientCredentials = "client_credentials"
+	oauth2GrantPassword          = "password"
+	oauth2GrantRefreshToken      = "refresh_token"
+)
+
+const authorizationHeader = "Authorization"
+
+// AuthConfig is the configuration for authentication of HTTP and gRPC runners.
+type AuthConfig struct {
+	// Type is the type of authentication ("bearer", "basic", "digest" or "oauth2").
+	Type string `yaml:"type"`
+	// Token is the static bearer token.
+	Token string `yaml:"token,omitempty"`
+	// Username is the username of Basic/Digest authentication or the password grant.
+	Username string `yaml:"username,omitempty"`
+	// Password is the password of Basic/Digest authentication or the password grant.
+	Password string `yaml:"password,omitempty"`
+	// Grant is the grant type of OAuth 2.0 ("client_credentials", "password" or "refresh_token").
+	Grant        string   `yaml:"grant,omitempty"`
+	TokenURL     string   `yaml:"tokenURL,omitempty"`
+	ClientID     string   `yaml:"clientID,omitempty"`
+	ClientSecret string   `yaml:"clientSecret,omitempty"`
+	Scopes       []string `yaml:"scopes,omitempty"`
+	RefreshToken string   `yaml:"refreshToken,omitempty"`
+	// Params is the additional parameters of the token request of the client credentials grant (e.g. audience).
+	Params map[string]string `yaml:"params,omitempty"`
+}
+
+func (c *AuthConfig) validate() error {
+	switch strings.ToLower(c.Type) {
+	case authTypeBearer:
+		if c.Token == "" {
+			return errors.New("auth: token is required for bearer")
+		}
+	case authTypeBasic, authTypeDigest:
+		if c.Username == "" {
+			return fmt.Errorf("auth: username is required for %s", c.Type)
+		}
+	case authTypeOAuth2:
+		if c.TokenURL == "" {
+			return errors.New("auth: tokenURL is required for oauth2")
+		}
+		switch c.Grant {
+		case oauth2GrantClientCredentials:
+			if c.ClientID == "" {
+				return errors.New("auth: clientID is required for client_credentials grant")
+			}
+		case oauth2GrantPassword:
+			if c.Username == "" {
+				return errors.New("auth: username is required for password grant")
+			}
+		case oauth2GrantRefreshToken:
+			if c.RefreshToken == "" {
+				return errors.New("auth: refreshToken is required for refresh_token grant")
+			}
+		default:
+			return fmt.Errorf("auth: invalid grant: %q (should be %q, %q or %q)", c.Grant, oauth2GrantClientCredentials, oauth2GrantPassword, oauth2GrantRefreshToken)
+		}
+	default:
+		return fmt.Errorf("auth: invalid type: %q (should be %q, %q, %q or %q)", c.Type, authTypeBearer, authTypeBasic, authTypeDigest, authTypeOAuth2)
+	}
+	return nil
+}
+
+func validateGRPCAuth(c *AuthConfig) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	if strings.EqualFold(c.Type, authTypeDigest) {
+		return errors.New("auth: digest is not supported by gRPC runners")
+	}
+	return nil
+}
+
+// authenticator sets the credentials to the requests of a runner.
+// The token of OAuth 2.0 is cached per runner, and fetched again when it expires or the server rejects it.
+type authenticator struct {
+	config *AuthConfig
+	// client is the HTTP client for the token endpoint.
+	client *http.Client
+
+	mu           sync.Mutex
+	token        *oauth2.Token
+	refreshToken string
+	digest       *digestChallenge
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	nc        int
+}
+
+func newAuthenticator(c *AuthConfig) (*authenticator, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	cc := *c
+	cc.Type = strings.ToLower(c.Type)
+	return &authenticator{
+		config:       &cc,
+		refreshToken: c.RefreshToken,
+	}, nil
+}
+
+// authorization returns the value of the Authorization header for the request.
+// It returns an empty string when the credentials cannot be set yet (e.g. Digest authentication before the challenge).
+func (a *authenticator) authorization(ctx context.Context, method, uri string, mr *maskedio.Rule) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.config
+	a.mask(mr, c.Token, c.Password, c.ClientSecret, a.refreshToken)
+	switch c.Type {
+	case authTypeBearer:
+		return "Bearer " + c.Token, nil
+	case authTypeBasic:
+		cred := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		a.mask(mr, cred)
+		return "Basic " + cred, nil
+	case authTypeDigest:
+		if a.digest == nil {
+			return "", nil
+		}
+		return a.digestAuthorization(method, uri)
+	case authTypeOAuth2:
+		if !a.token.Valid() {
+			t, err := a.fetchToken(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to fetch the token: %w", err)
+			}
+			a.token = t
+			if t.RefreshToken != "" {
+				a.refreshToken = t.RefreshToken
+			}
+		}
+		a.mask(mr, a.token.AccessToken, a.refreshToken)
+		return a.token.Type() + " " + a.token.AccessToken, nil
+	default:
+		return "", fmt.Errorf("auth: invalid type: %q", c.Type)
+	}
+}
+
+// unauthorized handles the 401 response and reports whether the request should be retried with new credentials.
+func (a *authenticator) unauthorized(res *http.Response) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch a.config.Type {
+	case authTypeOAuth2:
+		// Discard the cached token to fetch a new one.
+		a.token = nil
+		return true
+	case authTypeDigest:
+		for _, v := range res.Header.Values("WWW-Authenticate") {
+			ch, err := parseDigestChallenge(v)
+			if err != nil {
+				continue
+			}
+			a.digest = ch
+			return true
+		}
+	}
+	return false
+}
+
+// expire discards the cached token of OAuth 2.0.
+func (a *authenticator) expire() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.config.Type != authTypeOAuth2 {
+		return false
+	}
+	a.token = nil
+	return true
+}
+
+func (a *authenticator) fetchToken(ctx context.Context) (*oauth2.Token, error) {
+	c := a.config
+	if a.client != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, a.client)
+	}
+	oc := &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint:     oauth2.Endpoint{TokenURL: c.TokenURL},
+		Scopes:       c.Scopes,
+	}
+	// Use the refresh token issued before if available.
+	if a.refreshToken != "" && c.Grant != oauth2GrantClientCredentials {
+		t, err := oc.TokenSource(ctx, &oauth2.Token{RefreshToken: a.refreshToken}).Token()
+		if err == nil || c.Grant == oauth2GrantRefreshToken {
+			return t, err
+		}
+	}
+	switch c.Grant {
+	case oauth2GrantClientCredentials:
+		cc := &clientcredentials.Config{
+			ClientID:       c.ClientID,
+			ClientSecret:   c.ClientSecret,
+			TokenURL:       c.TokenURL,
+			Scopes:         c.Scopes,
+			EndpointParams: url.Values{},
+		}
+		for k, v := range c.Params {
+			cc.EndpointParams.Set(k, v)
+		}
+		return cc.Token(ctx)
+	case oauth2GrantPassword:
+		return oc.PasswordCredentialsToken(ctx, c.Username, c.Password)
+	default:
+		return nil, fmt.Errorf("auth: invalid grant: %q", c.Grant)
+	}
+}
+
+func (a *authenticator) mask(mr *maskedio.Rule, secrets ...string) {
+	if mr == nil {
+		return
+	}
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		mr.SetKeyword(s)
+	}
+}
+
+// digestAuthorization returns the value of the Authorization header of Digest authentication (RFC 7616).
+func (a *authenticator) digestAuthorization(method, uri string) (string, error) {
+	ch := a.digest
+	c := a.config
+	var h func() hash.Hash
+	algorithm := strings.ToUpper(ch.algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		h = md5.New
+	case "SHA-256":
+		h = sha256.New
+	default:
+		return "", fmt.Errorf("auth: unsupported digest algorithm: %s", ch.algorithm)
+	}
+	hs := func(s ...string) string {
+		hh := h()
+		_, _ = hh.Write([]byte(strings.Join(s, ":")))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	cnonce, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	ha1 := hs(c.Username, ch.realm, c.Password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = hs(ha1, ch.nonce, cnonce)
+	}
+	ha2 := hs(method, uri)
+	params := []string{
+		fmt.Sprintf("username=%q", c.Username),
+		fmt.Sprintf("realm=%q", ch.realm),
+		fmt.Sprintf("nonce=%q", ch.nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if ch.algorithm != "" {
+		params = append(params, "algorithm="+ch.algorithm)
+	}
+	qop := ""
+	for q := range strings.SplitSeq(ch.qop, ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	if qop != "" {
+		ch.nc++
+		nc := fmt.Sprintf("%08x", ch.nc)
+		params = append(params,
+			fmt.Sprintf("response=%q", hs(ha1, ch.nonce, nc, cnonce, qop, ha2)),
+			"qop="+qop,
+			"nc="+nc,
+			fmt.Sprintf("cnonce=%q", cnonce),
+		)
+	} else {
+		params = append(params, fmt.Sprintf("response=%q", hs(ha1, ch.nonce, ha2)))
+	}
+	if ch.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", ch.opaque))
+	}
+	return "Digest " + strings.Join(params, ", "), nil
+}
+
+// parseDigestChallenge parses the WWW-Authenticate header of Digest authentication.
+func parseDigestChallenge(v string) (*digestChallenge, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, fmt.Errorf("not digest challenge: %s", v)
+	}
+	ch := &digestChallenge{}
+	for rest != "" {
+		var k, val string
+		k, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		rest = strings.TrimLeft(rest, " ")
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid digest challenge: %s", v)
+			}
+			val, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+			val = strings.TrimSpace(val)
+		}
+		switch k {
+		case "realm":
+			ch.realm = val
+		case "nonce":
+			ch.nonce = val
+		case "opaque":
+			ch.opaque = val
+		case "algorithm":
+			ch.algorithm = val
+		case "qop":
+			ch.qop = val
+		}
+	}
+	if ch.nonce == "" {
+		return nil, fmt.Errorf("invalid digest challenge: %s", v)
+	}
+	return ch, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authorize sets the Authorization header to the request unless the header is set by the step.
+func (rnr *httpRunner) authorize(ctx context.Context, r *httpRequest, req *http.Request, o *operator) error {
+	if rnr.auth == nil || r.headers.Get(authorizationHeader) != "" {
+		return nil
+	}
+	v, err := rnr.auth.authorization(ctx, req.Method, req.URL.RequestURI(), o.maskRule)
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		req.Header.Set(authorizationHeader, v)
+	}
+	return nil
+}
+
+// reauthorize returns the request to retry with new credentials if the response is 401 and the credentials can be renewed.
+// It returns nil if the request should not be retried.
+func (rnr *httpRunner) reauthorize(ctx context.Context, r *httpRequest, req *http.Request, res *http.Response, o *operator) (*http.Request, error) {
+	if rnr.auth == nil || res.StatusCode != http.StatusUnauthorized || r.headers.Get(authorizationHeader) != "" {
+		return nil, nil
+	}
+	if !rnr.auth.unauthorized(res) {
+		return nil, nil
+	}
+	body, err := r.encodeBody()
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Clone(ctx)
+	if body != nil {
+		if rc, ok := body.(io.ReadCloser); ok {
+			retry.Body = rc
+		} else {
+			retry.Body = io.NopCloser(body)
+		}
+		setSizedBody(retry, body)
+	}
+	if r.headers.Get("Content-Type") == "" {
+		// The boundary of multipart/form-data is changed by encoding the body again.
+		r.setContentTypeHeader(retry)
+	}
+	if err := rnr.authorize(ctx, r, retry, o); err != nil {
+		return nil, err
+	}
+	return retry, nil
+}
+
+const grpcAuthorizationKey = "authorization"
+
+// authorize sets the authorization metadata to the request unless the metadata is set by the step.
+func (rnr *grpcRunner) authorize(ctx context.Context, r *grpcRequest, o *operator) error {
+	if rnr.auth == nil || len(r.headers.Get(grpcAuthorizationKey)) > 0 {
+		return nil
+	}
+	v, err := rnr.auth.authorization(ctx, "", "", o.maskRule)
+	if err != nil {
+		return err
+	}
+	if r.headers == nil {
+		r.headers = metadata.MD{}
+	}
+	r.headers.Set(grpcAuthorizationKey, v)
+	r.authorized = true
+	return nil
+}
+
+// authHTTPClient returns the HTTP client to request the token endpoint of the auth.
+// The TLS settings, proxy and host rules of the runner are applied in the same way as HTTP runners.
+// The socket is not used because it is the transport to the target.
+func (rnr *grpcRunner) authHTTPClient() (*http.Client, error) {
+	hr, err := newHTTPRunner(rnr.name, "")
+	if err != nil {
+		return nil, err
+	}
+	hr.cacert = rnr.cacert
+	hr.cert = rnr.cert
+	hr.key = rnr.key
+	hr.skipVerify = rnr.skipVerify
+	hr.proxy = rnr.proxy
+	if err := hr.configureTransport(rnr.hostRules); err != nil {
+		return nil, err
+	}
+	if err := hr.configureTLS(); err != nil {
+		return nil, err
+	}
+	return hr.client, nil
+}
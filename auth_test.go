@@ -0,0 +1,327 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/httpstub"
+	"github.com/k1LoW/runn/testutil"
+	"google.golang.org/grpc/metadata"
+)
+
+type authServer struct {
+	*httpstub.Router
+	mu            sync.Mutex
+	tokenRequests int
+	tokens        map[string]bool
+	refreshTokens map[string]bool
+}
+
+// newAuthServer returns a server that has the token endpoint (/token) and the API that requires authentication (/api).
+// The API revokes the tokens when the query `revoke` is set.
+func newAuthServer(t *testing.T, opts ...httpstub.Option) *authServer {
+	t.Helper()
+	s := &authServer{
+		Router:        httpstub.NewServer(t, opts...),
+		tokens:        map[string]bool{},
+		refreshTokens: map[string]bool{"refresh-0": true},
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	s.Method(http.MethodPost).Path("/token").Handler(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		ok := false
+		switch r.PostForm.Get("grant_type") {
+		case oauth2GrantClientCredentials:
+			id, secret, _ := r.BasicAuth()
+			ok = id == "runn" && secret == "client-secret" && r.PostForm.Get("audience") == "api"
+		case oauth2GrantPassword:
+			ok = r.PostForm.Get("username") == "alice" && r.PostForm.Get("password") == "pass"
+		case oauth2GrantRefreshToken:
+			ok = s.refreshTokens[r.PostForm.Get("refresh_token")]
+		}
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		s.tokenRequests++
+		token := fmt.Sprintf("token-%d", s.tokenRequests)
+		refresh := fmt.Sprintf("refresh-%d", s.tokenRequests)
+		s.tokens[token] = true
+		s.refreshTokens[refresh] = true
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":%q,"token_type":"bearer","expires_in":3600,"refresh_token":%q}`, token, refresh)
+	})
+	s.Path("/api").Handler(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		h := r.Header.Get("Authorization")
+		ok := false
+		switch {
+		case strings.HasPrefix(h, "Bearer "):
+			tok := strings.TrimPrefix(h, "Bearer ")
+			ok = s.tokens[tok] || tok == "static-token"
+		case strings.HasPrefix(h, "Basic "):
+			u, p, _ := r.BasicAuth()
+			ok = u == "alice" && p == "pass"
+		case strings.HasPrefix(h, "Digest "):
+			ok = validDigest(r.Method, h, "alice", "pass")
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Digest realm="runn", qop="auth", nonce="abc123", opaque="xyz", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("revoke") != "" {
+			s.tokens = map[string]bool{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	})
+	return s
+}
+
+func validDigest(method, h, username, password string) bool {
+	params := map[string]string{}
+	for p := range strings.SplitSeq(strings.TrimPrefix(h, "Digest "), ", ") {
+		k, v, _ := strings.Cut(p, "=")
+		params[k] = strings.Trim(v, `"`)
+	}
+	hs := func(s ...string) string {
+		b := sha256.Sum256([]byte(strings.Join(s, ":")))
+		return hex.EncodeToString(b[:])
+	}
+	ha1 := hs(username, "runn", password)
+	ha2 := hs(method, params["uri"])
+	want := hs(ha1, params["nonce"], params["nc"], params["cnonce"], params["qop"], ha2)
+	return params["username"] == username && params["opaque"] == "xyz" && params["response"] == want
+}
+
+func TestHTTPAuth(t *testing.T) {
+	tests := []struct {
+		name              string
+		auth              func(tokenURL string) *AuthConfig
+		wantTokenRequests int
+		wantMasked        []string
+	}{
+		{
+			"bearer",
+			func(string) *AuthConfig { return &AuthConfig{Type: "bearer", Token: "static-token"} },
+			0,
+			[]string{"static-token"},
+		},
+		{
+			"basic",
+			func(string) *AuthConfig { return &AuthConfig{Type: "basic", Username: "alice", Password: "pass"} },
+			0,
+			[]string{"pass"},
+		},
+		{
+			"digest",
+			func(string) *AuthConfig { return &AuthConfig{Type: "digest", Username: "alice", Password: "pass"} },
+			0,
+			[]string{"pass"},
+		},
+		{
+			"oauth2 client credentials",
+			func(u string) *AuthConfig {
+				return &AuthConfig{Type: "oauth2", Grant: "client_credentials", TokenURL: u, ClientID: "runn", ClientSecret: "client-secret", Params: map[string]string{"audience": "api"}}
+			},
+			2,
+			[]string{"client-secret", "token-1", "token-2"},
+		},
+		{
+			"oauth2 password",
+			func(u string) *AuthConfig {
+				return &AuthConfig{Type: "oauth2", Grant: "password", TokenURL: u, ClientID: "runn", Username: "alice", Password: "pass"}
+			},
+			2,
+			[]string{"pass", "token-1", "token-2", "refresh-2"},
+		},
+		{
+			"oauth2 refresh token",
+			func(u string) *AuthConfig {
+				return &AuthConfig{Type: "oauth2", Grant: "refresh_token", TokenURL: u, ClientID: "runn", RefreshToken: "refresh-0"}
+			},
+			2,
+			[]string{"refresh-0", "token-1", "token-2", "refresh-2"},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newAuthServer(t)
+			u := ts.Server().URL
+			o, err := New(HTTPRunner("req", u, ts.Server().Client(), HTTPAuth(tt.auth(u+"/token"))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The second request revokes the token, so the third request is retried with a new token.
+			for i, p := range []string{"/api", "/api?revoke=true", "/api"} {
+				req := &httpRequest{
+					path:   p,
+					method: http.MethodGet,
+				}
+				if err := o.httpRunners["req"].run(ctx, req, newStep(i, fmt.Sprintf("step%d", i), o, nil)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sl, ok := o.store.ToMap()["steps"].([]map[string]any)
+			if !ok {
+				t.Fatal("steps not found")
+			}
+			for i, sm := range sl {
+				res, ok := sm["res"].(map[string]any)
+				if !ok {
+					t.Fatalf("invalid steps[%d].res: %v", i, sm["res"])
+				}
+				if got := res["status"]; got != http.StatusOK {
+					t.Errorf("steps[%d].res.status got %v, want %v", i, got, http.StatusOK)
+				}
+			}
+			if ts.tokenRequests != tt.wantTokenRequests {
+				t.Errorf("token requests got %d, want %d", ts.tokenRequests, tt.wantTokenRequests)
+			}
+			buf := new(bytes.Buffer)
+			w := o.maskRule.NewWriter(buf)
+			for _, s := range tt.wantMasked {
+				if _, err := w.Write([]byte(s + "\n")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, s := range tt.wantMasked {
+				if strings.Contains(buf.String(), s) {
+					t.Errorf("%q is not masked: %s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPAuthRunbook(t *testing.T) {
+	ts := newAuthServer(t)
+	t.Setenv("TEST_HTTP_ENDPOINT", ts.Server().URL)
+	o, err := New(Book("testdata/book/http_auth.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := 1; ts.tokenRequests != want {
+		t.Errorf("token requests got %d, want %d", ts.tokenRequests, want)
+	}
+}
+
+func TestAuthTokenEndpointWithRunnerCACert(t *testing.T) {
+	// The token endpoint uses the certificate signed by the CA of testdata, so the token is fetched only with the cacert of the runner.
+	newTLSAuthServer := func(t *testing.T) *authServer {
+		t.Helper()
+		return newAuthServer(t, httpstub.UseTLS(), httpstub.Certificates(testutil.Cert, testutil.Key))
+	}
+	auth := func(u string) *AuthConfig {
+		return &AuthConfig{Type: "oauth2", Grant: "client_credentials", TokenURL: u + "/token", ClientID: "runn", ClientSecret: "client-secret", Params: map[string]string{"audience": "api"}}
+	}
+
+	t.Run("http", func(t *testing.T) {
+		ts := newTLSAuthServer(t)
+		u := ts.Server().URL
+		o, err := New(Runner("req", u, HTTPCACert(filepath.Join(testutil.Testdata(), "cacert.pem")), HTTPAuth(auth(u))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &httpRequest{
+			path:   "/api",
+			method: http.MethodGet,
+		}
+		if err := o.httpRunners["req"].run(context.Background(), req, newStep(0, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if want := 1; ts.tokenRequests != want {
+			t.Errorf("token requests got %d, want %d", ts.tokenRequests, want)
+		}
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		ctx, cancel := donegroup.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		ts := newTLSAuthServer(t)
+		gs := testutil.GRPCServer(t, true, false)
+		o, err := New(GrpcRunnerWithOptions("greq", gs.Addr(), CACertFromData(testutil.Cacert), CertFromData(testutil.Cert), KeyFromData(testutil.Key), BufLock(filepath.Join(testutil.Testdata(), "buf.lock")), GRPCAuth(auth(ts.Server().URL))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			o.Close(true)
+		})
+		req := &grpcRequest{
+			service:  "grpctest.GrpcTestService",
+			method:   "Hello",
+			headers:  metadata.MD{},
+			messages: []*grpcMessage{{op: GRPCOpMessage, params: map[string]any{"name": "alice"}}},
+		}
+		if err := o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if want := 1; ts.tokenRequests != want {
+			t.Errorf("token requests got %d, want %d", ts.tokenRequests, want)
+		}
+		recv := gs.Requests()
+		if len(recv) == 0 {
+			t.Fatal("no requests")
+		}
+		if got, want := recv[len(recv)-1].Headers.Get("authorization"), []string{"Bearer token-1"}; !slices.Equal(got, want) {
+			t.Errorf("authorization got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	tests := []struct {
+		auth    *AuthConfig
+		grpc    bool
+		wantErr bool
+	}{
+		{&AuthConfig{Type: "bearer", Token: "token"}, false, false},
+		{&AuthConfig{Type: "Bearer", Token: "token"}, true, false},
+		{&AuthConfig{Type: "bearer"}, false, true},
+		{&AuthConfig{Type: "basic", Username: "alice"}, false, false},
+		{&AuthConfig{Type: "digest", Username: "alice"}, false, false},
+		{&AuthConfig{Type: "digest", Username: "alice"}, true, true},
+		{&AuthConfig{Type: "oauth2", Grant: "client_credentials", TokenURL: "https://example.com/token", ClientID: "runn"}, true, false},
+		{&AuthConfig{Type: "oauth2", Grant: "client_credentials", ClientID: "runn"}, false, true},
+		{&AuthConfig{Type: "oauth2", Grant: "implicit", TokenURL: "https://example.com/token"}, false, true},
+		{&AuthConfig{Type: "oauth2", Grant: "refresh_token", TokenURL: "https://example.com/token"}, false, true},
+		{&AuthConfig{Type: "apikey"}, false, true},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var err error
+			if tt.grpc {
+				err = validateGRPCAuth(tt.auth)
+			} else {
+				err = tt.auth.validate()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
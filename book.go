@@ -26,6 +26,7 @@ import (
 	"github.com/k1LoW/sshc/v4"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 const noDesc = "[No Description]"
@@ -64,6 +65,7 @@ type book struct {
 	included             bool
 	force                bool
 	trace                bool
+	schedule             string
 	attach               bool
 	waitTimeout          time.Duration // waitTimout is the time to wait for sub-processes to complete after the Run or RunN context is canceled
 	failFast             bool
@@ -71,6 +73,7 @@ type book struct {
 	openAPI3DocLocations []string
 	grpcNoTLS            bool
 	grpcProtos           []string
+	grpcProtosets        []string
 	grpcImportPaths      []string
 	grpcBufDirs          []string
 	grpcBufLocks         []string
@@ -91,6 +94,9 @@ type book struct {
 	beforeFuncs          []func(*RunResult) error
 	afterFuncs           []func(*RunResult) error
 	capturers            capturers
+	tracerProvider       oteltrace.TracerProvider
+	fixtures             *fixtures
+	cookieJar            string
 	stdout               io.Writer
 	stderr               io.Writer
 	// Skip some errors for `runn list`
@@ -382,8 +388,43 @@ func (bk *book) parseHTTPRunnerWithDetailed(name string, b []byte) (bool, error)
 		}
 	}
 	r.useCookie = c.UseCookie
+	if c.CookieJar != "" {
+		p, err := fs.Path(c.CookieJar, root)
+		if err != nil {
+			return false, err
+		}
+		if err := r.setCookieJar(p); err != nil {
+			return false, err
+		}
+	}
 	r.trace = c.Trace.Enable
 	r.traceHeaderName = c.Trace.HeaderName
+	r.traceFormat = c.Trace.Format
+	if c.Auth != nil {
+		a, err := newAuthenticator(c.Auth)
+		if err != nil {
+			return false, err
+		}
+		a.client = r.client
+		r.auth = a
+	}
+	if c.Sign != nil {
+		if err := c.Sign.validate(); err != nil {
+			return false, err
+		}
+		r.sign = c.Sign
+	}
+	if c.Proxy != "" {
+		r.proxy, err = parseProxyURL(c.Proxy)
+		if err != nil {
+			return false, err
+		}
+	}
+	r.socket = c.Socket
+	if err := validateHTTPProtocol(c.Protocol); err != nil {
+		return false, err
+	}
+	r.protocol = c.Protocol
 	hv, err := newHttpValidator(c)
 	if err != nil {
 		return false, err
@@ -463,6 +504,13 @@ func (bk *book) parseGRPCRunnerWithDetailed(name string, b []byte) (bool, error)
 		}
 		r.protos = append(r.protos, pp)
 	}
+	for _, p := range c.Protosets {
+		pp, err := fs.Path(p, root)
+		if err != nil {
+			return false, err
+		}
+		r.protosets = append(r.protosets, pp)
+	}
 	for _, p := range c.BufDirs {
 		pp, err := fs.Path(p, root)
 		if err != nil {
@@ -487,6 +535,34 @@ func (bk *book) parseGRPCRunnerWithDetailed(name string, b []byte) (bool, error)
 	r.bufModules = c.BufModules
 	r.trace = c.Trace.Enable
 	r.traceHeaderName = c.Trace.HeaderName
+	r.traceFormat = c.Trace.Format
+	if c.Auth != nil {
+		if err := validateGRPCAuth(c.Auth); err != nil {
+			return false, err
+		}
+		a, err := newAuthenticator(c.Auth)
+		if err != nil {
+			return false, err
+		}
+		r.auth = a
+	}
+	if c.Proxy != "" {
+		r.proxy, err = parseProxyURL(c.Proxy)
+		if err != nil {
+			return false, err
+		}
+	}
+	r.socket = c.Socket
+	if err := validateGRPCProtocol(c.Protocol, c.Codec); err != nil {
+		return false, err
+	}
+	r.protocol = c.Protocol
+	r.codec = c.Codec
+	r.storeRequest = c.StoreRequest
+	r.clientOpts, err = newGRPCClientOptions(c)
+	if err != nil {
+		return false, err
+	}
 
 	bk.grpcRunners[name] = r
 	return true, nil
@@ -505,6 +581,13 @@ func (bk *book) parseDBRunnerWithDetailed(name string, b []byte) (bool, error) {
 		return false, err
 	}
 	r.trace = c.Trace
+	r.transaction, err = parseDBTxOptions(c.Transaction)
+	if err != nil {
+		return false, fmt.Errorf("invalid transaction of %s: %w", name, err)
+	}
+	if err := r.setAutoSnapshot(c.Snapshot); err != nil {
+		return false, fmt.Errorf("invalid snapshot of %s: %w", name, err)
+	}
 	bk.dbRunners[name] = r
 	return true, nil
 }
@@ -748,11 +831,15 @@ func (bk *book) merge(loaded *book) error {
 	if !bk.trace {
 		bk.trace = loaded.trace
 	}
+	if bk.schedule == "" {
+		bk.schedule = loaded.schedule
+	}
 	bk.loop = loaded.loop
 	bk.concurrency = loaded.concurrency
 	bk.openAPI3DocLocations = loaded.openAPI3DocLocations
 	bk.grpcNoTLS = loaded.grpcNoTLS
 	bk.grpcProtos = loaded.grpcProtos
+	bk.grpcProtosets = loaded.grpcProtosets
 	bk.grpcImportPaths = loaded.grpcImportPaths
 	bk.grpcBufDirs = loaded.grpcBufDirs
 	bk.grpcBufLocks = loaded.grpcBufLocks
@@ -966,7 +1053,7 @@ func parseBook(in io.Reader) (*book, error) {
 }
 
 func validateRunnerKey(k string) error {
-	if k == includeRunnerKey || k == testRunnerKey || k == dumpRunnerKey || k == execRunnerKey || k == bindRunnerKey || k == runnerRunnerKey {
+	if k == includeRunnerKey || k == testRunnerKey || k == dumpRunnerKey || k == execRunnerKey || k == bindRunnerKey || k == dbAssertRunnerKey || k == runnerRunnerKey {
 		return fmt.Errorf("runner name %q is reserved for built-in runner", k)
 	}
 	if k == ifSectionKey || k == descSectionKey || k == loopSectionKey || k == deferSectionKey || k == forceSectionKey {
@@ -1000,7 +1087,7 @@ func validateStepKeys(s map[string]any) error {
 		if k == ifSectionKey || k == descSectionKey || k == loopSectionKey || k == deferSectionKey || k == forceSectionKey {
 			continue
 		}
-		if k == testRunnerKey || k == dumpRunnerKey || k == bindRunnerKey {
+		if k == testRunnerKey || k == dumpRunnerKey || k == bindRunnerKey || k == dbAssertRunnerKey {
 			subRunner += 1
 			continue
 		}
@@ -203,6 +203,8 @@ func (c *cRunbook) CaptureHTTPResponse(name string, res *http.Response) {
 	r.replaceLatestStep(append(step, yaml.MapItem{Key: "test", Value: fmt.Sprintf("%s\n", strings.Join(cond, "\n&& "))}))
 }
 
+func (c *cRunbook) CaptureHTTPEvent(name string, e *runn.HTTPEvent) {}
+
 func (c *cRunbook) CaptureGRPCStart(name string, typ runn.GRPCType, service, method string) {
 	const dummyDsn = "[THIS IS gRPC RUNNER]"
 	if v, ok := c.runners[name]; ok {
@@ -361,7 +363,7 @@ func (c *cRunbook) CaptureSSHStderr(stderr string) {
 	// FIXME: not implemented
 }
 
-func (c *cRunbook) CaptureDBStatement(name string, stmt string) {
+func (c *cRunbook) CaptureDBStatement(name string, stmt string, args []any) {
 	const dummyDsn = "[THIS IS DB RUNNER]"
 	if v, ok := c.runners[name]; ok {
 		c.setRunner(name, v)
@@ -372,10 +374,14 @@ func (c *cRunbook) CaptureDBStatement(name string, stmt string) {
 	if r == nil {
 		return
 	}
+	q := yaml.MapSlice{
+		{Key: "query", Value: fmt.Sprintf("%s\n", stmt)},
+	}
+	if len(args) > 0 {
+		q = append(q, yaml.MapItem{Key: "args", Value: args})
+	}
 	step := yaml.MapSlice{
-		{Key: name, Value: yaml.MapSlice{
-			{Key: "query", Value: fmt.Sprintf("%s\n", stmt)},
-		}},
+		{Key: name, Value: q},
 	}
 	r.Steps = append(r.Steps, step)
 }
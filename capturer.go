@@ -16,6 +16,7 @@ type Capturer interface {
 
 	CaptureHTTPRequest(name string, req *http.Request)
 	CaptureHTTPResponse(name string, res *http.Response)
+	CaptureHTTPEvent(name string, e *HTTPEvent)
 
 	CaptureGRPCStart(name string, typ GRPCType, service, method string)
 	CaptureGRPCRequestHeaders(h map[string][]string)
@@ -36,7 +37,7 @@ type Capturer interface {
 	CaptureSSHStdout(stdout string)
 	CaptureSSHStderr(stderr string)
 
-	CaptureDBStatement(name string, stmt string)
+	CaptureDBStatement(name string, stmt string, args []any)
 	CaptureDBResponse(name string, res *DBResponse)
 
 	CaptureExecCommand(command, shell string, background bool)
@@ -89,6 +90,12 @@ func (cs capturers) captureHTTPResponse(name string, res *http.Response) { //nos
 	}
 }
 
+func (cs capturers) captureHTTPEvent(name string, e *HTTPEvent) { //nostyle:recvtype
+	for _, c := range cs {
+		c.CaptureHTTPEvent(name, e)
+	}
+}
+
 func (cs capturers) captureGRPCStart(name string, typ GRPCType, service, method string) { //nostyle:recvtype
 	for _, c := range cs {
 		c.CaptureGRPCStart(name, typ, service, method)
@@ -184,9 +191,9 @@ func (cs capturers) captureSSHStderr(stderr string) { //nostyle:recvtype
 	}
 }
 
-func (cs capturers) captureDBStatement(name string, stmt string) { //nostyle:recvtype
+func (cs capturers) captureDBStatement(name string, stmt string, args []any) { //nostyle:recvtype
 	for _, c := range cs {
-		c.CaptureDBStatement(name, stmt)
+		c.CaptureDBStatement(name, stmt, args)
 	}
 }
 
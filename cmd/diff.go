@@ -0,0 +1,73 @@
+/*
+Copyright © 2022 Ken'ichiro Oyama <k1lowxb@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/k1LoW/runn"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command.
+var diffCmd = &cobra.Command{
+	Use:   "diff [BASE_RESULT_PATH] [HEAD_RESULT_PATH]",
+	Short: "compare two results of load test or run",
+	Long: `compare two results of load test or run.
+
+The results should be output in JSON format by 'runn loadt --format json' or 'runn run --format json'.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		base, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		head, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		d, err := runn.NewResultDiff(base, head)
+		if err != nil {
+			return err
+		}
+		switch flgs.Format {
+		case "json":
+			if err := d.ReportJSON(os.Stdout); err != nil {
+				return err
+			}
+		default:
+			if err := d.Report(os.Stdout); err != nil {
+				return err
+			}
+		}
+		if err := d.CheckTolerance(flgs.DiffTolerance); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVarP(&flgs.Format, "format", "", "", flgs.Usage("Format"))
+	diffCmd.Flags().StringVarP(&flgs.DiffTolerance, "tolerance", "", "", flgs.Usage("DiffTolerance"))
+}
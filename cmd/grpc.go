@@ -0,0 +1,182 @@
+/*
+Copyright © 2022 Ken'ichiro Oyama <k1lowxb@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn"
+	"github.com/k1LoW/runn/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+// grpcCmd represents the grpc command.
+var grpcCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "inspect gRPC servers",
+	Long:  `inspect gRPC servers using the settings of gRPC runners.`,
+}
+
+// grpcLsCmd represents the grpc ls command.
+var grpcLsCmd = &cobra.Command{
+	Use:   "ls [RUNNER_OR_ADDR] [SERVICE]",
+	Short: "list services or methods of the gRPC server",
+	Long:  `list services or methods of the gRPC server.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGRPCInspector(args[0], func(ctx context.Context, i *runn.GRPCInspector) error {
+			var services []string
+			if len(args) > 1 {
+				services = []string{args[1]}
+			} else {
+				ss, err := i.Services(ctx)
+				if err != nil {
+					return err
+				}
+				if !flgs.Long {
+					for _, s := range ss {
+						_, _ = fmt.Println(s)
+					}
+					return nil
+				}
+				services = ss
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, s := range services {
+				methods, err := i.Methods(ctx, s)
+				if err != nil {
+					return err
+				}
+				for _, m := range methods {
+					if !flgs.Long {
+						_, _ = fmt.Fprintf(w, "%s/%s\n", m.Service, m.Name)
+						continue
+					}
+					_, _ = fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s\n", m.Service, m.Name, m.Type, m.Input, m.Output)
+				}
+			}
+			return w.Flush()
+		})
+	},
+}
+
+// grpcDescribeCmd represents the grpc describe command.
+var grpcDescribeCmd = &cobra.Command{
+	Use:   "describe [RUNNER_OR_ADDR] [SYMBOL]",
+	Short: "print step templates of the service or the method, or the template of the message",
+	Long:  `print step templates of the service or the method, or the template of the message in YAML.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGRPCInspector(args[0], func(ctx context.Context, i *runn.GRPCInspector) error {
+			b, err := i.Describe(ctx, args[1])
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Print(string(b))
+			return nil
+		})
+	},
+}
+
+// grpcHealthCmd represents the grpc health command.
+var grpcHealthCmd = &cobra.Command{
+	Use:   "health [RUNNER_OR_ADDR] [SERVICE]",
+	Short: "check the health of the gRPC server using grpc.health.v1.Health",
+	Long:  `check the health of the gRPC server using grpc.health.v1.Health. It exits with non-zero status if the status is not SERVING.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		service := ""
+		if len(args) > 1 {
+			service = args[1]
+		}
+		return runGRPCInspector(args[0], func(ctx context.Context, i *runn.GRPCInspector) error {
+			status, err := i.Health(ctx, service)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Println(status)
+			if status != "SERVING" {
+				return fmt.Errorf("not serving: %s", status)
+			}
+			return nil
+		})
+	},
+}
+
+func runGRPCInspector(runnerOrAddr string, f func(context.Context, *runn.GRPCInspector) error) (err error) {
+	ctx, cancel := donegroup.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		derr := donegroup.Wait(ctx)
+		err = errors.Join(err, derr)
+	}()
+	opts, err := flgs.ToOpts()
+	if err != nil {
+		return err
+	}
+	if flgs.GRPCBook != "" {
+		opts = append(opts, runn.Book(flgs.GRPCBook))
+	}
+
+	// setup cache dir
+	if err := fs.SetCacheDir(flgs.CacheDir); err != nil {
+		return err
+	}
+	defer func() {
+		if !flgs.RetainCacheDir {
+			_ = fs.RemoveCacheDir()
+		}
+	}()
+
+	i, err := runn.NewGRPCInspector(runnerOrAddr, opts...)
+	if err != nil {
+		return err
+	}
+	defer i.Close()
+	return f(ctx, i)
+}
+
+func init() {
+	rootCmd.AddCommand(grpcCmd)
+	grpcCmd.AddCommand(grpcLsCmd, grpcDescribeCmd, grpcHealthCmd)
+	grpcCmd.PersistentFlags().StringVarP(&flgs.GRPCBook, "book", "", "", flgs.Usage("GRPCBook"))
+	grpcCmd.PersistentFlags().BoolVarP(&flgs.Debug, "debug", "", false, flgs.Usage("Debug"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.Vars, "var", "", []string{}, flgs.Usage("Vars"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.Runners, "runner", "", []string{}, flgs.Usage("Runners"))
+	grpcCmd.PersistentFlags().BoolVarP(&flgs.GRPCNoTLS, "grpc-no-tls", "", false, flgs.Usage("GRPCNoTLS"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCProtos, "grpc-proto", "", []string{}, flgs.Usage("GRPCProtos"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCProtosets, "grpc-protoset", "", []string{}, flgs.Usage("GRPCProtosets"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCImportPaths, "grpc-import-path", "", []string{}, flgs.Usage("GRPCImportPaths"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCBufDirs, "grpc-buf-dir", "", []string{}, flgs.Usage("GRPCBufDirs"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCBufLocks, "grpc-buf-lock", "", []string{}, flgs.Usage("GRPCBufLocks"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCBufConfigs, "grpc-buf-config", "", []string{}, flgs.Usage("GRPCBufConfigs"))
+	grpcCmd.PersistentFlags().StringSliceVarP(&flgs.GRPCBufModules, "grpc-buf-module", "", []string{}, flgs.Usage("GRPCBufModules"))
+	grpcCmd.PersistentFlags().StringVarP(&flgs.CacheDir, "cache-dir", "", "", flgs.Usage("CacheDir"))
+	grpcCmd.PersistentFlags().BoolVarP(&flgs.RetainCacheDir, "retain-cache-dir", "", false, flgs.Usage("RetainCacheDir"))
+	grpcCmd.PersistentFlags().StringVarP(&flgs.EnvFile, "env-file", "", "", flgs.Usage("EnvFile"))
+	grpcLsCmd.Flags().BoolVarP(&flgs.Long, "long", "l", false, flgs.Usage("Long"))
+}
@@ -27,6 +27,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/k1LoW/donegroup"
@@ -62,6 +63,34 @@ var loadtCmd = &cobra.Command{
 			return err
 		}
 
+		// setup trace exporter
+		tp, err := flgs.NewTracerProvider(ctx)
+		if err != nil {
+			return err
+		}
+		shutdownTracer := sync.OnceValue(func() error {
+			if tp == nil {
+				return nil
+			}
+			return tp.Shutdown(context.Background())
+		})
+		defer func() {
+			err = errors.Join(err, shutdownTracer())
+		}()
+		if tp != nil {
+			opts = append(opts, runn.TracerProvider(tp))
+		}
+
+		// setup metrics server
+		ms, err := setupMetricsServer(flgs.MetricsListen)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, ms.Shutdown())
+		}()
+		opts = append(opts, ms.Options()...)
+
 		// setup cache dir
 		if err := fs.SetCacheDir(flgs.CacheDir); err != nil {
 			return err
@@ -97,6 +126,7 @@ var loadtCmd = &cobra.Command{
 			return err
 		}
 
+		stopWatch := ms.WatchLoadtResult(len(selected), w, d, flgs.LoadTConcurrent, flgs.LoadTMaxRPS, ot.Result)
 		if isatty.IsTerminal(os.Stdout.Fd()) {
 			// With tty
 			p := tea.NewProgram(newSpinnerModel(), tea.WithContext(ctx))
@@ -106,15 +136,18 @@ var loadtCmd = &cobra.Command{
 				}
 			}()
 			if err := ot.Start(ctx); err != nil {
-				return err
+				return errors.Join(err, stopWatch())
 			}
 			p.Quit()
 			p.Wait()
 		} else {
 			if err := ot.Start(ctx); err != nil {
-				return err
+				return errors.Join(err, stopWatch())
 			}
 		}
+		if err := stopWatch(); err != nil {
+			return err
+		}
 
 		lr, err := runn.NewLoadtResult(len(selected), w, d, flgs.LoadTConcurrent, flgs.LoadTMaxRPS, ot.Result)
 		if err != nil {
@@ -147,6 +180,7 @@ func init() {
 	loadtCmd.Flags().StringSliceVarP(&flgs.HTTPOpenApi3s, "http-openapi3", "", []string{}, flgs.Usage("HTTPOpenApi3s"))
 	loadtCmd.Flags().BoolVarP(&flgs.GRPCNoTLS, "grpc-no-tls", "", false, flgs.Usage("GRPCNoTLS"))
 	loadtCmd.Flags().StringSliceVarP(&flgs.GRPCProtos, "grpc-proto", "", []string{}, flgs.Usage("GRPCProtos"))
+	loadtCmd.Flags().StringSliceVarP(&flgs.GRPCProtosets, "grpc-protoset", "", []string{}, flgs.Usage("GRPCProtosets"))
 	loadtCmd.Flags().StringSliceVarP(&flgs.GRPCImportPaths, "grpc-import-path", "", []string{}, flgs.Usage("GRPCImportPaths"))
 	loadtCmd.Flags().StringSliceVarP(&flgs.GRPCBufDirs, "grpc-buf-dir", "", []string{}, flgs.Usage("GRPCBufDirs"))
 	loadtCmd.Flags().StringSliceVarP(&flgs.GRPCBufLocks, "grpc-buf-lock", "", []string{}, flgs.Usage("GRPCBufLocks"))
@@ -180,4 +214,7 @@ func init() {
 	loadtCmd.Flags().StringVarP(&flgs.LoadTWarmUp, "warm-up", "", "5sec", flgs.Usage("LoadTWarmUp"))
 	loadtCmd.Flags().StringVarP(&flgs.LoadTThreshold, "threshold", "", "", flgs.Usage("LoadTThreshold"))
 	loadtCmd.Flags().IntVarP(&flgs.LoadTMaxRPS, "max-rps", "", 1, flgs.Usage("LoadTMaxRPS"))
+	loadtCmd.Flags().StringVarP(&flgs.OTLPEndpoint, "otlp-endpoint", "", "", flgs.Usage("OTLPEndpoint"))
+	loadtCmd.Flags().StringVarP(&flgs.OTLPFile, "otlp-file", "", "", flgs.Usage("OTLPFile"))
+	loadtCmd.Flags().StringVarP(&flgs.MetricsListen, "metrics-listen", "", "", flgs.Usage("MetricsListen"))
 }
@@ -0,0 +1,171 @@
+/*
+Copyright © 2022 Ken'ichiro Oyama <k1lowxb@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/k1LoW/runn"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	or "github.com/ryo-yamaoka/otchkiss/result"
+)
+
+const (
+	metricsShutdownTimeout = 5 * time.Second
+	metricsLoadtInterval   = 1 * time.Second
+)
+
+// metricsServer serves metrics of runbook runs.
+// A nil *metricsServer (metrics disabled) is valid and does nothing.
+type metricsServer struct {
+	capturer runn.Capturer
+	// setLoadtResult sets the result of the load test measured for d to the gauges.
+	setLoadtResult func(rc int, w, d time.Duration, c, m int, r *or.Result) error
+	shutdown       func() error
+}
+
+// setupMetricsServer starts the metrics server on addr if addr is not empty.
+func setupMetricsServer(addr string) (*metricsServer, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	reg := newMetricsRegistry()
+	mc, err := runn.NewMetricsCapturer(reg)
+	if err != nil {
+		return nil, err
+	}
+	shutdown, err := startMetricsServer(addr, reg)
+	if err != nil {
+		return nil, err
+	}
+	return &metricsServer{
+		capturer: mc,
+		setLoadtResult: func(rc int, w, d time.Duration, c, m int, r *or.Result) error {
+			lr, err := runn.NewLoadtResult(rc, w, d, c, m, r)
+			if err != nil {
+				return err
+			}
+			mc.SetLoadtResult(lr)
+			return nil
+		},
+		shutdown: shutdown,
+	}, nil
+}
+
+// Options returns the options to capture metrics of runbook runs.
+func (s *metricsServer) Options() []runn.Option {
+	if s == nil {
+		return nil
+	}
+	return []runn.Option{runn.Capture(s.capturer)}
+}
+
+// WatchLoadtResult updates the gauges of the load test with r every metricsLoadtInterval while the load test is running,
+// so that the gauges can be scraped during the load test.
+// The returned function stops updating and sets the final result to the gauges.
+func (s *metricsServer) WatchLoadtResult(rc int, w, d time.Duration, c, m int, r *or.Result) func() error {
+	if s == nil {
+		return func() error { return nil }
+	}
+	started := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(metricsLoadtInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				// Runs during the warm up are not counted.
+				e := min(time.Since(started)-w, d)
+				if e <= 0 || r.Succeeded()+r.Failed() == 0 {
+					continue
+				}
+				_ = s.setLoadtResult(rc, w, e, c, m, r)
+			}
+		}
+	}()
+	return func() error {
+		close(done)
+		<-stopped
+		if r.Succeeded()+r.Failed() == 0 {
+			return nil
+		}
+		return s.setLoadtResult(rc, w, d, c, m, r)
+	}
+}
+
+// Shutdown shuts down the metrics server.
+func (s *metricsServer) Shutdown() error {
+	if s == nil {
+		return nil
+	}
+	return s.shutdown()
+}
+
+// newMetricsRegistry returns the registry for metrics of runbook runs.
+func newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// startMetricsServer starts the server that serves metrics in OpenMetrics format on /metrics.
+// It returns the function to shut down the server.
+func startMetricsServer(addr string, reg *prometheus.Registry) (func() error, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		Registry:          reg,
+	}))
+	s := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}, nil
+}
@@ -125,6 +125,7 @@ func init() {
 	newCmd.Flags().BoolVarP(&flgs.AndRun, "and-run", "", false, flgs.Usage("AndRun"))
 	newCmd.Flags().BoolVarP(&flgs.GRPCNoTLS, "grpc-no-tls", "", false, flgs.Usage("GRPCNoTLS"))
 	newCmd.Flags().StringSliceVarP(&flgs.GRPCProtos, "grpc-proto", "", []string{}, flgs.Usage("GRPCProtos"))
+	newCmd.Flags().StringSliceVarP(&flgs.GRPCProtosets, "grpc-protoset", "", []string{}, flgs.Usage("GRPCProtosets"))
 	newCmd.Flags().StringSliceVarP(&flgs.GRPCImportPaths, "grpc-import-path", "", []string{}, flgs.Usage("GRPCImportPaths"))
 }
 
@@ -155,6 +156,7 @@ func runAndCapture(ctx context.Context, o *os.File, fn func(*os.File) error) err
 		runn.Capture(capture.Runbook(td, capture.RunbookLoadDesc(true))),
 		runn.GRPCNoTLS(flgs.GRPCNoTLS),
 		runn.GRPCProtos(flgs.GRPCProtos),
+		runn.GRPCProtosets(flgs.GRPCProtosets),
 		runn.GRPCImportPaths(flgs.GRPCImportPaths),
 		runn.Scopes(scope.AllowReadParent),
 	}
@@ -139,6 +139,8 @@ var rprofCmd = &cobra.Command{
 				id = fmt.Sprintf("%safterFunc[%d]", strings.Repeat("  ", rr.depth), *rr.trail.FuncIndex)
 			case runn.TrailTypeLoop:
 				id = fmt.Sprintf("%sloop[%d]", strings.Repeat("  ", rr.depth), *rr.trail.LoopIndex)
+			case runn.TrailTypePhase:
+				id = fmt.Sprintf("%s%s", strings.Repeat("  ", rr.depth), rr.trail.Phase)
 			default:
 				return fmt.Errorf("invalid trail type: %s", rr.trail.Type)
 			}
@@ -28,6 +28,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/goccy/go-json"
@@ -57,6 +58,34 @@ var runCmd = &cobra.Command{
 			return err
 		}
 
+		// setup trace exporter
+		tp, err := flgs.NewTracerProvider(ctx)
+		if err != nil {
+			return err
+		}
+		shutdownTracer := sync.OnceValue(func() error {
+			if tp == nil {
+				return nil
+			}
+			return tp.Shutdown(context.Background())
+		})
+		defer func() {
+			err = errors.Join(err, shutdownTracer())
+		}()
+		if tp != nil {
+			opts = append(opts, runn.TracerProvider(tp))
+		}
+
+		// setup metrics server
+		ms, err := setupMetricsServer(flgs.MetricsListen)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, ms.Shutdown())
+		}()
+		opts = append(opts, ms.Options()...)
+
 		// setup cache dir
 		if err := fs.SetCacheDir(flgs.CacheDir); err != nil {
 			return err
@@ -124,6 +153,10 @@ var runCmd = &cobra.Command{
 		}
 
 		if r.HasFailure() {
+			// os.Exit does not run deferred functions
+			if err := shutdownTracer(); err != nil {
+				return err
+			}
 			os.Exit(1)
 		}
 		return nil
@@ -140,12 +173,16 @@ func init() {
 	runCmd.Flags().StringSliceVarP(&flgs.HTTPOpenApi3s, "http-openapi3", "", []string{}, flgs.Usage("HTTPOpenApi3s"))
 	runCmd.Flags().BoolVarP(&flgs.GRPCNoTLS, "grpc-no-tls", "", false, flgs.Usage("GRPCNoTLS"))
 	runCmd.Flags().StringSliceVarP(&flgs.GRPCProtos, "grpc-proto", "", []string{}, flgs.Usage("GRPCProtos"))
+	runCmd.Flags().StringSliceVarP(&flgs.GRPCProtosets, "grpc-protoset", "", []string{}, flgs.Usage("GRPCProtosets"))
 	runCmd.Flags().StringSliceVarP(&flgs.GRPCImportPaths, "grpc-import-path", "", []string{}, flgs.Usage("GRPCImportPaths"))
 	runCmd.Flags().StringSliceVarP(&flgs.GRPCBufDirs, "grpc-buf-dir", "", []string{}, flgs.Usage("GRPCBufDirs"))
 	runCmd.Flags().StringSliceVarP(&flgs.GRPCBufLocks, "grpc-buf-lock", "", []string{}, flgs.Usage("GRPCBufLocks"))
 	runCmd.Flags().StringSliceVarP(&flgs.GRPCBufConfigs, "grpc-buf-config", "", []string{}, flgs.Usage("GRPCBufConfigs"))
 	runCmd.Flags().StringSliceVarP(&flgs.GRPCBufModules, "grpc-buf-module", "", []string{}, flgs.Usage("GRPCBufModules"))
 	runCmd.Flags().StringVarP(&flgs.CaptureDir, "capture", "", "", flgs.Usage("CaptureDir"))
+	runCmd.Flags().StringVarP(&flgs.RecordDir, "record", "", "", flgs.Usage("RecordDir"))
+	runCmd.Flags().StringVarP(&flgs.ReplayDir, "replay", "", "", flgs.Usage("ReplayDir"))
+	runCmd.Flags().StringVarP(&flgs.CookieJar, "cookie-jar", "", "", flgs.Usage("CookieJar"))
 	runCmd.Flags().StringSliceVarP(&flgs.Vars, "var", "", []string{}, flgs.Usage("Vars"))
 	runCmd.Flags().StringSliceVarP(&flgs.Runners, "runner", "", []string{}, flgs.Usage("Runners"))
 	runCmd.Flags().StringSliceVarP(&flgs.Overlays, "overlay", "", []string{}, flgs.Usage("Overlays"))
@@ -174,4 +211,7 @@ func init() {
 	runCmd.Flags().BoolVarP(&flgs.ForceColor, "force-color", "", false, flgs.Usage("ForceColor"))
 	runCmd.Flags().BoolVarP(&flgs.Coverage, "coverage", "", false, flgs.Usage("Coverage"))
 	runCmd.Flags().StringVarP(&flgs.CoverageOut, "coverage-out", "", "runn.coverage.json", flgs.Usage("CoverageOut"))
+	runCmd.Flags().StringVarP(&flgs.OTLPEndpoint, "otlp-endpoint", "", "", flgs.Usage("OTLPEndpoint"))
+	runCmd.Flags().StringVarP(&flgs.OTLPFile, "otlp-file", "", "", flgs.Usage("OTLPFile"))
+	runCmd.Flags().StringVarP(&flgs.MetricsListen, "metrics-listen", "", "", flgs.Usage("MetricsListen"))
 }
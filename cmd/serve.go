@@ -0,0 +1,172 @@
+/*
+Copyright © 2022 Ken'ichiro Oyama <k1lowxb@gmail.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn"
+	"github.com/k1LoW/runn/internal/fs"
+	"github.com/spf13/cobra"
+)
+
+const serveShutdownTimeout = 5 * time.Second
+
+// serveCmd represents the serve command.
+var serveCmd = &cobra.Command{
+	Use:     "serve [PATH_PATTERN ...]",
+	Short:   "run runbooks on their schedules and serve the status",
+	Long:    `run runbooks on their schedules ("schedule:" section) and serve the status of the runs over HTTP API.`,
+	Aliases: []string{"monitor"},
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		sctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		ctx, cancel := donegroup.WithCancel(sctx)
+		defer func() {
+			cancel()
+			err = errors.Join(err, donegroup.Wait(ctx))
+		}()
+
+		pathp := strings.Join(args, string(filepath.ListSeparator))
+		opts, err := flgs.ToOpts()
+		if err != nil {
+			return err
+		}
+
+		// setup trace exporter
+		tp, err := flgs.NewTracerProvider(ctx)
+		if err != nil {
+			return err
+		}
+		shutdownTracer := sync.OnceValue(func() error {
+			if tp == nil {
+				return nil
+			}
+			return tp.Shutdown(context.Background())
+		})
+		defer func() {
+			err = errors.Join(err, shutdownTracer())
+		}()
+		if tp != nil {
+			opts = append(opts, runn.TracerProvider(tp))
+		}
+
+		// setup metrics server
+		ms, err := setupMetricsServer(flgs.MetricsListen)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, ms.Shutdown())
+		}()
+		opts = append(opts, ms.Options()...)
+
+		// setup cache dir
+		if err := fs.SetCacheDir(flgs.CacheDir); err != nil {
+			return err
+		}
+		defer func() {
+			if !flgs.RetainCacheDir {
+				_ = fs.RemoveCacheDir()
+			}
+		}()
+
+		o, err := runn.Load(pathp, opts...)
+		if err != nil {
+			return err
+		}
+		m, err := runn.NewMonitor(o, flgs.HistorySize, flgs.HistoryDir)
+		if err != nil {
+			return err
+		}
+
+		ln, err := net.Listen("tcp", flgs.ServeListen)
+		if err != nil {
+			return err
+		}
+		s := &http.Server{
+			Handler:           m.Handler(),
+			ReadHeaderTimeout: serveShutdownTimeout,
+		}
+		go func() {
+			_ = s.Serve(ln)
+		}()
+		_, _ = fmt.Fprintf(os.Stderr, "Serving the status of scheduled runbook runs on %s\n", ln.Addr())
+		defer func() {
+			sctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+			defer cancel()
+			err = errors.Join(err, s.Shutdown(sctx))
+		}()
+
+		return m.Run(ctx)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().BoolVarP(&flgs.Debug, "debug", "", false, flgs.Usage("Debug"))
+	serveCmd.Flags().BoolVarP(&flgs.SkipTest, "skip-test", "", false, flgs.Usage("SkipTest"))
+	serveCmd.Flags().StringSliceVarP(&flgs.HostRules, "host-rules", "", []string{}, flgs.Usage("HostRules"))
+	serveCmd.Flags().StringSliceVarP(&flgs.HTTPOpenApi3s, "http-openapi3", "", []string{}, flgs.Usage("HTTPOpenApi3s"))
+	serveCmd.Flags().BoolVarP(&flgs.GRPCNoTLS, "grpc-no-tls", "", false, flgs.Usage("GRPCNoTLS"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCProtos, "grpc-proto", "", []string{}, flgs.Usage("GRPCProtos"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCProtosets, "grpc-protoset", "", []string{}, flgs.Usage("GRPCProtosets"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCImportPaths, "grpc-import-path", "", []string{}, flgs.Usage("GRPCImportPaths"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCBufDirs, "grpc-buf-dir", "", []string{}, flgs.Usage("GRPCBufDirs"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCBufLocks, "grpc-buf-lock", "", []string{}, flgs.Usage("GRPCBufLocks"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCBufConfigs, "grpc-buf-config", "", []string{}, flgs.Usage("GRPCBufConfigs"))
+	serveCmd.Flags().StringSliceVarP(&flgs.GRPCBufModules, "grpc-buf-module", "", []string{}, flgs.Usage("GRPCBufModules"))
+	serveCmd.Flags().StringSliceVarP(&flgs.Vars, "var", "", []string{}, flgs.Usage("Vars"))
+	serveCmd.Flags().StringSliceVarP(&flgs.Runners, "runner", "", []string{}, flgs.Usage("Runners"))
+	serveCmd.Flags().StringSliceVarP(&flgs.Overlays, "overlay", "", []string{}, flgs.Usage("Overlays"))
+	serveCmd.Flags().StringSliceVarP(&flgs.Underlays, "underlay", "", []string{}, flgs.Usage("Underlays"))
+	serveCmd.Flags().StringVarP(&flgs.RunMatch, "run", "", "", flgs.Usage("RunMatch"))
+	serveCmd.Flags().StringSliceVarP(&flgs.RunIDs, "id", "", []string{}, flgs.Usage("RunIDs"))
+	serveCmd.Flags().StringSliceVarP(&flgs.RunLabels, "label", "", []string{}, flgs.Usage("RunLabels"))
+	serveCmd.Flags().StringVarP(&flgs.CacheDir, "cache-dir", "", "", flgs.Usage("CacheDir"))
+	serveCmd.Flags().BoolVarP(&flgs.RetainCacheDir, "retain-cache-dir", "", false, flgs.Usage("RetainCacheDir"))
+	serveCmd.Flags().StringVarP(&flgs.WaitTimeout, "wait-timeout", "", "10sec", flgs.Usage("WaitTimeout"))
+	serveCmd.Flags().StringVarP(&flgs.EnvFile, "env-file", "", "", flgs.Usage("EnvFile"))
+	if err := serveCmd.MarkFlagFilename("env-file"); err != nil {
+		panic(err)
+	}
+	serveCmd.Flags().BoolVarP(&flgs.Verbose, "verbose", "", false, flgs.Usage("Verbose"))
+	serveCmd.Flags().StringVarP(&flgs.OTLPEndpoint, "otlp-endpoint", "", "", flgs.Usage("OTLPEndpoint"))
+	serveCmd.Flags().StringVarP(&flgs.OTLPFile, "otlp-file", "", "", flgs.Usage("OTLPFile"))
+	serveCmd.Flags().StringVarP(&flgs.MetricsListen, "metrics-listen", "", "", flgs.Usage("MetricsListen"))
+	serveCmd.Flags().StringVarP(&flgs.ServeListen, "listen", "", ":8080", flgs.Usage("ServeListen"))
+	serveCmd.Flags().IntVarP(&flgs.HistorySize, "history-size", "", 100, flgs.Usage("HistorySize"))
+	serveCmd.Flags().StringVarP(&flgs.HistoryDir, "history-dir", "", "", flgs.Usage("HistoryDir"))
+}
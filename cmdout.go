@@ -58,6 +58,7 @@ func (d *cmdOut) CaptureResultByStep(trs Trails, result *RunResult) {
 
 func (d *cmdOut) CaptureHTTPRequest(name string, req *http.Request)                  {}
 func (d *cmdOut) CaptureHTTPResponse(name string, res *http.Response)                {}
+func (d *cmdOut) CaptureHTTPEvent(name string, e *HTTPEvent)                         {}
 func (d *cmdOut) CaptureGRPCStart(name string, typ GRPCType, service, method string) {}
 func (d *cmdOut) CaptureGRPCRequestHeaders(h map[string][]string)                    {}
 func (d *cmdOut) CaptureGRPCRequestMessage(m map[string]any)                         {}
@@ -74,7 +75,7 @@ func (d *cmdOut) CaptureCDPEnd(name string)
 func (d *cmdOut) CaptureSSHCommand(command string)                                   {}
 func (d *cmdOut) CaptureSSHStdout(stdout string)                                     {}
 func (d *cmdOut) CaptureSSHStderr(stderr string)                                     {}
-func (d *cmdOut) CaptureDBStatement(name string, stmt string)                        {}
+func (d *cmdOut) CaptureDBStatement(name string, stmt string, args []any)            {}
 func (d *cmdOut) CaptureDBResponse(name string, res *DBResponse)                     {}
 func (d *cmdOut) CaptureExecCommand(command, shell string, background bool)          {}
 func (d *cmdOut) CaptureExecStdin(stdin string)                                      {}
@@ -100,7 +100,7 @@ func (o *operator) collectCoverage(ctx context.Context) (*Coverage, error) {
 
 	// Collect coverage for protocol buffers
 	for name, r := range o.grpcRunners {
-		if len(r.importPaths) > 0 || len(r.protos) > 0 || len(r.bufDirs) > 0 || len(r.bufLocks) > 0 || len(r.bufConfigs) > 0 || len(r.bufModules) > 0 {
+		if len(r.importPaths) > 0 || len(r.protos) > 0 || len(r.protosets) > 0 || len(r.bufDirs) > 0 || len(r.bufLocks) > 0 || len(r.bufConfigs) > 0 || len(r.bufModules) > 0 {
 			if err := r.resolveAllMethodsUsingProtos(ctx); err != nil {
 				o.Debugf("%s was not resolved: %s (%s)\n", name, err, o.bookPath)
 				continue
@@ -48,11 +48,38 @@ type dbRunner struct {
 	trace     *bool
 	// operatorID - The id of the operator for which the runner is defined.
 	operatorID string
+	// reusable - When true, the runner is shared across runs and should not be closed between them.
+	reusable bool
+	// transaction - The options of the transaction that begins automatically and is rolled back at the end of the runbook.
+	// nil means that each step runs in its own transaction.
+	transaction *sql.TxOptions
+	// tx - The transaction across steps that is currently open.
+	tx *nest.Tx
+	// autoSnapshot - When true, the snapshot of snapshotTables is taken before the first step and restored at the end of the runbook.
+	autoSnapshot bool
+	// snapshotTables - The tables of the snapshot taken automatically. Empty means all tables.
+	snapshotTables []string
+	// snapshot - The snapshot taken by `snapshot:`.
+	snapshot *dbTableSnapshot
 }
 
 type dbQuery struct {
 	stmt  string
 	trace *bool
+	// args - Positional arguments bound to `?` placeholders
+	args []any
+	// namedArgs - Named arguments bound to `:name` placeholders
+	namedArgs map[string]any
+	// txOp - The operation of the transaction across steps (`begin`, `commit` or `rollback`)
+	txOp string
+	// txOpts - The options of `begin:`
+	txOpts *sql.TxOptions
+	// fixtureOp - The operation of fixtures (`fixtures`, `snapshot` or `restore`)
+	fixtureOp string
+	// fixtures - The config of `fixtures:`
+	fixtures *dbFixtureConfig
+	// tables - The tables of `snapshot:`. Empty means all tables.
+	tables []string
 }
 
 type DBResponse struct {
@@ -107,13 +134,15 @@ func (rnr *dbRunner) Close() error {
 	if rnr.client == nil {
 		return nil
 	}
+	// Roll back the transaction and restore the snapshot left by the runbook before closing the connection
+	err := errors.Join(rnr.endTx(), rnr.endSnapshot(context.Background()))
 	if ndb, ok := rnr.client.(*nest.DB); ok {
 		if db := ndb.DB(); db != nil {
 			rnr.client = nil
-			return db.Close()
+			return errors.Join(err, db.Close())
 		}
 	}
-	return nil
+	return err
 }
 
 func (rnr *dbRunner) Renew() error {
@@ -138,7 +167,7 @@ func (rnr *dbRunner) run(ctx context.Context, q *dbQuery, s *step) error {
 			return err
 		}
 		rnr.client = nx
-		if rnr.dsn != "" {
+		if rnr.dsn != "" && !rnr.reusable {
 			if err := donegroup.Cleanup(ctx, func() error {
 				// In the case of Reused runners, leave the cleanup to the main cleanup
 				if o.id != rnr.operatorID {
@@ -150,11 +179,37 @@ func (rnr *dbRunner) run(ctx context.Context, q *dbQuery, s *step) error {
 			}
 		}
 	}
+	if rnr.autoSnapshot && rnr.snapshot == nil {
+		if err := rnr.takeSnapshot(ctx, rnr.snapshotTables); err != nil {
+			return err
+		}
+	}
+	if q.txOp != "" {
+		return rnr.runTxOp(ctx, q, s)
+	}
+	if q.fixtureOp != "" {
+		return rnr.runFixtureOp(ctx, q, s)
+	}
 	stmts := separateStmt(q.stmt)
+	if len(q.args) > 0 && len(stmts) > 1 {
+		return newErrUnrecoverable(errors.New("args cannot be used with multiple statements (use namedArgs instead)"))
+	}
+	driver := rnr.driverName()
 	out := map[string]any{}
-	tx, err := rnr.client.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		return err
+	if rnr.tx == nil && rnr.transaction != nil {
+		if err := rnr.begin(ctx, rnr.transaction); err != nil {
+			return err
+		}
+	}
+	// If the transaction across steps is open, the step runs in it and does not commit or roll back
+	inTx := rnr.tx != nil
+	tx := rnr.tx
+	if !inTx {
+		var err error
+		tx, err = rnr.client.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return err
+		}
 	}
 	// Override trace
 	switch {
@@ -168,13 +223,20 @@ func (rnr *dbRunner) run(ctx context.Context, q *dbQuery, s *step) error {
 		return newErrUnrecoverable(err)
 	}
 	for _, stmt := range stmts {
+		stmt, args, err := bindDBArgs(driver, stmt, q.args, q.namedArgs)
+		if err != nil {
+			if !inTx {
+				_ = tx.Rollback()
+			}
+			return newErrUnrecoverable(err)
+		}
 		stmt = stmt + tc // add trace comment
-		o.capturers.captureDBStatement(rnr.name, stmt)
-		err := func() error {
+		o.capturers.captureDBStatement(rnr.name, stmt, args)
+		err = func() error {
 			hasReturning := hasReturningClause(stmt)
 			if !isSELECTStmt(stmt) && !hasReturning {
 				// exec
-				r, err := tx.ExecContext(ctx, stmt)
+				r, err := tx.ExecContext(ctx, stmt, args...)
 				if err != nil {
 					return err
 				}
@@ -207,7 +269,7 @@ func (rnr *dbRunner) run(ctx context.Context, q *dbQuery, s *step) error {
 
 			// query
 			var rows []map[string]any
-			r, err := tx.QueryContext(ctx, stmt)
+			r, err := tx.QueryContext(ctx, stmt, args...)
 			if err != nil {
 				return err
 			}
@@ -319,14 +381,19 @@ func (rnr *dbRunner) run(ctx context.Context, q *dbQuery, s *step) error {
 			return nil
 		}()
 		if err != nil {
+			if inTx {
+				return err
+			}
 			if err := tx.Rollback(); err != nil {
 				return err
 			}
 			return err
 		}
 	}
-	if err := tx.Commit(); err != nil {
-		return err
+	if !inTx {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
 	}
 	o.record(s.idx, out)
 	return nil
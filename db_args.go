@@ -0,0 +1,201 @@
+package runn
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-sql/sqlexp/nest"
+)
+
+const (
+	dbDriverMySQL    = "mysql"
+	dbDriverPostgres = "postgres"
+	dbDriverSQLite   = "sqlite"
+	dbDriverSpanner  = "spanner"
+)
+
+// driverName returns the name of the database driver of the runner ("mysql", "postgres", "sqlite" or "spanner").
+// It returns an empty string if the driver is unknown.
+func (rnr *dbRunner) driverName() string {
+	ndb, ok := rnr.client.(*nest.DB)
+	if !ok || ndb.DB() == nil {
+		return ""
+	}
+	t := reflect.TypeOf(ndb.DB().Driver())
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	pkg := t.PkgPath()
+	switch {
+	case strings.Contains(pkg, "lib/pq") || strings.Contains(pkg, "jackc/pgx"):
+		return dbDriverPostgres
+	case strings.Contains(pkg, "go-sql-driver/mysql"):
+		return dbDriverMySQL
+	case strings.Contains(pkg, "sqlite"):
+		return dbDriverSQLite
+	case strings.Contains(pkg, "spanner"):
+		return dbDriverSpanner
+	default:
+		return ""
+	}
+}
+
+// bindDBArgs binds `args:` or `namedArgs:` to the statement.
+// Positional placeholders are written as `?` and named placeholders as `:name` regardless of the driver,
+// and they are rewritten to the placeholders of the driver (`$1` for PostgreSQL, `?` for others).
+// It returns the statement and the arguments to be passed to the driver.
+func bindDBArgs(driver, stmt string, args []any, namedArgs map[string]any) (string, []any, error) {
+	if len(args) > 0 && len(namedArgs) > 0 {
+		return "", nil, errors.New("args and namedArgs cannot be used at the same time")
+	}
+	if len(args) == 0 && len(namedArgs) == 0 {
+		return stmt, nil, nil
+	}
+	phs := scanPlaceholders(driver, stmt)
+	if driver == dbDriverPostgres && len(args) > 0 && slices.ContainsFunc(phs, func(ph *dbPlaceholder) bool { return ph.native }) {
+		// Placeholders of PostgreSQL are written directly (`?` is the JSONB operator)
+		return stmt, toDBArgs(args), nil
+	}
+	var (
+		b     strings.Builder
+		bound []any
+		last  int
+	)
+	for _, ph := range phs {
+		switch {
+		case ph.native:
+			continue
+		case ph.name == "" && len(args) == 0, ph.name != "" && len(namedArgs) == 0:
+			continue
+		}
+		var v any
+		if ph.name == "" {
+			if len(bound) >= len(args) {
+				return "", nil, fmt.Errorf("the number of placeholders is more than the number of args (%d)", len(args))
+			}
+			v = args[len(bound)]
+		} else {
+			var ok bool
+			v, ok = namedArgs[ph.name]
+			if !ok {
+				return "", nil, fmt.Errorf("namedArgs does not have %q", ph.name)
+			}
+		}
+		bound = append(bound, v)
+		b.WriteString(stmt[last:ph.start])
+		if driver == dbDriverPostgres {
+			b.WriteString("$" + strconv.Itoa(len(bound)))
+		} else {
+			b.WriteString("?")
+		}
+		last = ph.end
+	}
+	if len(args) > 0 && len(bound) != len(args) {
+		return "", nil, fmt.Errorf("the number of placeholders (%d) does not match the number of args (%d)", len(bound), len(args))
+	}
+	b.WriteString(stmt[last:])
+	return b.String(), toDBArgs(bound), nil
+}
+
+// toDBArgs converts the values of YAML to the arguments of the driver. Maps and lists are encoded to JSON.
+func toDBArgs(args []any) []any {
+	converted := make([]any, 0, len(args))
+	for _, v := range args {
+		switch v.(type) {
+		case map[string]any, []any:
+			b, err := json.Marshal(v)
+			if err == nil {
+				v = string(b)
+			}
+		}
+		converted = append(converted, v)
+	}
+	return converted
+}
+
+type dbPlaceholder struct {
+	start, end int
+	// name - The name of the named placeholder (`:name`). Empty if positional (`?`).
+	name string
+	// native - Whether the placeholder is written in the form of PostgreSQL (`$1`).
+	native bool
+}
+
+// scanPlaceholders scans the placeholders outside of quotes and comments in the statement.
+// Backslash escapes in quotes are honored only for MySQL and the escape string constants of PostgreSQL (E'...'),
+// and the JSONB operators of PostgreSQL (`?|` and `?&`) are not placeholders.
+func scanPlaceholders(driver, stmt string) []*dbPlaceholder {
+	var phs []*dbPlaceholder
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Skip quoted string or identifier ('' is the escaped quote)
+			escapable := c != '`' && (driver == dbDriverMySQL || (driver == dbDriverPostgres && c == '\'' && isEscapeStringPrefix(stmt, i)))
+			for i++; i < len(stmt); i++ {
+				if stmt[i] == '\\' && escapable {
+					i++
+					continue
+				}
+				if stmt[i] == c {
+					if i+1 < len(stmt) && stmt[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '-' && i+1 < len(stmt) && stmt[i+1] == '-':
+			for i < len(stmt) && stmt[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(stmt) && stmt[i+1] == '*':
+			end := strings.Index(stmt[i+2:], "*/")
+			if end < 0 {
+				return phs
+			}
+			i += end + 3
+		case c == '?' && driver == dbDriverPostgres && i+1 < len(stmt) && (stmt[i+1] == '|' || stmt[i+1] == '&'):
+			// JSONB operators
+			i++
+		case c == '?':
+			phs = append(phs, &dbPlaceholder{start: i, end: i + 1})
+		case c == '$' && i+1 < len(stmt) && isDigit(stmt[i+1]):
+			j := i + 1
+			for j < len(stmt) && isDigit(stmt[j]) {
+				j++
+			}
+			phs = append(phs, &dbPlaceholder{start: i, end: j, native: true})
+			i = j - 1
+		case c == ':' && i+1 < len(stmt) && isIdentStart(stmt[i+1]) && (i == 0 || stmt[i-1] != ':'):
+			j := i + 1
+			for j < len(stmt) && isIdentChar(stmt[j]) {
+				j++
+			}
+			phs = append(phs, &dbPlaceholder{start: i, end: j, name: stmt[i+1 : j]})
+			i = j - 1
+		}
+	}
+	return phs
+}
+
+// isEscapeStringPrefix reports whether the quote at i starts the escape string constant of PostgreSQL (E'...').
+func isEscapeStringPrefix(stmt string, i int) bool {
+	if i < 1 || (stmt[i-1] != 'E' && stmt[i-1] != 'e') {
+		return false
+	}
+	return i < 2 || !isIdentChar(stmt[i-2])
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isIdentStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
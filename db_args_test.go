@@ -0,0 +1,104 @@
+package runn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn/testutil"
+)
+
+func TestBindDBArgs(t *testing.T) {
+	tests := []struct {
+		driver    string
+		stmt      string
+		args      []any
+		namedArgs map[string]any
+		wantStmt  string
+		wantArgs  []any
+		wantErr   bool
+	}{
+		{dbDriverMySQL, "SELECT * FROM users", nil, nil, "SELECT * FROM users", nil, false},
+		{dbDriverMySQL, "SELECT * FROM users WHERE name = ? AND age > ?", []any{"alice", 20}, nil, "SELECT * FROM users WHERE name = ? AND age > ?", []any{"alice", 20}, false},
+		{dbDriverPostgres, "SELECT * FROM users WHERE name = ? AND age > ?", []any{"alice", 20}, nil, "SELECT * FROM users WHERE name = $1 AND age > $2", []any{"alice", 20}, false},
+		{dbDriverPostgres, "SELECT * FROM users WHERE name = $1", []any{"alice"}, nil, "SELECT * FROM users WHERE name = $1", []any{"alice"}, false},
+		{dbDriverSQLite, "SELECT '?', \"a?\", `b?` /* ? */ FROM users WHERE name = ? -- ?", []any{"alice"}, nil, "SELECT '?', \"a?\", `b?` /* ? */ FROM users WHERE name = ? -- ?", []any{"alice"}, false},
+		{dbDriverSQLite, "SELECT 'it''s ?' WHERE name = ?", []any{"alice"}, nil, "SELECT 'it''s ?' WHERE name = ?", []any{"alice"}, false},
+		{dbDriverMySQL, "SELECT * FROM users WHERE name = :name OR nick = :name", nil, map[string]any{"name": "alice"}, "SELECT * FROM users WHERE name = ? OR nick = ?", []any{"alice", "alice"}, false},
+		{dbDriverPostgres, "SELECT id::text FROM users WHERE name = :name AND age > :age", nil, map[string]any{"name": "alice", "age": 20}, "SELECT id::text FROM users WHERE name = $1 AND age > $2", []any{"alice", 20}, false},
+		{dbDriverPostgres, "SELECT * FROM users WHERE info ? 'key' AND name = :name", nil, map[string]any{"name": "alice"}, "SELECT * FROM users WHERE info ? 'key' AND name = $1", []any{"alice"}, false},
+		{dbDriverSQLite, `SELECT 'C:\' WHERE name = ?`, []any{"alice"}, nil, `SELECT 'C:\' WHERE name = ?`, []any{"alice"}, false},
+		{dbDriverPostgres, `SELECT 'C:\' WHERE name = ?`, []any{"alice"}, nil, `SELECT 'C:\' WHERE name = $1`, []any{"alice"}, false},
+		{dbDriverPostgres, `SELECT E'it\'s ?' WHERE name = ?`, []any{"alice"}, nil, `SELECT E'it\'s ?' WHERE name = $1`, []any{"alice"}, false},
+		{dbDriverMySQL, `SELECT 'it\'s ?' WHERE name = ?`, []any{"alice"}, nil, `SELECT 'it\'s ?' WHERE name = ?`, []any{"alice"}, false},
+		{dbDriverPostgres, "SELECT * FROM users WHERE info ?| array['a', 'b'] AND info ?& array['c'] AND name = ?", []any{"alice"}, nil, "SELECT * FROM users WHERE info ?| array['a', 'b'] AND info ?& array['c'] AND name = $1", []any{"alice"}, false},
+		{dbDriverPostgres, "SELECT * FROM users WHERE info ? 'key' AND name = $1", []any{"alice"}, nil, "SELECT * FROM users WHERE info ? 'key' AND name = $1", []any{"alice"}, false},
+		{dbDriverSpanner, "SELECT * FROM users WHERE name = :name", nil, map[string]any{"name": "alice"}, "SELECT * FROM users WHERE name = ?", []any{"alice"}, false},
+		{dbDriverSQLite, "INSERT INTO users (info) VALUES (?)", []any{map[string]any{"age": 20}}, nil, "INSERT INTO users (info) VALUES (?)", []any{`{"age":20}`}, false},
+		{dbDriverMySQL, "SELECT * FROM users WHERE name = ?", []any{"alice", "bob"}, nil, "", nil, true},
+		{dbDriverMySQL, "SELECT * FROM users WHERE name = ? AND age = ?", []any{"alice"}, nil, "", nil, true},
+		{dbDriverMySQL, "SELECT * FROM users WHERE name = :name", nil, map[string]any{"nick": "alice"}, "", nil, true},
+		{dbDriverMySQL, "SELECT * FROM users WHERE name = ?", []any{"alice"}, map[string]any{"name": "alice"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver+" "+tt.stmt, func(t *testing.T) {
+			gotStmt, gotArgs, err := bindDBArgs(tt.driver, tt.stmt, tt.args, tt.namedArgs)
+			if err != nil {
+				if !tt.wantErr {
+					t.Error(err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("want error")
+			}
+			if gotStmt != tt.wantStmt {
+				t.Errorf("got %q want %q", gotStmt, tt.wantStmt)
+			}
+			if diff := cmp.Diff(tt.wantArgs, gotArgs); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDBRunnerWithArgs(t *testing.T) {
+	ctx, cancel := donegroup.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, dsn := testutil.SQLite(t)
+	o, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newDBRunner("db", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := []*dbQuery{
+		{stmt: "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL, age INTEGER NOT NULL);"},
+		{stmt: "INSERT INTO users (username, age) VALUES (?, ?);", args: []any{"o'reilly", uint64(20)}},
+		{stmt: "INSERT INTO users (username, age) VALUES (:name, :age); SELECT username, age FROM users WHERE age >= :age ORDER BY id;", namedArgs: map[string]any{"name": "bob", "age": uint64(20)}},
+	}
+	for i, q := range queries {
+		if err := r.run(ctx, q, newStep(i, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := r.driverName(); got != dbDriverSQLite {
+		t.Errorf("got %q want %q", got, dbDriverSQLite)
+	}
+	got := o.store.Latest()
+	want := map[string]any{
+		"rows": []map[string]any{
+			{"username": "o'reilly", "age": int64(20)},
+			{"username": "bob", "age": int64(20)},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+	if err := r.run(ctx, &dbQuery{stmt: "SELECT 1; SELECT ?;", args: []any{1}}, newStep(len(queries), "stepKey", o, nil)); err == nil {
+		t.Error("want error")
+	}
+}
@@ -0,0 +1,366 @@
+package runn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/goccy/go-yaml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/duration"
+	"github.com/k1LoW/runn/internal/builtin"
+	"github.com/k1LoW/runn/internal/fs"
+)
+
+const dbAssertRunnerKey = "dbAssert"
+
+type dbAssertRunner struct{}
+
+// dbAssertion is the config of `dbAssert:`.
+type dbAssertion struct {
+	// expected - The expected rows or the path of the file of them (YAML, JSON or CSV).
+	expected any
+	// ignoreColumns - The columns not to be compared.
+	ignoreColumns []string
+	// ignoreRowOrder - Whether to ignore the order of rows. The order of columns is always ignored because rows are compared by column names.
+	ignoreRowOrder bool
+	// timeTolerance - The tolerance of timestamps.
+	timeTolerance time.Duration
+}
+
+// timeLayouts are the layouts of timestamps compared with timeTolerance.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+func newDBAssertRunner() *dbAssertRunner {
+	return &dbAssertRunner{}
+}
+
+// dbAssertionKeys are the keys of `dbAssert:`.
+var dbAssertionKeys = []string{"expected", "ignoreColumns", "ignoreRowOrder", "timeTolerance"}
+
+// validateDBAssertion validates only the structure of `dbAssert:` because the values may be expanded at runtime (e.g. `{{ vars.tolerance }}`).
+func validateDBAssertion(v any) error {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid dbAssert: %v", v)
+	}
+	for k := range m {
+		if !slices.Contains(dbAssertionKeys, k) {
+			return fmt.Errorf("invalid dbAssert: unknown key %q", k)
+		}
+	}
+	if _, ok := m["expected"]; !ok {
+		return errors.New("invalid dbAssert: expected is required")
+	}
+	return nil
+}
+
+// parseDBAssertion parses the expanded value of `dbAssert:`.
+func parseDBAssertion(v any) (*dbAssertion, error) {
+	if err := validateDBAssertion(v); err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[string]any)
+	a := &dbAssertion{}
+	for k, vv := range m {
+		switch k {
+		case "expected":
+			switch vv.(type) {
+			case string, []any:
+			default:
+				return nil, fmt.Errorf("invalid dbAssert: expected should be a list of rows or a path: %v", vv)
+			}
+			a.expected = vv
+		case "ignoreColumns":
+			l, ok := vv.([]any)
+			if !ok {
+				return nil, fmt.Errorf("invalid dbAssert: ignoreColumns should be a list: %v", vv)
+			}
+			for _, c := range l {
+				cs, ok := c.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid dbAssert: invalid column of ignoreColumns: %v", c)
+				}
+				a.ignoreColumns = append(a.ignoreColumns, cs)
+			}
+		case "ignoreRowOrder":
+			b, ok := vv.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid dbAssert: ignoreRowOrder should be bool: %v", vv)
+			}
+			a.ignoreRowOrder = b
+		case "timeTolerance":
+			s, ok := vv.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid dbAssert: timeTolerance should be a duration: %v", vv)
+			}
+			d, err := duration.Parse(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid dbAssert: timeTolerance: %w", err)
+			}
+			a.timeTolerance = d
+		}
+	}
+	return a, nil
+}
+
+func (rnr *dbAssertRunner) Run(ctx context.Context, s *step, first bool) error {
+	o := s.parent
+	if first {
+		return newErrUnrecoverable(errors.New("dbAssert should be used with a query of the DB runner"))
+	}
+	e, err := o.expandBeforeRecord(s.dbAssertCond, s)
+	if err != nil {
+		return err
+	}
+	a, err := parseDBAssertion(e)
+	if err != nil {
+		return newErrUnrecoverable(err)
+	}
+	rows, ok := o.store.Latest()[dbStoreRowsKey]
+	if !ok {
+		return newErrUnrecoverable(errors.New("dbAssert should be used with a query that returns rows"))
+	}
+	expected, fromCSV, err := rnr.expectedRows(a, s)
+	if err != nil {
+		return newErrUnrecoverable(err)
+	}
+	diff, err := diffDBRows(expected, rows, a, fromCSV)
+	if err != nil {
+		return newErrUnrecoverable(err)
+	}
+	if diff != "" {
+		return fmt.Errorf("rows do not match the expected (-expected +actual):\n%s", diff)
+	}
+	return nil
+}
+
+// expectedRows returns the expected rows. If the rows are loaded from a CSV file, fromCSV is true.
+func (rnr *dbAssertRunner) expectedRows(a *dbAssertion, s *step) (_ []map[string]any, fromCSV bool, _ error) {
+	p, ok := a.expected.(string)
+	if !ok {
+		rows, err := toFixtureRows(a.expected)
+		return rows, false, err
+	}
+	o := s.parent
+	fp, err := fs.Path(p, o.root)
+	if err != nil {
+		return nil, false, err
+	}
+	b, err := fs.ReadFile(fp)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read expected rows %s: %w", p, err)
+	}
+	var rows []map[string]any
+	switch strings.ToLower(filepath.Ext(fp)) {
+	case ".yml", ".yaml", ".json":
+		var v any
+		if err = yaml.Unmarshal(b, &v); err == nil {
+			rows, err = toFixtureRows(v)
+		}
+	case ".csv":
+		var ts []*dbFixtureTable
+		ts, err = parseDBFixtureCSV("", b)
+		if err == nil {
+			rows = ts[0].rows
+		}
+		fromCSV = true
+	default:
+		err = errors.New("unsupported format (should be YAML, JSON or CSV)")
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid expected rows %s: %w", p, err)
+	}
+	e, err := o.expandBeforeRecord(anyRows(rows), s)
+	if err != nil {
+		return nil, false, err
+	}
+	rows, err = toFixtureRows(e)
+	return rows, fromCSV, err
+}
+
+// diffDBRows reports the row-level diff between the expected rows and the actual rows using builtin.Diff.
+func diffDBRows(expected, actual any, a *dbAssertion, fromCSV bool) (string, error) {
+	ex, err := normalizeDBRows(expected)
+	if err != nil {
+		return "", err
+	}
+	ac, err := normalizeDBRows(actual)
+	if err != nil {
+		return "", err
+	}
+	if fromCSV {
+		// All values of CSV are strings
+		for _, r := range ac {
+			for k, v := range r {
+				r[k] = csvString(v)
+			}
+		}
+	}
+	var opts []cmp.Option
+	if a.timeTolerance > 0 {
+		opts = append(opts, timeToleranceOption(a.timeTolerance))
+	}
+	if a.ignoreRowOrder {
+		if err := sortDBRows(ex, a.ignoreColumns, a.timeTolerance > 0); err != nil {
+			return "", err
+		}
+		if err := sortDBRows(ac, a.ignoreColumns, a.timeTolerance > 0); err != nil {
+			return "", err
+		}
+		ac = pairDBRows(ex, ac, a.ignoreColumns, opts...)
+	}
+	var ignores []string
+	for _, c := range a.ignoreColumns {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return "", err
+		}
+		ignores = append(ignores, fmt.Sprintf(".[][%s]", string(b)))
+	}
+	return builtin.DiffWithOptions(ex, ac, ignores, opts...)
+}
+
+// normalizeDBRows converts the rows to the values of JSON (e.g. time.Time to string).
+func normalizeDBRows(rows any) ([]map[string]any, error) {
+	b, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	var normalized []map[string]any
+	if err := json.Unmarshal(b, &normalized); err != nil {
+		return nil, fmt.Errorf("invalid rows: %w", err)
+	}
+	return normalized, nil
+}
+
+// sortDBRows sorts the rows by the values except for the ignored columns.
+// If ignoreTimestamps is true, timestamps are not used for sorting because they are compared with the tolerance.
+func sortDBRows(rows []map[string]any, ignoreColumns []string, ignoreTimestamps bool) error {
+	type keyed struct {
+		key string
+		row map[string]any
+	}
+	krows := make([]keyed, 0, len(rows))
+	for _, r := range rows {
+		kr := map[string]any{}
+		for k, v := range r {
+			if slices.Contains(ignoreColumns, k) {
+				continue
+			}
+			if s, ok := v.(string); ok && ignoreTimestamps {
+				if _, ok := parseTimestamp(s); ok {
+					continue
+				}
+			}
+			kr[k] = v
+		}
+		b, err := json.Marshal(kr)
+		if err != nil {
+			return err
+		}
+		krows = append(krows, keyed{key: string(b), row: r})
+	}
+	slices.SortStableFunc(krows, func(x, y keyed) int {
+		return strings.Compare(x.key, y.key)
+	})
+	for i, kr := range krows {
+		rows[i] = kr.row
+	}
+	return nil
+}
+
+// pairDBRows reorders the actual rows so that each of them is at the position of the expected row equal to it (e.g. within the time tolerance).
+// The actual rows without the equal expected row fill the remaining positions in order.
+func pairDBRows(expected, actual []map[string]any, ignoreColumns []string, opts ...cmp.Option) []map[string]any {
+	strip := func(r map[string]any) map[string]any {
+		s := make(map[string]any, len(r))
+		for k, v := range r {
+			if !slices.Contains(ignoreColumns, k) {
+				s[k] = v
+			}
+		}
+		return s
+	}
+	paired := make([]map[string]any, len(expected))
+	used := make([]bool, len(actual))
+	for i, e := range expected {
+		se := strip(e)
+		for j, a := range actual {
+			if used[j] || !cmp.Equal(se, strip(a), opts...) {
+				continue
+			}
+			paired[i] = a
+			used[j] = true
+			break
+		}
+	}
+	var rest []map[string]any
+	for j, a := range actual {
+		if !used[j] {
+			rest = append(rest, a)
+		}
+	}
+	var result []map[string]any
+	for _, p := range paired {
+		if p == nil {
+			if len(rest) == 0 {
+				continue
+			}
+			p, rest = rest[0], rest[1:]
+		}
+		result = append(result, p)
+	}
+	return append(result, rest...)
+}
+
+func csvString(v any) any {
+	switch vv := v.(type) {
+	case nil, string:
+		return vv
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(vv)
+	default:
+		b, err := json.Marshal(vv)
+		if err != nil {
+			return vv
+		}
+		return string(b)
+	}
+}
+
+// timeToleranceOption treats the timestamps within the tolerance as equal.
+func timeToleranceOption(tolerance time.Duration) cmp.Option {
+	return cmp.FilterValues(func(x, y string) bool {
+		_, okx := parseTimestamp(x)
+		_, oky := parseTimestamp(y)
+		return okx && oky
+	}, cmp.Comparer(func(x, y string) bool {
+		tx, _ := parseTimestamp(x)
+		ty, _ := parseTimestamp(y)
+		d := tx.Sub(ty)
+		return d.Abs() <= tolerance
+	}))
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,228 @@
+package runn
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn/testutil"
+)
+
+func TestDiffDBRows(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	actual := []map[string]any{
+		{"id": int64(1), "username": "alice", "created": created},
+		{"id": int64(2), "username": "bob", "created": created.Add(time.Hour)},
+	}
+	tests := []struct {
+		name     string
+		expected []map[string]any
+		a        *dbAssertion
+		fromCSV  bool
+		wantDiff []string
+	}{
+		{
+			"match",
+			[]map[string]any{
+				{"id": 1, "username": "alice", "created": "2024-01-02T03:04:05Z"},
+				{"id": 2, "username": "bob", "created": "2024-01-02T04:04:05Z"},
+			},
+			&dbAssertion{},
+			false,
+			nil,
+		},
+		{
+			"mismatch",
+			[]map[string]any{
+				{"id": 1, "username": "alice", "created": "2024-01-02T03:04:05Z"},
+				{"id": 2, "username": "charlie", "created": "2024-01-02T04:04:05Z"},
+			},
+			&dbAssertion{},
+			false,
+			[]string{`-`, `"charlie"`, `+`, `"bob"`},
+		},
+		{
+			"ignore columns",
+			[]map[string]any{
+				{"username": "alice"},
+				{"username": "bob"},
+			},
+			&dbAssertion{ignoreColumns: []string{"id", "created"}},
+			false,
+			nil,
+		},
+		{
+			"row order",
+			[]map[string]any{
+				{"username": "bob"},
+				{"username": "alice"},
+			},
+			&dbAssertion{ignoreColumns: []string{"id", "created"}},
+			false,
+			[]string{`"bob"`, `"alice"`},
+		},
+		{
+			"ignore row order",
+			[]map[string]any{
+				{"username": "bob"},
+				{"username": "alice"},
+			},
+			&dbAssertion{ignoreColumns: []string{"id", "created"}, ignoreRowOrder: true},
+			false,
+			nil,
+		},
+		{
+			"ignore row order with time tolerance",
+			[]map[string]any{
+				{"username": "bob", "created": "2024-01-02 04:04:05"},
+				{"username": "alice", "created": "2024-01-02T03:04:05.5Z"},
+			},
+			&dbAssertion{ignoreColumns: []string{"id"}, ignoreRowOrder: true, timeTolerance: time.Second},
+			false,
+			nil,
+		},
+		{
+			"time tolerance",
+			[]map[string]any{
+				{"id": 1, "username": "alice", "created": "2024-01-02 03:04:06"},
+				{"id": 2, "username": "bob", "created": "2024-01-02T04:04:04.5Z"},
+			},
+			&dbAssertion{timeTolerance: time.Second},
+			false,
+			nil,
+		},
+		{
+			"out of time tolerance",
+			[]map[string]any{
+				{"id": 1, "username": "alice", "created": "2024-01-02T03:04:07Z"},
+				{"id": 2, "username": "bob", "created": "2024-01-02T04:04:05Z"},
+			},
+			&dbAssertion{timeTolerance: time.Second},
+			false,
+			[]string{`"2024-01-02T03:04:07Z"`},
+		},
+		{
+			"csv",
+			[]map[string]any{
+				{"id": "1", "username": "alice"},
+				{"id": "2", "username": "bob"},
+			},
+			&dbAssertion{ignoreColumns: []string{"created"}},
+			true,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := diffDBRows(tt.expected, actual, tt.a, tt.fromCSV)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.wantDiff) == 0 {
+				if got != "" {
+					t.Errorf("got diff:\n%s", got)
+				}
+				return
+			}
+			if got == "" {
+				t.Fatal("want diff")
+			}
+			for _, w := range tt.wantDiff {
+				if !strings.Contains(got, w) {
+					t.Errorf("diff does not contain %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDBAssertion(t *testing.T) {
+	tests := []struct {
+		v       any
+		wantErr bool
+	}{
+		{map[string]any{"expected": []any{map[string]any{"id": 1}}, "ignoreColumns": []any{"created"}, "ignoreRowOrder": true, "timeTolerance": "1sec"}, false},
+		{map[string]any{"expected": "expected.csv"}, false},
+		{map[string]any{"ignoreRowOrder": true}, true},
+		{map[string]any{"expected": map[string]any{"id": 1}}, true},
+		{map[string]any{"expected": []any{}, "ignoreColumns": "created"}, true},
+		{map[string]any{"expected": []any{}, "timeTolerance": "soon"}, true},
+		{map[string]any{"expected": []any{}, "unknown": true}, true},
+		{[]any{}, true},
+	}
+	for _, tt := range tests {
+		_, err := parseDBAssertion(tt.v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v", tt.v, err)
+		}
+	}
+}
+
+func TestValidateDBAssertion(t *testing.T) {
+	tests := []struct {
+		v       any
+		wantErr bool
+	}{
+		{map[string]any{"expected": "{{ vars.expected }}", "ignoreRowOrder": "{{ vars.ignore }}", "timeTolerance": "{{ vars.tolerance }}"}, false},
+		{map[string]any{"ignoreRowOrder": true}, true},
+		{map[string]any{"expected": []any{}, "ignoreOrder": true}, true},
+		{"{{ vars.dbAssert }}", true},
+	}
+	for _, tt := range tests {
+		err := validateDBAssertion(tt.v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v", tt.v, err)
+		}
+	}
+}
+
+func TestDBAssertRunner(t *testing.T) {
+	tests := []struct {
+		expected any
+		wantErr  bool
+	}{
+		{"testdata/dbfixtures/users_expected.csv", false},
+		{[]any{map[string]any{"id": uint64(1), "username": "alice"}}, true},
+	}
+	for _, tt := range tests {
+		ctx, cancel := donegroup.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		db, dsn := testutil.SQLite(t)
+		if _, err := db.ExecContext(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT NOT NULL); INSERT INTO users VALUES (1, 'alice'), (2, 'bob');"); err != nil {
+			t.Fatal(err)
+		}
+		o, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := newDBRunner("db", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = r.Close()
+		})
+		s := newStep(0, "stepKey", o, nil)
+		s.dbAssertCond = map[string]any{"expected": tt.expected}
+		if err := r.run(ctx, &dbQuery{stmt: "SELECT id, username FROM users ORDER BY id;"}, s); err != nil {
+			t.Fatal(err)
+		}
+		err = newDBAssertRunner().Run(ctx, s, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v", tt.expected, err)
+		}
+	}
+}
+
+func TestDBAssertRunbook(t *testing.T) {
+	ctx := context.Background()
+	o, err := New(Book("testdata/book/db_assert.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,572 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/golang-sql/sqlexp/nest"
+	"github.com/k1LoW/runn/internal/fs"
+)
+
+const (
+	dbFixtures = "fixtures"
+	dbSnapshot = "snapshot"
+	dbRestore  = "restore"
+)
+
+// dbFixtureConfig is the config of `fixtures:` of the DB step.
+type dbFixtureConfig struct {
+	// paths - The paths of fixture files (YAML, JSON or CSV).
+	paths []string
+	// truncate - Whether to delete existing rows of the tables before loading.
+	truncate bool
+}
+
+// dbFixtureTable is the rows to be loaded into the table.
+type dbFixtureTable struct {
+	name string
+	rows []map[string]any
+}
+
+// dbTableSnapshot is the rows of the tables captured by `snapshot:`.
+type dbTableSnapshot struct {
+	// tables - The names of the tables in dependency order.
+	tables []string
+	rows   map[string][]map[string]any
+}
+
+// parseDBFixtureConfig parses the value of `fixtures:`.
+// The value is a path, a list of paths or a map with `paths:` and `truncate:`.
+func parseDBFixtureConfig(v any) (*dbFixtureConfig, error) {
+	c := &dbFixtureConfig{truncate: true}
+	switch vv := v.(type) {
+	case string, []any:
+		paths, err := parseDBFixturePaths(vv)
+		if err != nil {
+			return nil, err
+		}
+		c.paths = paths
+	case map[string]any:
+		for k, vvv := range vv {
+			switch k {
+			case "paths":
+				paths, err := parseDBFixturePaths(vvv)
+				if err != nil {
+					return nil, err
+				}
+				c.paths = paths
+			case "truncate":
+				t, ok := vvv.(bool)
+				if !ok {
+					return nil, fmt.Errorf("invalid truncate: %v", vvv)
+				}
+				c.truncate = t
+			default:
+				return nil, fmt.Errorf("invalid fixtures option: %s", k)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid fixtures: %v", v)
+	}
+	if len(c.paths) == 0 {
+		return nil, errors.New("fixtures: paths are required")
+	}
+	return c, nil
+}
+
+func parseDBFixturePaths(v any) ([]string, error) {
+	switch vv := v.(type) {
+	case string:
+		return []string{vv}, nil
+	case []any:
+		var paths []string
+		for _, p := range vv {
+			ps, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid path of fixtures: %v", p)
+			}
+			paths = append(paths, ps)
+		}
+		return paths, nil
+	default:
+		return nil, fmt.Errorf("invalid paths of fixtures: %v", v)
+	}
+}
+
+// parseDBSnapshotTables parses the value of `snapshot:`. true means all tables (nil).
+func parseDBSnapshotTables(v any) ([]string, error) {
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !vv {
+			return nil, errors.New("snapshot should be true or a list of tables")
+		}
+		return nil, nil
+	case []any:
+		var tables []string
+		for _, t := range vv {
+			ts, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid table of snapshot: %v", t)
+			}
+			tables = append(tables, ts)
+		}
+		return tables, nil
+	default:
+		return nil, fmt.Errorf("invalid snapshot: %v", v)
+	}
+}
+
+// setAutoSnapshot sets the value of `snapshot:` of the runner.
+func (rnr *dbRunner) setAutoSnapshot(v any) error {
+	if b, ok := v.(bool); v == nil || (ok && !b) {
+		return nil
+	}
+	tables, err := parseDBSnapshotTables(v)
+	if err != nil {
+		return err
+	}
+	rnr.autoSnapshot = true
+	rnr.snapshotTables = tables
+	return nil
+}
+
+// runFixtureOp runs `fixtures:`, `snapshot:` or `restore:` of the step.
+func (rnr *dbRunner) runFixtureOp(ctx context.Context, q *dbQuery, s *step) error {
+	o := s.parent
+	switch q.fixtureOp {
+	case dbFixtures:
+		tables, err := loadDBFixtures(q.fixtures.paths, o, s)
+		if err != nil {
+			return newErrUnrecoverable(err)
+		}
+		if rnr.tx == nil && rnr.transaction != nil {
+			if err := rnr.begin(ctx, rnr.transaction); err != nil {
+				return err
+			}
+		}
+		var n int64
+		if err := rnr.withTx(ctx, func(tx *nest.Tx) error {
+			n, err = rnr.loadFixtures(ctx, tx, tables, q.fixtures.truncate)
+			return err
+		}); err != nil {
+			return err
+		}
+		o.record(s.idx, map[string]any{dbStoreRowsAffectedKey: n})
+	case dbSnapshot:
+		if err := rnr.takeSnapshot(ctx, q.tables); err != nil {
+			return err
+		}
+		o.record(s.idx, map[string]any{})
+	case dbRestore:
+		if err := rnr.restoreSnapshot(ctx); err != nil {
+			return err
+		}
+		o.record(s.idx, map[string]any{})
+	default:
+		return fmt.Errorf("invalid operation: %s", q.fixtureOp)
+	}
+	return nil
+}
+
+// withTx runs fn in the transaction across steps if it is open, otherwise in a new transaction.
+func (rnr *dbRunner) withTx(ctx context.Context, fn func(tx *nest.Tx) error) error {
+	if rnr.tx != nil {
+		return fn(rnr.tx)
+	}
+	tx, err := rnr.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// loadDBFixtures loads the fixture files and expands the values of them.
+func loadDBFixtures(paths []string, o *operator, s *step) ([]*dbFixtureTable, error) {
+	var tables []*dbFixtureTable
+	for _, p := range paths {
+		fp, err := fs.Path(p, o.root)
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures %s: %w", p, err)
+		}
+		var ts []*dbFixtureTable
+		switch strings.ToLower(filepath.Ext(fp)) {
+		case ".yml", ".yaml", ".json":
+			ts, err = parseDBFixtureYAML(b)
+		case ".csv":
+			ts, err = parseDBFixtureCSV(strings.TrimSuffix(filepath.Base(fp), filepath.Ext(fp)), b)
+		default:
+			err = errors.New("unsupported format (should be YAML, JSON or CSV)")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixtures %s: %w", p, err)
+		}
+		for _, t := range ts {
+			// Expand expressions (e.g. "{{ faker.Name() }}") for each file
+			e, err := o.expandBeforeRecord(anyRows(t.rows), s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fixtures %s: %w", p, err)
+			}
+			rows, err := toFixtureRows(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fixtures %s: %s: %w", p, t.name, err)
+			}
+			t.rows = rows
+		}
+		tables = append(tables, ts...)
+	}
+	return tables, nil
+}
+
+// parseDBFixtureYAML parses the fixtures of the form `table: [rows]`.
+func parseDBFixtureYAML(b []byte) ([]*dbFixtureTable, error) {
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(b, &ms); err != nil {
+		return nil, err
+	}
+	var tables []*dbFixtureTable
+	for _, item := range ms {
+		name, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid table name: %v", item.Key)
+		}
+		rows, err := toFixtureRows(item.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		tables = append(tables, &dbFixtureTable{name: name, rows: rows})
+	}
+	return tables, nil
+}
+
+// parseDBFixtureCSV parses the fixtures of the table. The first record is the header of column names.
+func parseDBFixtureCSV(name string, b []byte) ([]*dbFixtureTable, error) {
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	t := &dbFixtureTable{name: name}
+	if len(records) == 0 {
+		return []*dbFixtureTable{t}, nil
+	}
+	header := records[0]
+	for _, rec := range records[1:] {
+		row := map[string]any{}
+		for i, c := range header {
+			row[c] = rec[i]
+		}
+		t.rows = append(t.rows, row)
+	}
+	return []*dbFixtureTable{t}, nil
+}
+
+func toFixtureRows(v any) ([]map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	l, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("rows should be a list: %v", v)
+	}
+	var rows []map[string]any
+	for _, r := range l {
+		row, ok := r.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("row should be a map: %v", r)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func anyRows(rows []map[string]any) []any {
+	l := make([]any, 0, len(rows))
+	for _, r := range rows {
+		l = append(l, r)
+	}
+	return l
+}
+
+// loadFixtures deletes existing rows of the tables (if truncate) and inserts the rows in dependency order.
+func (rnr *dbRunner) loadFixtures(ctx context.Context, tx *nest.Tx, tables []*dbFixtureTable, truncate bool) (int64, error) {
+	var names []string
+	rows := map[string][]map[string]any{}
+	for _, t := range tables {
+		if _, ok := rows[t.name]; !ok {
+			names = append(names, t.name)
+		}
+		rows[t.name] = append(rows[t.name], t.rows...)
+	}
+	names, err := rnr.sortTablesByDependency(ctx, tx, names)
+	if err != nil {
+		return 0, err
+	}
+	if truncate {
+		if err := rnr.deleteRows(ctx, tx, names); err != nil {
+			return 0, err
+		}
+	}
+	return rnr.insertRows(ctx, tx, names, rows)
+}
+
+// takeSnapshot captures the rows of the tables. If tables is empty, all tables are captured.
+func (rnr *dbRunner) takeSnapshot(ctx context.Context, tables []string) error {
+	return rnr.withTx(ctx, func(tx *nest.Tx) error {
+		var err error
+		if len(tables) == 0 {
+			tables, err = rnr.listTables(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+		tables, err = rnr.sortTablesByDependency(ctx, tx, tables)
+		if err != nil {
+			return err
+		}
+		ss := &dbTableSnapshot{tables: tables, rows: map[string][]map[string]any{}}
+		for _, t := range tables {
+			rows, err := selectRawRows(ctx, tx, fmt.Sprintf("SELECT * FROM %s", quoteDBIdent(rnr.driverName(), t)))
+			if err != nil {
+				return fmt.Errorf("failed to take snapshot of %s: %w", t, err)
+			}
+			ss.rows[t] = rows
+		}
+		rnr.snapshot = ss
+		return nil
+	})
+}
+
+// restoreSnapshot restores the rows of the tables captured by takeSnapshot.
+func (rnr *dbRunner) restoreSnapshot(ctx context.Context) error {
+	if rnr.snapshot == nil {
+		return errors.New("snapshot has not been taken")
+	}
+	ss := rnr.snapshot
+	return rnr.withTx(ctx, func(tx *nest.Tx) error {
+		if err := rnr.deleteRows(ctx, tx, ss.tables); err != nil {
+			return err
+		}
+		if _, err := rnr.insertRows(ctx, tx, ss.tables, ss.rows); err != nil {
+			return fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+		return nil
+	})
+}
+
+// endSnapshot restores the snapshot taken by `snapshot:` of the runner at the end of the runbook.
+func (rnr *dbRunner) endSnapshot(ctx context.Context) error {
+	if !rnr.autoSnapshot || rnr.snapshot == nil {
+		return nil
+	}
+	defer func() {
+		rnr.snapshot = nil
+	}()
+	if err := rnr.restoreSnapshot(ctx); err != nil {
+		return fmt.Errorf("failed to restore the snapshot of %s: %w", rnr.name, err)
+	}
+	return nil
+}
+
+// deleteRows deletes all rows of the tables in reverse dependency order.
+func (rnr *dbRunner) deleteRows(ctx context.Context, tx *nest.Tx, tables []string) error {
+	driver := rnr.driverName()
+	for _, t := range slices.Backward(tables) {
+		if _, err := tx.ExecContext(ctx, deleteAllRowsStmt(driver, t)); err != nil {
+			return fmt.Errorf("failed to delete rows of %s: %w", t, err)
+		}
+	}
+	return nil
+}
+
+// insertRows inserts the rows into the tables in the order of tables.
+func (rnr *dbRunner) insertRows(ctx context.Context, tx *nest.Tx, tables []string, rows map[string][]map[string]any) (int64, error) {
+	driver := rnr.driverName()
+	var n int64
+	for _, t := range tables {
+		for _, row := range rows[t] {
+			cols := slices.Sorted(maps.Keys(row))
+			qcols := make([]string, 0, len(cols))
+			phs := make([]string, 0, len(cols))
+			vals := make([]any, 0, len(cols))
+			for _, c := range cols {
+				qcols = append(qcols, quoteDBIdent(driver, c))
+				phs = append(phs, "?")
+				vals = append(vals, row[c])
+			}
+			stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteDBIdent(driver, t), strings.Join(qcols, ", "), strings.Join(phs, ", "))
+			if len(cols) == 0 && driver != dbDriverMySQL {
+				stmt = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", quoteDBIdent(driver, t))
+			}
+			stmt, args, err := bindDBArgs(driver, stmt, vals, nil)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+				return 0, fmt.Errorf("failed to insert into %s: %w", t, err)
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// listTables returns the names of the tables of the database.
+func (rnr *dbRunner) listTables(ctx context.Context, tx *nest.Tx) ([]string, error) {
+	var stmt string
+	switch rnr.driverName() {
+	case dbDriverSQLite:
+		stmt = "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+	case dbDriverMySQL:
+		stmt = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name"
+	case dbDriverPostgres:
+		stmt = "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE' ORDER BY table_name"
+	case dbDriverSpanner:
+		stmt = "SELECT table_name FROM information_schema.tables WHERE table_schema = '' ORDER BY table_name"
+	default:
+		return nil, errors.New("listing tables is not supported for the driver (specify the tables)")
+	}
+	return selectStrings(ctx, tx, stmt)
+}
+
+// referencedTables returns the names of the tables referenced by the foreign keys of the table.
+func (rnr *dbRunner) referencedTables(ctx context.Context, tx *nest.Tx, table string) ([]string, error) {
+	switch rnr.driverName() {
+	case dbDriverSQLite:
+		return selectStrings(ctx, tx, `SELECT DISTINCT "table" FROM pragma_foreign_key_list(?)`, table)
+	case dbDriverMySQL:
+		return selectStrings(ctx, tx, "SELECT DISTINCT referenced_table_name FROM information_schema.key_column_usage WHERE table_schema = DATABASE() AND table_name = ? AND referenced_table_name IS NOT NULL", table)
+	case dbDriverPostgres:
+		return selectStrings(ctx, tx, `SELECT DISTINCT ccu.table_name FROM information_schema.table_constraints tc
+JOIN information_schema.constraint_column_usage ccu ON tc.constraint_name = ccu.constraint_name AND tc.constraint_schema = ccu.constraint_schema
+WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema() AND tc.table_name = $1`, table)
+	default:
+		// Keep the order of the tables
+		return nil, nil
+	}
+}
+
+// sortTablesByDependency sorts the tables so that the referenced tables come first.
+// The order of the tables is kept as much as possible. Tables in a cycle are kept in the original order.
+func (rnr *dbRunner) sortTablesByDependency(ctx context.Context, tx *nest.Tx, tables []string) ([]string, error) {
+	deps := map[string][]string{}
+	for _, t := range tables {
+		refs, err := rnr.referencedTables(ctx, tx, t)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get foreign keys of %s: %w", t, err)
+		}
+		deps[t] = refs
+	}
+	return sortByDependency(tables, deps), nil
+}
+
+func sortByDependency(tables []string, deps map[string][]string) []string {
+	var (
+		sorted  []string
+		done    = map[string]bool{}
+		visited = map[string]bool{}
+	)
+	var visit func(t string)
+	visit = func(t string) {
+		if done[t] || visited[t] {
+			return
+		}
+		visited[t] = true
+		for _, d := range deps[t] {
+			if d != t && slices.Contains(tables, d) {
+				visit(d)
+			}
+		}
+		done[t] = true
+		sorted = append(sorted, t)
+	}
+	for _, t := range tables {
+		visit(t)
+	}
+	return sorted
+}
+
+func selectStrings(ctx context.Context, tx *nest.Tx, stmt string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var l []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		l = append(l, s)
+	}
+	return l, rows.Err()
+}
+
+// selectRawRows selects the rows with the values of the driver as they are, so that they can be inserted again.
+func selectRawRows(ctx context.Context, tx *nest.Tx, stmt string) ([]map[string]any, error) {
+	rows, err := tx.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var l []map[string]any
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := map[string]any{}
+		for i, c := range cols {
+			row[c] = vals[i]
+		}
+		l = append(l, row)
+	}
+	return l, rows.Err()
+}
+
+// deleteAllRowsStmt returns the statement to delete all rows of the table.
+// Cloud Spanner requires the WHERE clause in DELETE statements.
+func deleteAllRowsStmt(driver, table string) string {
+	if driver == dbDriverSpanner {
+		return fmt.Sprintf("DELETE FROM %s WHERE true", quoteDBIdent(driver, table))
+	}
+	return fmt.Sprintf("DELETE FROM %s", quoteDBIdent(driver, table))
+}
+
+// quoteDBIdent quotes the identifier (e.g. "schema.table") for the driver.
+func quoteDBIdent(driver, name string) string {
+	q := `"`
+	if driver == dbDriverMySQL || driver == dbDriverSpanner {
+		q = "`"
+	}
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = q + strings.ReplaceAll(p, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,257 @@
+package runn
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn/testutil"
+)
+
+const dbFixtureSchema = `CREATE TABLE post_tags (post_id INTEGER NOT NULL REFERENCES posts(id), tag TEXT NOT NULL);
+CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users(id), title TEXT NOT NULL);
+CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT NOT NULL, email TEXT NOT NULL);`
+
+func TestSortByDependency(t *testing.T) {
+	tests := []struct {
+		tables []string
+		deps   map[string][]string
+		want   []string
+	}{
+		{[]string{"a", "b", "c"}, nil, []string{"a", "b", "c"}},
+		{[]string{"post_tags", "posts", "users"}, map[string][]string{"post_tags": {"posts"}, "posts": {"users"}}, []string{"users", "posts", "post_tags"}},
+		{[]string{"users", "employees"}, map[string][]string{"employees": {"employees", "users"}}, []string{"users", "employees"}},
+		{[]string{"a", "b"}, map[string][]string{"a": {"b"}, "b": {"a"}}, []string{"b", "a"}},
+		{[]string{"posts"}, map[string][]string{"posts": {"users"}}, []string{"posts"}},
+	}
+	for _, tt := range tests {
+		got := sortByDependency(tt.tables, tt.deps)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Error(diff)
+		}
+	}
+}
+
+func TestDeleteAllRowsStmt(t *testing.T) {
+	tests := []struct {
+		driver string
+		table  string
+		want   string
+	}{
+		{dbDriverSQLite, "users", `DELETE FROM "users"`},
+		{dbDriverPostgres, "public.users", `DELETE FROM "public"."users"`},
+		{dbDriverMySQL, "users", "DELETE FROM `users`"},
+		{dbDriverSpanner, "users", "DELETE FROM `users` WHERE true"},
+	}
+	for _, tt := range tests {
+		if got := deleteAllRowsStmt(tt.driver, tt.table); got != tt.want {
+			t.Errorf("got %q want %q", got, tt.want)
+		}
+	}
+}
+
+func TestParseDBFixtureCSV(t *testing.T) {
+	b, err := os.ReadFile("testdata/dbfixtures/posts.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseDBFixtureCSV("posts", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*dbFixtureTable{
+		{name: "posts", rows: []map[string]any{
+			{"id": "1", "user_id": "2", "title": "Hello"},
+			{"id": "2", "user_id": "1", "title": "Hello, world"},
+		}},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(dbFixtureTable{})); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDBRunnerFixtures(t *testing.T) {
+	ctx, cancel := donegroup.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, dbFixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (id, username, email) VALUES (3, 'charlie', 'charlie@example.com'); PRAGMA foreign_keys = ON;"); err != nil {
+		t.Fatal(err)
+	}
+	o, err := New(Var("tag", "greeting"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newDBRunner("db", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+	queries := []*dbQuery{
+		{fixtureOp: dbSnapshot},
+		{fixtureOp: dbFixtures, fixtures: &dbFixtureConfig{
+			// Listed in the reverse order of dependency
+			paths:    []string{"testdata/dbfixtures/tags.json", "testdata/dbfixtures/posts.csv", "testdata/dbfixtures/users.yml"},
+			truncate: true,
+		}},
+	}
+	for i, q := range queries {
+		if err := r.run(ctx, q, newStep(i, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff(map[string]any{"rows_affected": int64(5)}, o.store.Latest()); diff != "" {
+		t.Error(diff)
+	}
+	if err := r.run(ctx, &dbQuery{stmt: "SELECT u.username, p.title, t.tag, u.email LIKE '%@%' AS valid FROM post_tags t JOIN posts p ON t.post_id = p.id JOIN users u ON p.user_id = u.id;"}, newStep(2, "stepKey", o, nil)); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"rows": []map[string]any{
+			{"username": "bob", "title": "Hello", "tag": "greeting", "valid": int64(1)},
+		},
+	}
+	if diff := cmp.Diff(want, o.store.Latest()); diff != "" {
+		t.Error(diff)
+	}
+
+	if err := r.run(ctx, &dbQuery{fixtureOp: dbRestore}, newStep(3, "stepKey", o, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.run(ctx, &dbQuery{stmt: "SELECT (SELECT COUNT(*) FROM post_tags) AS t, (SELECT COUNT(*) FROM posts) AS p, (SELECT username FROM users) AS u;"}, newStep(4, "stepKey", o, nil)); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]any{
+		"rows": []map[string]any{
+			{"t": int64(0), "p": int64(0), "u": "charlie"},
+		},
+	}
+	if diff := cmp.Diff(want, o.store.Latest()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDBRunnerAutoSnapshot(t *testing.T) {
+	ctx := context.Background()
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, dbFixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (id, username, email) VALUES (1, 'alice', 'alice@example.com');"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_DSN", dsn)
+	o, err := New(Book("testdata/book/db_snapshot.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := db.QueryRowContext(ctx, "SELECT group_concat(username) FROM users").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestDBRunnerAutoSnapshotRestoredInIncludedRunbook(t *testing.T) {
+	ctx := context.Background()
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, dbFixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (id, username, email) VALUES (1, 'alice', 'alice@example.com');"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_DSN", dsn)
+	o, err := New(Book("testdata/book/db_snapshot_include_main.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The parent runbook tests that the snapshot is restored right after the included runbook.
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBRunnerAutoSnapshotRestoredOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, dbFixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (id, username, email) VALUES (1, 'alice', 'alice@example.com');"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_DSN", dsn)
+	o, err := New(
+		Book("testdata/book/db_snapshot_canceled.yml"),
+		Func("cancel", func() bool {
+			cancel()
+			return true
+		}),
+		AfterFunc(func(_ *RunResult) error {
+			// afterFuncs run after the deferred cleanup of the run.
+			var got string
+			if err := db.QueryRowContext(context.Background(), "SELECT group_concat(username) FROM users").Scan(&got); err != nil {
+				return err
+			}
+			if want := "alice"; got != want {
+				t.Errorf("got %q want %q", got, want)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = o.Run(ctx)
+}
+
+func TestDBRunnerCloseRestoresSnapshot(t *testing.T) {
+	ctx := context.Background()
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, dbFixtureSchema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO users (id, username, email) VALUES (1, 'alice', 'alice@example.com');"); err != nil {
+		t.Fatal(err)
+	}
+	o, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newDBRunner("db", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.setAutoSnapshot([]any{"users"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.run(ctx, &dbQuery{stmt: "DELETE FROM users;"}, newStep(0, "stepKey", o, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.snapshot != nil {
+		t.Error("the snapshot is left")
+	}
+	var got string
+	if err := db.QueryRowContext(ctx, "SELECT group_concat(username) FROM users").Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package runn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	dbTxBegin    = "begin"
+	dbTxCommit   = "commit"
+	dbTxRollback = "rollback"
+)
+
+// dbTxConfig is the options of the transaction across steps.
+type dbTxConfig struct {
+	IsolationLevel string `yaml:"isolationLevel,omitempty"`
+	ReadOnly       bool   `yaml:"readOnly,omitempty"`
+}
+
+// parseDBTxOptions parses the value of `transaction:` of the runner or `begin:` of the step.
+// The value is a bool or a map with `isolationLevel:` and `readOnly:`. It returns nil if the transaction is disabled.
+func parseDBTxOptions(v any) (*sql.TxOptions, error) {
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !vv {
+			return nil, nil
+		}
+		return &sql.TxOptions{}, nil
+	case *dbTxConfig:
+		return vv.txOptions()
+	case map[string]any:
+		c := &dbTxConfig{}
+		for k, vvv := range vv {
+			switch k {
+			case "isolationLevel":
+				l, ok := vvv.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid isolationLevel: %v", vvv)
+				}
+				c.IsolationLevel = l
+			case "readOnly":
+				ro, ok := vvv.(bool)
+				if !ok {
+					return nil, fmt.Errorf("invalid readOnly: %v", vvv)
+				}
+				c.ReadOnly = ro
+			default:
+				return nil, fmt.Errorf("invalid transaction option: %s", k)
+			}
+		}
+		return c.txOptions()
+	default:
+		return nil, fmt.Errorf("invalid transaction option: %v", v)
+	}
+}
+
+func (c *dbTxConfig) txOptions() (*sql.TxOptions, error) {
+	l, err := parseIsolationLevel(c.IsolationLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &sql.TxOptions{Isolation: l, ReadOnly: c.ReadOnly}, nil
+}
+
+// parseIsolationLevel parses the name of the isolation level (e.g. "read committed", "READ_COMMITTED" or "serializable").
+func parseIsolationLevel(s string) (sql.IsolationLevel, error) {
+	if s == "" {
+		return sql.LevelDefault, nil
+	}
+	name := strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(s))
+	for l := sql.LevelDefault; l <= sql.LevelLinearizable; l++ {
+		if strings.ToLower(l.String()) == name {
+			return l, nil
+		}
+	}
+	return sql.LevelDefault, fmt.Errorf("invalid isolation level: %s", s)
+}
+
+// runTxOp runs `begin:`, `commit:` or `rollback:` of the step.
+func (rnr *dbRunner) runTxOp(ctx context.Context, q *dbQuery, s *step) error {
+	o := s.parent
+	var err error
+	switch q.txOp {
+	case dbTxBegin:
+		err = rnr.begin(ctx, q.txOpts)
+	case dbTxCommit:
+		err = rnr.commit()
+	case dbTxRollback:
+		err = rnr.rollback()
+	default:
+		err = fmt.Errorf("invalid transaction operation: %s", q.txOp)
+	}
+	if err != nil {
+		return err
+	}
+	o.record(s.idx, map[string]any{})
+	return nil
+}
+
+// begin begins the transaction across steps.
+func (rnr *dbRunner) begin(ctx context.Context, opts *sql.TxOptions) error {
+	if rnr.tx != nil {
+		return errors.New("transaction has already begun")
+	}
+	if opts == nil {
+		opts = &sql.TxOptions{}
+	}
+	// The transaction is kept until the end of the runbook regardless of the context of the step
+	tx, err := rnr.client.BeginTx(context.WithoutCancel(ctx), opts)
+	if err != nil {
+		return err
+	}
+	rnr.tx = tx
+	return nil
+}
+
+func (rnr *dbRunner) commit() error {
+	if rnr.tx == nil {
+		return errors.New("transaction has not begun")
+	}
+	tx := rnr.tx
+	rnr.tx = nil
+	return tx.Commit()
+}
+
+func (rnr *dbRunner) rollback() error {
+	if rnr.tx == nil {
+		return errors.New("transaction has not begun")
+	}
+	tx := rnr.tx
+	rnr.tx = nil
+	return tx.Rollback()
+}
+
+// endTx rolls back the transaction left open at the end of the runbook.
+func (rnr *dbRunner) endTx() error {
+	if rnr.tx == nil {
+		return nil
+	}
+	if err := rnr.rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("failed to roll back the transaction of %s: %w", rnr.name, err)
+	}
+	return nil
+}
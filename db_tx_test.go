@@ -0,0 +1,189 @@
+package runn
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn/testutil"
+)
+
+func TestParseDBTxOptions(t *testing.T) {
+	tests := []struct {
+		v       any
+		want    *sql.TxOptions
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{false, nil, false},
+		{true, &sql.TxOptions{}, false},
+		{map[string]any{"isolationLevel": "read committed"}, &sql.TxOptions{Isolation: sql.LevelReadCommitted}, false},
+		{map[string]any{"isolationLevel": "REPEATABLE_READ", "readOnly": true}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, false},
+		{&dbTxConfig{IsolationLevel: "serializable"}, &sql.TxOptions{Isolation: sql.LevelSerializable}, false},
+		{map[string]any{"isolationLevel": "read"}, nil, true},
+		{map[string]any{"readOnly": "yes"}, nil, true},
+		{map[string]any{"level": "serializable"}, nil, true},
+		{"serializable", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDBTxOptions(tt.v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: got error %v", tt.v, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%v: %s", tt.v, diff)
+		}
+	}
+}
+
+func TestDBRunnerTransaction(t *testing.T) {
+	ctx, cancel := donegroup.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	_, dsn := testutil.SQLite(t)
+	o, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newDBRunner("db", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+	queries := []*dbQuery{
+		{stmt: "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL);"},
+		{txOp: dbTxBegin},
+		{stmt: "INSERT INTO users (username) VALUES ('alice');"},
+		{txOp: dbTxRollback},
+		{txOp: dbTxBegin},
+		{stmt: "INSERT INTO users (username) VALUES ('bob');"},
+		{txOp: dbTxCommit},
+		{stmt: "SELECT username FROM users;"},
+	}
+	for i, q := range queries {
+		if err := r.run(ctx, q, newStep(i, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]any{
+		"rows": []map[string]any{
+			{"username": "bob"},
+		},
+	}
+	if diff := cmp.Diff(want, o.store.Latest()); diff != "" {
+		t.Error(diff)
+	}
+	for _, op := range []string{dbTxCommit, dbTxRollback} {
+		if err := r.run(ctx, &dbQuery{txOp: op}, newStep(len(queries), "stepKey", o, nil)); err == nil {
+			t.Errorf("%s: want error", op)
+		}
+	}
+}
+
+func TestDBTransactionRolledBack(t *testing.T) {
+	tests := []struct {
+		book string
+	}{
+		{"testdata/book/db_transaction.yml"},
+		{"testdata/book/db_transaction_mode.yml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.book, func(t *testing.T) {
+			ctx := context.Background()
+			db, dsn := testutil.SQLite(t)
+			if _, err := db.ExecContext(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL);"); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("TEST_DB_DSN", dsn)
+			o, err := New(Book(tt.book))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := o.Run(ctx); err != nil {
+				t.Fatal(err)
+			}
+			var c int
+			if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = 'alice'").Scan(&c); err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if tt.book == "testdata/book/db_transaction_mode.yml" {
+				// Committed explicitly
+				want = 1
+			}
+			if c != want {
+				t.Errorf("got %d want %d", c, want)
+			}
+			if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = 'bob'").Scan(&c); err != nil {
+				t.Fatal(err)
+			}
+			if c != 0 {
+				t.Errorf("got %d want 0", c)
+			}
+		})
+	}
+}
+
+func TestDBTransactionRolledBackInIncludedRunbook(t *testing.T) {
+	ctx := context.Background()
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL);"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_DSN", dsn)
+	o, err := New(Book("testdata/book/db_transaction_include_main.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The INSERT of the parent runbook fails with 'database is locked' if the transaction of the included runbook is still open.
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var c int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = 'alice'").Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c != 0 {
+		t.Errorf("got %d want 0", c)
+	}
+}
+
+func TestDBTransactionRolledBackOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	db, dsn := testutil.SQLite(t)
+	if _, err := db.ExecContext(ctx, "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, username TEXT NOT NULL);"); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_DSN", dsn)
+	var o *operator
+	o, err := New(
+		Book("testdata/book/db_transaction_canceled.yml"),
+		Func("cancel", func() bool {
+			cancel()
+			return true
+		}),
+		AfterFunc(func(_ *RunResult) error {
+			// afterFuncs run after the deferred cleanup of the run.
+			if r := o.dbRunners["db"]; r.tx != nil {
+				t.Error("the transaction is left open")
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = o.Run(ctx)
+	var c int
+	if err := db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM users").Scan(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c != 0 {
+		t.Errorf("got %d want 0", c)
+	}
+}
@@ -46,6 +46,18 @@ func (d *debugger) CaptureHTTPResponse(name string, res *http.Response) {
 	_, _ = fmt.Fprintf(d.out, "-----START HTTP RESPONSE-----\n%s\n-----END HTTP RESPONSE-----\n", string(b))
 }
 
+func (d *debugger) CaptureHTTPEvent(name string, e *HTTPEvent) {
+	var lines []string
+	if e.ID != "" {
+		lines = append(lines, fmt.Sprintf("id: %s", e.ID))
+	}
+	if e.Event != "" {
+		lines = append(lines, fmt.Sprintf("event: %s", e.Event))
+	}
+	lines = append(lines, fmt.Sprintf("data: %s", e.Data))
+	_, _ = fmt.Fprintf(d.out, "-----START HTTP EVENT-----\n%s\n-----END HTTP EVENT-----\n", strings.Join(lines, "\n"))
+}
+
 func (d *debugger) CaptureGRPCStart(name string, typ GRPCType, service, method string) {
 	_, _ = fmt.Fprintf(d.out, ">>>>>START gRPC (%s/%s)>>>>>\n", service, method)
 }
@@ -110,8 +122,16 @@ func (d *debugger) CaptureSSHStderr(stderr string) {
 	_, _ = fmt.Fprintf(d.out, "-----START STDERR-----\n%s\n-----END STDERR-----\n", stderr)
 }
 
-func (d *debugger) CaptureDBStatement(name string, stmt string) {
+func (d *debugger) CaptureDBStatement(name string, stmt string, args []any) {
 	_, _ = fmt.Fprintf(d.out, "-----START QUERY-----\n%s\n-----END QUERY-----\n", stmt)
+	if len(args) == 0 {
+		return
+	}
+	_, _ = fmt.Fprint(d.out, "-----START QUERY ARGS-----\n")
+	for i, a := range args {
+		_, _ = fmt.Fprintf(d.out, "%d: %#v\n", i+1, a)
+	}
+	_, _ = fmt.Fprint(d.out, "-----END QUERY ARGS-----\n")
 }
 
 func (d *debugger) CaptureDBResponse(name string, res *DBResponse) {
@@ -0,0 +1,433 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/goccy/go-json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/maskedio"
+)
+
+type fixtureMode string
+
+const (
+	fixtureModeRecord fixtureMode = "record"
+	fixtureModeReplay fixtureMode = "replay"
+)
+
+const (
+	fixtureBodyEncodingBase64 = "base64"
+	// fixtureBodyEncodingSHA256 - The body streamed from files is recorded as the hex encoded SHA-256 hash of it instead of the content
+	fixtureBodyEncodingSHA256 = "sha256"
+)
+
+// fixtures records HTTP/gRPC traffic to the directory or replays it from the directory.
+// Fixtures are keyed by the runner name, the trail of the step and the fingerprint of the request.
+type fixtures struct {
+	mode fixtureMode
+	dir  string
+	// files - Fixture files recorded or loaded in this run
+	files map[string]*fixture
+	// used - Whether each exchange in the fixture files has already been replayed
+	used map[string][]bool
+	// calls - gRPC calls being replayed, keyed by the call ID
+	calls  map[string]*fixtureCall
+	callID uint64
+	mu     sync.Mutex
+}
+
+type fixture struct {
+	Runner string          `json:"runner"`
+	Trail  string          `json:"trail"`
+	HTTP   []*httpExchange `json:"http,omitempty"`
+	GRPC   []*grpcExchange `json:"grpc,omitempty"`
+}
+
+type httpExchange struct {
+	Fingerprint string               `json:"fingerprint"`
+	Request     *httpFixtureRequest  `json:"request"`
+	Response    *httpFixtureResponse `json:"response"`
+}
+
+type httpFixtureRequest struct {
+	Method       string      `json:"method"`
+	Path         string      `json:"path"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+type httpFixtureResponse struct {
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"bodyEncoding,omitempty"`
+}
+
+type fixtureCtxKey struct{}
+
+// fixtureCall is the call of the runner to be recorded or replayed.
+type fixtureCall struct {
+	runner string
+	trail  string
+	mr     *maskedio.Rule
+	// streamed - Whether the request body is streamed from files
+	streamed bool
+	// err - The error of the mismatched request reported by the replay handler or server
+	err error
+}
+
+func newFixtures(mode fixtureMode, dir string) (*fixtures, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("%s directory is required", mode)
+	}
+	switch mode {
+	case fixtureModeRecord:
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	case fixtureModeReplay:
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s is not directory", dir)
+		}
+	}
+	return &fixtures{
+		mode:  mode,
+		dir:   dir,
+		files: map[string]*fixture{},
+		used:  map[string][]bool{},
+		calls: map[string]*fixtureCall{},
+	}, nil
+}
+
+func (fx *fixtures) recording() bool {
+	return fx != nil && fx.mode == fixtureModeRecord
+}
+
+func (fx *fixtures) replaying() bool {
+	return fx != nil && fx.mode == fixtureModeReplay
+}
+
+// withFixtureCall returns the context with the call of the runner in the step.
+func withFixtureCall(ctx context.Context, runner string, s *step) (context.Context, *fixtureCall) {
+	c := &fixtureCall{
+		runner: runner,
+		trail:  fixtureTrail(s.trails()),
+		mr:     s.parent.maskRule,
+	}
+	return context.WithValue(ctx, fixtureCtxKey{}, c), c
+}
+
+func fixtureCallFromContext(ctx context.Context) (*fixtureCall, bool) {
+	c, ok := ctx.Value(fixtureCtxKey{}).(*fixtureCall)
+	return c, ok
+}
+
+// fixtureTrail returns the key of the step in the fixtures.
+func fixtureTrail(trs Trails) string {
+	var keys []string
+	for _, tr := range trs {
+		switch tr.Type {
+		case TrailTypeRunbook:
+			keys = append(keys, fmt.Sprintf("runbook[%s]", filepath.ToSlash(filepath.Clean(tr.RunbookPath))))
+		case TrailTypeStep, TrailTypeLoop:
+			keys = append(keys, tr.String())
+		}
+	}
+	return strings.Join(keys, ".")
+}
+
+// path returns the path of the fixture file of the runner in the step.
+func (fx *fixtures) path(runner, trail string) string {
+	sum := sha256.Sum256([]byte(trail))
+	return filepath.Join(fx.dir, runner, hex.EncodeToString(sum[:])[:16]+".json")
+}
+
+// load returns the fixture file of the runner in the step.
+func (fx *fixtures) load(runner, trail string) (*fixture, string, error) {
+	p := fx.path(runner, trail)
+	if f, ok := fx.files[p]; ok {
+		return f, p, nil
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, p, fmt.Errorf("no fixture of runner %q for %s: %s", runner, trail, p)
+		}
+		return nil, p, err
+	}
+	f := &fixture{}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, p, fmt.Errorf("invalid fixture %s: %w", p, err)
+	}
+	fx.files[p] = f
+	fx.used[p] = make([]bool, len(f.HTTP)+len(f.GRPC))
+	return f, p, nil
+}
+
+// save appends the exchange to the fixture file of the runner in the step and writes it.
+// The fixture file recorded in the previous run is overwritten.
+func (fx *fixtures) save(runner, trail string, fn func(f *fixture)) error {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	p := fx.path(runner, trail)
+	f, ok := fx.files[p]
+	if !ok {
+		f = &fixture{Runner: runner, Trail: trail}
+		fx.files[p] = f
+	}
+	fn(f)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o600)
+}
+
+// recordHTTP records the HTTP request and response.
+func (fx *fixtures) recordHTTP(c *fixtureCall, r *httpRequest, req *http.Request, reqBody []byte, res *http.Response, resBody []byte) error {
+	freq := newHTTPFixtureRequest(c, req.Method, r.path, req.Header, reqBody)
+	fres := &httpFixtureResponse{
+		Status:  res.StatusCode,
+		Headers: maskHeader(c.mr, res.Header),
+	}
+	// The recorded body is already decoded.
+	fres.Headers.Del("Content-Encoding")
+	fres.Headers.Del("Content-Length")
+	fres.Body, fres.BodyEncoding = encodeFixtureBody(c.mr, resBody)
+	return fx.save(c.runner, c.trail, func(f *fixture) {
+		f.HTTP = append(f.HTTP, &httpExchange{
+			Fingerprint: freq.fingerprint(),
+			Request:     freq,
+			Response:    fres,
+		})
+	})
+}
+
+// findHTTP returns the recorded exchange that matches the request.
+func (fx *fixtures) findHTTP(c *fixtureCall, freq *httpFixtureRequest) (*httpExchange, error) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	f, p, err := fx.load(c.runner, c.trail)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.HTTP) == 0 {
+		return nil, fmt.Errorf("no HTTP request is recorded for %s: %s", c.trail, p)
+	}
+	fp := freq.fingerprint()
+	var (
+		candidate *httpExchange
+		replayed  *httpExchange
+	)
+	for i, e := range f.HTTP {
+		if e.Fingerprint != fp {
+			if candidate == nil && !fx.used[p][i] {
+				candidate = e
+			}
+			continue
+		}
+		if fx.used[p][i] {
+			if replayed == nil {
+				replayed = e
+			}
+			continue
+		}
+		fx.used[p][i] = true
+		return e, nil
+	}
+	if replayed != nil {
+		// All the exchanges that match the request have already been replayed.
+		return replayed, nil
+	}
+	if candidate == nil {
+		candidate = f.HTTP[0]
+	}
+	want := *candidate.Request
+	got := *freq
+	// Headers are not used for matching.
+	want.Headers, got.Headers = nil, nil
+	return nil, fmt.Errorf("request does not match the fixture for %s (%s):\n%s", c.trail, p, cmp.Diff(want, got))
+}
+
+// newHTTPFixtureRequest returns the request to be recorded or matched.
+// If the body of the call is streamed from files, body is the hex encoded SHA-256 hash of it.
+func newHTTPFixtureRequest(c *fixtureCall, method, path string, h http.Header, body []byte) *httpFixtureRequest {
+	freq := &httpFixtureRequest{
+		Method:  method,
+		Path:    path,
+		Headers: maskHeader(c.mr, h),
+	}
+	if u, err := url.Parse(path); err == nil {
+		freq.Path = u.RequestURI()
+	}
+	if c.streamed {
+		freq.Body, freq.BodyEncoding = string(body), fixtureBodyEncodingSHA256
+		return freq
+	}
+	freq.Body, freq.BodyEncoding = encodeFixtureBody(c.mr, body)
+	return freq
+}
+
+func (r *httpFixtureRequest) fingerprint() string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s %s\n%s\n%s", r.Method, r.Path, r.BodyEncoding, r.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newHTTPReplayHandler returns the handler that serves the recorded responses of the runner.
+func (fx *fixtures) newHTTPReplayHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c, ok := fixtureCallFromContext(req.Context())
+		if !ok {
+			http.Error(w, "no fixture call", http.StatusInternalServerError)
+			return
+		}
+		var (
+			b   []byte
+			err error
+		)
+		if c.streamed {
+			b, err = hashFixtureBody(req.Body)
+		} else {
+			b, err = io.ReadAll(req.Body)
+		}
+		if err != nil {
+			c.err = err
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		e, err := fx.findHTTP(c, newHTTPFixtureRequest(c, req.Method, req.URL.RequestURI(), req.Header, b))
+		if err != nil {
+			c.err = err
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		body, err := decodeFixtureBody(e.Response.Body, e.Response.BodyEncoding)
+		if err != nil {
+			c.err = err
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for k, v := range e.Response.Headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(e.Response.Status)
+		_, _ = w.Write(body)
+	})
+}
+
+func encodeFixtureBody(mr *maskedio.Rule, b []byte) (string, string) {
+	if len(b) == 0 {
+		return "", ""
+	}
+	if !utf8.Valid(b) {
+		return base64.StdEncoding.EncodeToString(b), fixtureBodyEncodingBase64
+	}
+	return mask(mr, string(b)), ""
+}
+
+func decodeFixtureBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case fixtureBodyEncodingBase64:
+		return base64.StdEncoding.DecodeString(body)
+	default:
+		return nil, fmt.Errorf("invalid body encoding: %s", encoding)
+	}
+}
+
+func maskHeader(mr *maskedio.Rule, h http.Header) http.Header {
+	masked := http.Header{}
+	for k, v := range h {
+		for _, vv := range v {
+			masked.Add(k, mask(mr, vv))
+		}
+	}
+	return masked
+}
+
+// maskValues masks the strings in the value decoded from JSON.
+func maskValues(mr *maskedio.Rule, v any) any {
+	switch vv := v.(type) {
+	case string:
+		return mask(mr, vv)
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, vvv := range vv {
+			m[k] = maskValues(mr, vvv)
+		}
+		return m
+	case []any:
+		s := make([]any, len(vv))
+		for i, vvv := range vv {
+			s[i] = maskValues(mr, vvv)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+func mask(mr *maskedio.Rule, s string) string {
+	if mr == nil {
+		return s
+	}
+	return mr.Mask(s)
+}
+
+// readFixtureRequestBody reads the request body to be recorded.
+// The body streamed from files is not read into memory; the files are read again to hash them instead.
+func readFixtureRequestBody(body io.Reader) (io.Reader, []byte, error) {
+	if body == nil {
+		return nil, nil, nil
+	}
+	if sb, ok := body.(*sizedBody); ok {
+		rb, err := openSizedBody(sb.parts)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer rb.Close()
+		sum, err := hashFixtureBody(rb)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, sum, nil
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(b), b, nil
+}
+
+// hashFixtureBody returns the hex encoded SHA-256 hash of the body streamed from files.
+func hashFixtureBody(body io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return nil, err
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil))), nil
+}
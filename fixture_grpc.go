@@ -0,0 +1,548 @@
+package runn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-json"
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/maskedio"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	grpcFixtureEventSend = "send"
+	grpcFixtureEventRecv = "recv"
+
+	// grpcFixtureCallIDKey - The metadata key to pass the ID of the call to the replay server.
+	grpcFixtureCallIDKey = "x-runn-fixture-call-id"
+
+	grpcFixtureDescriptorsFile = "descriptors.binpb"
+)
+
+type grpcExchange struct {
+	Fingerprint      string              `json:"fingerprint"`
+	Method           string              `json:"method"`
+	Headers          map[string][]string `json:"headers,omitempty"`
+	Events           []*grpcFixtureEvent `json:"events"`
+	ResponseHeaders  map[string][]string `json:"responseHeaders,omitempty"`
+	ResponseTrailers map[string][]string `json:"responseTrailers,omitempty"`
+	Status           *grpcFixtureStatus  `json:"status"`
+}
+
+// grpcFixtureEvent is the message sent (send) or received (recv) by the client in order.
+type grpcFixtureEvent struct {
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message"`
+}
+
+type grpcFixtureStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type grpcReplayServer struct {
+	server *grpc.Server
+	addr   string
+	files  *protoregistry.Files
+}
+
+// grpcRecorder records the exchange of the gRPC call.
+type grpcRecorder struct {
+	fx   *fixtures
+	c    *fixtureCall
+	e    *grpcExchange
+	once sync.Once
+	mu   sync.Mutex
+}
+
+type recordClientStream struct {
+	grpc.ClientStream
+	rec           *grpcRecorder
+	serverStreams bool
+}
+
+type replayClientStream struct {
+	grpc.ClientStream
+	fx *fixtures
+	c  *fixtureCall
+	id string
+}
+
+// grpcDialOptions returns the interceptors to record or replay gRPC calls.
+func (fx *fixtures) grpcDialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(fx.unaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(fx.streamClientInterceptor()),
+	}
+}
+
+func (fx *fixtures) unaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		c, ok := fixtureCallFromContext(ctx)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if fx.replaying() {
+			ctx, id := fx.registerCall(ctx, c)
+			defer fx.unregisterCall(id)
+			return fx.replayErr(c, invoker(ctx, method, req, reply, cc, opts...))
+		}
+		var h, t metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&h), grpc.Trailer(&t))...)
+		rec := fx.newGRPCRecorder(ctx, c, method)
+		if err := rec.add(grpcFixtureEventSend, req); err != nil {
+			return err
+		}
+		if err == nil {
+			if err := rec.add(grpcFixtureEventRecv, reply); err != nil {
+				return err
+			}
+		}
+		if err := rec.finish(h, t, err); err != nil {
+			return err
+		}
+		return err
+	}
+}
+
+func (fx *fixtures) streamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		c, ok := fixtureCallFromContext(ctx)
+		if !ok {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		if fx.replaying() {
+			ctx, id := fx.registerCall(ctx, c)
+			cs, err := streamer(ctx, desc, cc, method, opts...)
+			if err != nil {
+				fx.unregisterCall(id)
+				return nil, fx.replayErr(c, err)
+			}
+			return &replayClientStream{ClientStream: cs, fx: fx, c: c, id: id}, nil
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &recordClientStream{
+			ClientStream:  cs,
+			rec:           fx.newGRPCRecorder(ctx, c, method),
+			serverStreams: desc.ServerStreams,
+		}, nil
+	}
+}
+
+func (s *recordClientStream) SendMsg(m any) error {
+	if err := s.ClientStream.SendMsg(m); err != nil {
+		return err
+	}
+	return s.rec.add(grpcFixtureEventSend, m)
+}
+
+func (s *recordClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		if err := s.rec.add(grpcFixtureEventRecv, m); err != nil {
+			return err
+		}
+		if s.serverStreams {
+			return nil
+		}
+		// The response of the client streaming RPC is the last message.
+	}
+	h, _ := s.Header()
+	rerr := err
+	if errors.Is(rerr, io.EOF) {
+		rerr = nil
+	}
+	if ferr := s.rec.finish(h, s.Trailer(), rerr); ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+func (s *replayClientStream) SendMsg(m any) error {
+	return s.fx.replayErr(s.c, s.ClientStream.SendMsg(m))
+}
+
+func (s *replayClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		// The call is finished.
+		s.fx.unregisterCall(s.id)
+	}
+	return s.fx.replayErr(s.c, err)
+}
+
+func (fx *fixtures) newGRPCRecorder(ctx context.Context, c *fixtureCall, method string) *grpcRecorder {
+	h, _ := metadata.FromOutgoingContext(ctx)
+	return &grpcRecorder{
+		fx: fx,
+		c:  c,
+		e: &grpcExchange{
+			Method:  method,
+			Headers: maskMetadata(c.mr, h),
+		},
+	}
+}
+
+func (rec *grpcRecorder) add(typ string, m any) error {
+	b, _, err := marshalFixtureMessage(rec.c.mr, m)
+	if err != nil {
+		return err
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.e.Events = append(rec.e.Events, &grpcFixtureEvent{Type: typ, Message: b})
+	return nil
+}
+
+// finish saves the exchange once.
+func (rec *grpcRecorder) finish(h, t metadata.MD, err error) error {
+	var serr error
+	rec.once.Do(func() {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		stat := status.Convert(err)
+		rec.e.Status = &grpcFixtureStatus{Code: int(stat.Code()), Message: mask(rec.c.mr, stat.Message())}
+		rec.e.ResponseHeaders = maskMetadata(rec.c.mr, h)
+		rec.e.ResponseTrailers = maskMetadata(rec.c.mr, t)
+		rec.e.Fingerprint = grpcFingerprint(rec.e.Method, rec.e.firstSend())
+		serr = rec.fx.save(rec.c.runner, rec.c.trail, func(f *fixture) {
+			f.GRPC = append(f.GRPC, rec.e)
+		})
+	})
+	return serr
+}
+
+// firstSend returns the first message sent by the client if the client sends first.
+func (e *grpcExchange) firstSend() json.RawMessage {
+	if len(e.Events) == 0 || e.Events[0].Type != grpcFixtureEventSend {
+		return nil
+	}
+	return e.Events[0].Message
+}
+
+func grpcFingerprint(method string, first json.RawMessage) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s", method, first)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// marshalFixtureMessage marshals the protocol buffers message to JSON with secrets masked.
+func marshalFixtureMessage(mr *maskedio.Rule, m any) (json.RawMessage, any, error) {
+	pm, ok := m.(proto.Message)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid message: %T", m)
+	}
+	b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(pm)
+	if err != nil {
+		return nil, nil, err
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, nil, err
+	}
+	v = maskValues(mr, v)
+	b, err = json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, v, nil
+}
+
+func maskMetadata(mr *maskedio.Rule, md metadata.MD) map[string][]string {
+	if len(md) == 0 {
+		return nil
+	}
+	masked := map[string][]string{}
+	for k, v := range md {
+		if k == grpcFixtureCallIDKey {
+			continue
+		}
+		for _, vv := range v {
+			masked[k] = append(masked[k], mask(mr, vv))
+		}
+	}
+	return masked
+}
+
+// saveDescriptors saves the descriptors of the methods of the runner to replay them.
+func (fx *fixtures) saveDescriptors(runner string, mds map[string]protoreflect.MethodDescriptor) error {
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]struct{}{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if _, ok := seen[fd.Path()]; ok {
+			return
+		}
+		seen[fd.Path()] = struct{}{}
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		fds.File = append(fds.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, md := range mds {
+		add(md.ParentFile())
+	}
+	b, err := proto.Marshal(fds)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(fx.dir, runner, grpcFixtureDescriptorsFile)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0o600)
+}
+
+// startGRPCReplayServer starts the local gRPC server that serves the recorded responses of the runner.
+func (fx *fixtures) startGRPCReplayServer(runner string) (*grpcReplayServer, error) {
+	p := filepath.Join(fx.dir, runner, grpcFixtureDescriptorsFile)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("no descriptors of runner %q: %w", runner, err)
+	}
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(b, fds); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, err
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := &grpcReplayServer{
+		server: grpc.NewServer(grpc.UnknownServiceHandler(fx.grpcReplayHandler(runner, files))),
+		addr:   lis.Addr().String(),
+		files:  files,
+	}
+	go func() {
+		_ = srv.server.Serve(lis)
+	}()
+	return srv, nil
+}
+
+// methods returns the methods of the recorded descriptors.
+func (srv *grpcReplayServer) methods() map[string]protoreflect.MethodDescriptor {
+	mds := map[string]protoreflect.MethodDescriptor{}
+	srv.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := range fd.Services().Len() {
+			svc := fd.Services().Get(i)
+			for j := range svc.Methods().Len() {
+				m := svc.Methods().Get(j)
+				mds[strings.Join([]string{string(svc.FullName()), string(m.Name())}, "/")] = m
+			}
+		}
+		return true
+	})
+	return mds
+}
+
+func (srv *grpcReplayServer) stop() {
+	srv.server.Stop()
+}
+
+// registerCall registers the call to be looked up by the replay server.
+// The call should be unregistered with unregisterCall when it is finished.
+func (fx *fixtures) registerCall(ctx context.Context, c *fixtureCall) (context.Context, string) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	fx.callID++
+	id := strconv.FormatUint(fx.callID, 10)
+	fx.calls[id] = c
+	return metadata.AppendToOutgoingContext(ctx, grpcFixtureCallIDKey, id), id
+}
+
+func (fx *fixtures) unregisterCall(id string) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	delete(fx.calls, id)
+}
+
+func (fx *fixtures) lookupCall(ctx context.Context) (*fixtureCall, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(grpcFixtureCallIDKey)
+	if len(ids) == 0 {
+		return nil, false
+	}
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	c, ok := fx.calls[ids[0]]
+	return c, ok
+}
+
+// replayErr returns the error of the mismatched request reported by the replay server instead of err.
+func (fx *fixtures) replayErr(c *fixtureCall, err error) error {
+	if err == nil {
+		return nil
+	}
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+func (fx *fixtures) setCallErr(c *fixtureCall, err error) error {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	c.err = err
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+func (fx *fixtures) grpcReplayHandler(runner string, files *protoregistry.Files) grpc.StreamHandler {
+	return func(_ any, stream grpc.ServerStream) error {
+		ctx := stream.Context()
+		c, ok := fx.lookupCall(ctx)
+		if !ok {
+			return status.Error(codes.Internal, "unknown call")
+		}
+		method, ok := grpc.MethodFromServerStream(stream)
+		if !ok {
+			return status.Error(codes.Internal, "unknown method")
+		}
+		d, err := files.FindDescriptorByName(protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", ".")))
+		if err != nil {
+			return fx.setCallErr(c, fmt.Errorf("method %s is not recorded in the descriptors of runner %q: %w", method, runner, err))
+		}
+		md, ok := d.(protoreflect.MethodDescriptor)
+		if !ok {
+			return fx.setCallErr(c, fmt.Errorf("invalid method: %s", method))
+		}
+		e, events, err := fx.findGRPC(c, method, func() (json.RawMessage, error) {
+			in := dynamicpb.NewMessage(md.Input())
+			if err := stream.RecvMsg(in); err != nil {
+				return nil, err
+			}
+			b, _, err := marshalFixtureMessage(c.mr, in)
+			return b, err
+		})
+		if err != nil {
+			return fx.setCallErr(c, err)
+		}
+		if err := stream.SetHeader(toReplayMetadata(e.ResponseHeaders)); err != nil {
+			return err
+		}
+		for _, ev := range events {
+			switch ev.Type {
+			case grpcFixtureEventSend:
+				in := dynamicpb.NewMessage(md.Input())
+				if err := stream.RecvMsg(in); err != nil {
+					return fx.setCallErr(c, fmt.Errorf("failed to receive the message recorded for %s: %w", c.trail, err))
+				}
+				_, got, err := marshalFixtureMessage(c.mr, in)
+				if err != nil {
+					return fx.setCallErr(c, err)
+				}
+				var want any
+				if err := json.Unmarshal(ev.Message, &want); err != nil {
+					return fx.setCallErr(c, err)
+				}
+				if diff := cmp.Diff(want, got); diff != "" {
+					return fx.setCallErr(c, fmt.Errorf("message does not match the fixture for %s (%s):\n%s", c.trail, method, diff))
+				}
+			case grpcFixtureEventRecv:
+				out := dynamicpb.NewMessage(md.Output())
+				if err := protojson.Unmarshal(ev.Message, out); err != nil {
+					return fx.setCallErr(c, err)
+				}
+				if err := stream.SendMsg(out); err != nil {
+					return err
+				}
+			}
+		}
+		stream.SetTrailer(toReplayMetadata(e.ResponseTrailers))
+		if e.Status == nil || codes.Code(e.Status.Code) == codes.OK { //nolint:gosec
+			return nil
+		}
+		return status.Error(codes.Code(e.Status.Code), e.Status.Message) //nolint:gosec
+	}
+}
+
+// findGRPC returns the recorded exchange that matches the call and the events to be replayed.
+// recvFirst receives the first message from the client if the recorded client sends first.
+func (fx *fixtures) findGRPC(c *fixtureCall, method string, recvFirst func() (json.RawMessage, error)) (*grpcExchange, []*grpcFixtureEvent, error) {
+	fx.mu.Lock()
+	f, p, err := fx.load(c.runner, c.trail)
+	if err != nil {
+		fx.mu.Unlock()
+		return nil, nil, err
+	}
+	var (
+		candidate *grpcExchange
+		offset    = len(f.HTTP)
+	)
+	for i, e := range f.GRPC {
+		if e.Method == method && !fx.used[p][offset+i] {
+			candidate = e
+			break
+		}
+	}
+	fx.mu.Unlock()
+	if candidate == nil {
+		return nil, nil, fmt.Errorf("no gRPC call of %s is recorded for %s: %s", method, c.trail, p)
+	}
+	var first json.RawMessage
+	if candidate.firstSend() != nil {
+		first, err = recvFirst()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	fp := grpcFingerprint(method, first)
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	for i, e := range f.GRPC {
+		if e.Method != method || e.Fingerprint != fp || fx.used[p][offset+i] {
+			continue
+		}
+		fx.used[p][offset+i] = true
+		if first != nil {
+			return e, e.Events[1:], nil
+		}
+		return e, e.Events, nil
+	}
+	var want, got any
+	_ = json.Unmarshal(candidate.firstSend(), &want)
+	_ = json.Unmarshal(first, &got)
+	return nil, nil, fmt.Errorf("request does not match the fixture for %s (%s %s):\n%s", c.trail, method, p, cmp.Diff(want, got))
+}
+
+// toReplayMetadata returns the recorded metadata without the keys reserved by gRPC.
+func toReplayMetadata(m map[string][]string) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range m {
+		if k == "content-type" || strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") {
+			continue
+		}
+		md[k] = v
+	}
+	return md
+}
@@ -0,0 +1,297 @@
+package runn
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/httpstub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func TestFixturesHTTP(t *testing.T) {
+	const token = "s3cr3t-token"
+	dir := t.TempDir()
+	ts := httpstub.NewServer(t)
+	t.Cleanup(func() {
+		ts.Close()
+	})
+	ts.Method(http.MethodPost).Path("/users").Header("Content-Type", "application/json").ResponseString(http.StatusCreated, `{"name":"alice"}`)
+	t.Setenv("TEST_TOKEN", token)
+	t.Setenv("TEST_NAME", "alice")
+
+	t.Run("record", func(t *testing.T) {
+		t.Setenv("TEST_HTTP_ENDPOINT", ts.Server().URL)
+		o, err := New(Book("testdata/book/fixture_http.yml"), Record(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "req", "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Fatalf("got %v", files)
+		}
+		b, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), token) {
+			t.Errorf("secret is not masked: %s", b)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		// The endpoint is not used in replay mode.
+		t.Setenv("TEST_HTTP_ENDPOINT", "http://127.0.0.1:1")
+		o, err := New(Book("testdata/book/fixture_http.yml"), Replay(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if want := 1; len(ts.Requests()) != want {
+			t.Errorf("got %v want %v", len(ts.Requests()), want)
+		}
+	})
+
+	t.Run("replay mismatched request", func(t *testing.T) {
+		t.Setenv("TEST_HTTP_ENDPOINT", "http://127.0.0.1:1")
+		t.Setenv("TEST_NAME", "bob")
+		o, err := New(Book("testdata/book/fixture_http.yml"), Replay(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = o.Run(context.Background())
+		if err == nil {
+			t.Fatal("want error")
+		}
+		if !strings.Contains(err.Error(), "request does not match the fixture") || !strings.Contains(err.Error(), "bob") {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestFixturesHTTPStreamedBody(t *testing.T) {
+	dir := t.TempDir()
+	ts := httpstub.NewServer(t)
+	t.Cleanup(func() {
+		ts.Close()
+	})
+	ts.Method(http.MethodPut).Path("/upload").ResponseString(http.StatusOK, `{"ok":true}`)
+	dummy, err := os.ReadFile("testdata/dummy.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(dummy)
+	ctx := context.Background()
+	run := func(t *testing.T, opts ...Option) error {
+		t.Helper()
+		o, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &httpRequest{
+			path:      "/upload",
+			method:    http.MethodPut,
+			mediaType: "application/octet-stream",
+			body:      map[string]any{"filename": "testdata/dummy.png"},
+		}
+		return o.httpRunners["req"].run(ctx, req, newStep(0, "stepKey", o, nil))
+	}
+
+	t.Run("record", func(t *testing.T) {
+		if err := run(t, HTTPRunner("req", ts.Server().URL, ts.Server().Client()), Record(dir)); err != nil {
+			t.Fatal(err)
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "req", "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 1 {
+			t.Fatalf("got %v", files)
+		}
+		b, err := os.ReadFile(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The body streamed from the file is recorded as the hash of it.
+		if !strings.Contains(string(b), hex.EncodeToString(sum[:])) || !strings.Contains(string(b), `"bodyEncoding": "sha256"`) {
+			t.Errorf("got %s", b)
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		if err := run(t, HTTPRunner("req", "http://127.0.0.1:1", nil), Replay(dir)); err != nil {
+			t.Fatal(err)
+		}
+		if want := 1; len(ts.Requests()) != want {
+			t.Errorf("got %v want %v", len(ts.Requests()), want)
+		}
+	})
+}
+
+func TestFixturesHTTPSaveTo(t *testing.T) {
+	dir := t.TempDir()
+	ts := httpstub.NewServer(t)
+	t.Cleanup(func() {
+		ts.Close()
+	})
+	dummy, err := os.ReadFile("testdata/dummy.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Method(http.MethodGet).Path("/artifact").Header("Content-Type", "application/octet-stream").ResponseString(http.StatusOK, string(dummy))
+	sum := sha256.Sum256(dummy)
+	// saveTo is resolved against the working directory
+	t.Chdir(t.TempDir())
+	ctx := context.Background()
+	run := func(t *testing.T, saveTo string, opts ...Option) {
+		t.Helper()
+		o, err := New(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := &httpRequest{
+			path:   "/artifact",
+			method: http.MethodGet,
+			saveTo: saveTo,
+		}
+		if err := o.httpRunners["req"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(saveTo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(dummy, got); diff != "" {
+			t.Error(diff)
+		}
+		f := o.store.Latest()["res"].(map[string]any)["file"].(map[string]any)
+		if f["size"] != int64(len(dummy)) {
+			t.Errorf("got %v want %v", f["size"], len(dummy))
+		}
+		if f["sha256"] != hex.EncodeToString(sum[:]) {
+			t.Errorf("got %v", f["sha256"])
+		}
+	}
+
+	t.Run("record", func(t *testing.T) {
+		run(t, "recorded.png", HTTPRunner("req", ts.Server().URL, ts.Server().Client()), Record(dir))
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		run(t, "replayed.png", HTTPRunner("req", "http://127.0.0.1:1", nil), Replay(dir))
+		if want := 1; len(ts.Requests()) != want {
+			t.Errorf("got %v want %v", len(ts.Requests()), want)
+		}
+	})
+}
+
+func TestFixturesFindHTTP(t *testing.T) {
+	fx, err := newFixtures(fixtureModeReplay, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &fixtureCall{runner: "req", trail: "trail"}
+	freq := newHTTPFixtureRequest(c, http.MethodGet, "/users", nil, nil)
+	other := newHTTPFixtureRequest(c, http.MethodGet, "/other", nil, nil)
+	p := fx.path(c.runner, c.trail)
+	fx.files[p] = &fixture{HTTP: []*httpExchange{
+		{Fingerprint: freq.fingerprint(), Request: freq, Response: &httpFixtureResponse{Status: http.StatusOK, Body: "first"}},
+		{Fingerprint: other.fingerprint(), Request: other, Response: &httpFixtureResponse{Status: http.StatusOK, Body: "other"}},
+		{Fingerprint: freq.fingerprint(), Request: freq, Response: &httpFixtureResponse{Status: http.StatusOK, Body: "second"}},
+	}}
+	fx.used[p] = make([]bool, 3)
+	// The exchanges are replayed in the recorded order, and the first one is replayed again after all of them are replayed.
+	for _, want := range []string{"first", "second", "first"} {
+		e, err := fx.findHTTP(c, freq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Response.Body != want {
+			t.Errorf("got %v want %v", e.Response.Body, want)
+		}
+	}
+}
+
+func TestFixturesGRPC(t *testing.T) {
+	dir := t.TempDir()
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("runn", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	run := func(t *testing.T, target, service string, opt Option) (map[string]any, error) {
+		t.Helper()
+		ctx, cancel := donegroup.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		o, err := New(GrpcRunnerWithOptions("greq", target), GRPCNoTLS(true), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			o.Close(true)
+		})
+		req := &grpcRequest{
+			service:  "grpc.health.v1.Health",
+			method:   "Check",
+			messages: []*grpcMessage{{op: GRPCOpMessage, params: map[string]any{"service": service}}},
+		}
+		if err := o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+			return nil, err
+		}
+		if fx := o.grpcRunners["greq"].fixtures; len(fx.calls) != 0 {
+			t.Errorf("calls are not unregistered: %v", fx.calls)
+		}
+		return o.store.Latest()["res"].(map[string]any), nil
+	}
+
+	recorded, err := run(t, l.Addr().String(), "runn", Record(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "greq", grpcFixtureDescriptorsFile)); err != nil {
+		t.Fatal(err)
+	}
+	if recorded["message"] == nil {
+		t.Fatalf("got %v", recorded)
+	}
+	srv.Stop()
+
+	// The target is not used in replay mode.
+	replayed, err := run(t, "127.0.0.1:1", "runn", Replay(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(recorded["message"], replayed["message"]); diff != "" {
+		t.Error(diff)
+	}
+
+	if _, err := run(t, "127.0.0.1:1", "other", Replay(dir)); err == nil || !strings.Contains(err.Error(), "request does not match the fixture") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"slices"
 	"strings"
@@ -14,14 +16,15 @@ import (
 	"time"
 
 	"github.com/bufbuild/protocompile"
-	"github.com/bufbuild/protocompile/linker"
 	"github.com/goccy/go-json"
 	"github.com/jhump/protoreflect/v2/grpcreflect"
 	"github.com/k1LoW/bufresolv"
 	"github.com/k1LoW/donegroup"
 	"github.com/k1LoW/protoresolv"
+	"github.com/k1LoW/runn/internal/expr"
 	"github.com/k1LoW/runn/internal/fs"
 	"github.com/k1LoW/runn/internal/sliceutil"
+	"github.com/k1LoW/runn/internal/store"
 	"github.com/k1LoW/runn/version"
 	"github.com/mitchellh/copystructure"
 	"google.golang.org/grpc"
@@ -32,11 +35,15 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
+var errGRPCReceiveTimeout = errors.New("receive timed out")
+
 type GRPCType string
 
 const (
@@ -61,6 +68,7 @@ const (
 	grpcStoreMessageKey  = "message"
 	grpcStoreMessagesKey = "messages"
 	grpcStoreResponseKey = "res"
+	grpcStoreRequestKey  = "req"
 )
 
 type grpcRunner struct {
@@ -73,6 +81,7 @@ type grpcRunner struct {
 	skipVerify      bool
 	importPaths     []string
 	protos          []string
+	protosets       []string
 	bufDirs         []string
 	bufLocks        []string
 	bufConfigs      []string
@@ -83,6 +92,17 @@ type grpcRunner struct {
 	hostRules       hostRules
 	trace           *bool
 	traceHeaderName string
+	traceFormat     string
+	auth            *authenticator
+	proxy           *url.URL
+	socket          string
+	protocol        string
+	codec           string
+	storeRequest    bool
+	httpClient      *http.Client
+	clientOpts      *grpcClientOptions
+	fixtures        *fixtures
+	replayServer    *grpcReplayServer
 	mu              sync.Mutex
 	// operatorID - The id of the operator for which the runner is defined.
 	operatorID string
@@ -93,6 +113,10 @@ type grpcRunner struct {
 type grpcMessage struct {
 	op     GRPCOp
 	params map[string]any
+	// until - The condition to stop receiving messages (receive op only)
+	until string
+	// timeout - The timeout to receive messages (receive op only)
+	timeout time.Duration
 }
 
 type grpcRequest struct {
@@ -102,7 +126,13 @@ type grpcRequest struct {
 	messages []*grpcMessage
 	timeout  time.Duration
 	trace    *bool
-	mu       sync.Mutex
+	// health - Whether the request is the `health:` step
+	health bool
+	// sent - The messages sent with default values to be stored (storeRequest only)
+	sent []map[string]any
+	// authorized - Whether the authorization metadata is set by the auth of the runner
+	authorized bool
+	mu         sync.Mutex
 }
 
 func newGrpcRunner(name, target string) (*grpcRunner, error) {
@@ -125,6 +155,14 @@ func (rnr *grpcRunner) Renew() error {
 }
 
 func (rnr *grpcRunner) Close() error {
+	if rnr.replayServer != nil {
+		rnr.replayServer.stop()
+		rnr.replayServer = nil
+	}
+	if rnr.httpClient != nil {
+		rnr.httpClient.CloseIdleConnections()
+		rnr.httpClient = nil
+	}
 	if rnr.cc == nil {
 		rnr.refc = nil
 		return nil
@@ -149,14 +187,31 @@ func (rnr *grpcRunner) Run(ctx context.Context, s *step) error {
 
 func (rnr *grpcRunner) run(ctx context.Context, r *grpcRequest, s *step) error {
 	o := s.parent
-	if err := rnr.connectAndResolve(setHeaders(ctx, r.headers), o); err != nil {
+	if r.health && rnr.fixtures == nil {
+		// Health checking does not require the reflection service of the server
+		if _, err := rnr.connect(ctx, o); err != nil {
+			return err
+		}
+	} else if err := rnr.connectAndResolve(setHeaders(ctx, r.headers), o); err != nil {
 		return err
 	}
 	key := strings.Join([]string{r.service, r.method}, "/")
 	md, ok := rnr.mds[key]
+	if !ok && r.health {
+		md, ok = healthCheckMethodDescriptor(), true
+	}
 	if !ok {
 		return fmt.Errorf("cannot find method: %s", key)
 	}
+	// Validate the messages before calling the method. The values not expanded yet are validated just before sending.
+	for _, m := range r.messages {
+		if m.op != GRPCOpMessage {
+			continue
+		}
+		if err := validateMessage(md.Input(), m.params, false); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
 	// Override trace
 	rnr.mu.Lock()
 	r.mu.Lock()
@@ -168,9 +223,21 @@ func (rnr *grpcRunner) run(ctx context.Context, r *grpcRequest, s *step) error {
 	}
 	r.mu.Unlock()
 	rnr.mu.Unlock()
-	if err := r.setTraceHeader(s); err != nil {
+	if err := r.setTraceHeader(ctx, s); err != nil {
+		return err
+	}
+	if err := rnr.authorize(ctx, r, o); err != nil {
 		return err
 	}
+	injectTraceContext(ctx, metadataCarrier(r.headers))
+	if rnr.fixtures != nil {
+		ctx, _ = withFixtureCall(ctx, rnr.name, s)
+	}
+	if rnr.overHTTP() {
+		o.capturers.captureGRPCStart(rnr.name, grpcType(md), r.service, r.method)
+		defer o.capturers.captureGRPCEnd(rnr.name, grpcType(md), r.service, r.method)
+		return rnr.invokeOverHTTP(ctx, md, r, s)
+	}
 	switch {
 	case !md.IsStreamingServer() && !md.IsStreamingClient():
 		o.capturers.captureGRPCStart(rnr.name, GRPCUnary, r.service, r.method)
@@ -194,70 +261,17 @@ func (rnr *grpcRunner) run(ctx context.Context, r *grpcRequest, s *step) error {
 }
 
 func (rnr *grpcRunner) connectAndResolve(ctx context.Context, o *operator) error {
-	if rnr.cc == nil {
-		opts := []grpc.DialOption{
-			grpc.WithUserAgent(fmt.Sprintf("runn/%s", version.Version)),
-		}
-		if len(rnr.hostRules) > 0 {
-			opts = append(opts, grpc.WithContextDialer(rnr.hostRules.contextDialerFunc()))
-		}
-		useTLS := true
-		if strings.HasSuffix(rnr.target, ":80") {
-			useTLS = false
-		}
-		if rnr.tls != nil {
-			useTLS = *rnr.tls
-		}
-		if useTLS {
-			tlsc := tls.Config{MinVersion: tls.VersionTLS12}
-			if len(rnr.cert) != 0 {
-				certificate, err := tls.X509KeyPair(rnr.cert, rnr.key)
-				if err != nil {
-					return err
-				}
-				tlsc.Certificates = []tls.Certificate{certificate}
-			}
-			if rnr.skipVerify {
-				//#nosec G402
-				tlsc.InsecureSkipVerify = true
-			} else if len(rnr.cacert) != 0 {
-				certpool, err := x509.SystemCertPool()
-				if err != nil {
-					// FIXME for Windows
-					// ref: https://github.com/golang/go/issues/18609
-					certpool = x509.NewCertPool()
-				}
-				if ok := certpool.AppendCertsFromPEM(rnr.cacert); !ok {
-					return errors.New("failed to append cacert")
-				}
-				tlsc.RootCAs = certpool
-			}
-			opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tlsc)))
-		} else {
-			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-		}
-		target := rnr.target
-		if strings.Count(target, ":") < 2 {
-			target = fmt.Sprintf("passthrough:%s", target)
-		}
-		cc, err := grpc.NewClient(target, opts...)
-		if err != nil {
+	if rnr.cc == nil && rnr.fixtures.replaying() {
+		if err := rnr.connectReplayServer(); err != nil {
 			return err
 		}
-		rnr.cc = cc
-		if rnr.target != "" && !rnr.reusable {
-			if err := donegroup.Cleanup(ctx, func() error {
-				// In the case of Reused runners, leave the cleanup to the main cleanup
-				if o.id != rnr.operatorID {
-					return nil
-				}
-				return rnr.Renew()
-			}); err != nil {
-				return err
-			}
-		}
+		return nil
+	}
+	connected, err := rnr.connect(ctx, o)
+	if err != nil {
+		return err
 	}
-	if len(rnr.importPaths) > 0 || len(rnr.protos) > 0 || len(rnr.bufDirs) > 0 || len(rnr.bufLocks) > 0 || len(rnr.bufConfigs) > 0 || len(rnr.bufModules) > 0 {
+	if len(rnr.importPaths) > 0 || len(rnr.protos) > 0 || len(rnr.protosets) > 0 || len(rnr.bufDirs) > 0 || len(rnr.bufLocks) > 0 || len(rnr.bufConfigs) > 0 || len(rnr.bufModules) > 0 {
 		if err := rnr.resolveAllMethodsUsingProtos(ctx); err != nil {
 			return err
 		}
@@ -271,6 +285,129 @@ func (rnr *grpcRunner) connectAndResolve(ctx context.Context, o *operator) error
 			return err
 		}
 	}
+	if connected && rnr.fixtures.recording() {
+		if err := rnr.fixtures.saveDescriptors(rnr.name, rnr.mds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connect connects to the target if not connected. It returns true if newly connected.
+func (rnr *grpcRunner) connect(ctx context.Context, o *operator) (bool, error) {
+	if rnr.cc != nil {
+		return false, nil
+	}
+	opts := []grpc.DialOption{
+		grpc.WithUserAgent(fmt.Sprintf("runn/%s", version.Version)),
+	}
+	if rnr.fixtures != nil {
+		opts = append(opts, rnr.fixtures.grpcDialOptions()...)
+	}
+	if co := rnr.clientOpts.String(); co != "" {
+		o.Debugf("gRPC client options of %s: %s\n", rnr.name, co)
+	}
+	opts = append(opts, rnr.clientOpts.dialOptions()...)
+	dialer, err := rnr.contextDialerFunc()
+	if err != nil {
+		return false, err
+	}
+	if dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(dialer))
+	}
+	tlsc, err := rnr.tlsConfig()
+	if err != nil {
+		return false, err
+	}
+	if tlsc != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsc)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	target := rnr.dialTarget()
+	if strings.Count(target, ":") < 2 {
+		target = fmt.Sprintf("passthrough:%s", target)
+	}
+	cc, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return false, err
+	}
+	rnr.cc = cc
+	if rnr.target != "" && !rnr.reusable {
+		if err := donegroup.Cleanup(ctx, func() error {
+			// In the case of Reused runners, leave the cleanup to the main cleanup
+			if o.id != rnr.operatorID {
+				return nil
+			}
+			return rnr.Renew()
+		}); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// useTLS returns whether to use TLS for the connection.
+func (rnr *grpcRunner) useTLS() bool {
+	if rnr.tls != nil {
+		return *rnr.tls
+	}
+	if strings.HasPrefix(rnr.target, "http://") {
+		return false
+	}
+	return !strings.HasSuffix(rnr.dialTarget(), ":80")
+}
+
+// tlsConfig returns the TLS config of the connection. It returns nil if TLS is not used.
+func (rnr *grpcRunner) tlsConfig() (*tls.Config, error) {
+	if !rnr.useTLS() {
+		return nil, nil
+	}
+	tlsc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(rnr.cert) != 0 {
+		certificate, err := tls.X509KeyPair(rnr.cert, rnr.key)
+		if err != nil {
+			return nil, err
+		}
+		tlsc.Certificates = []tls.Certificate{certificate}
+	}
+	if rnr.skipVerify {
+		//#nosec G402
+		tlsc.InsecureSkipVerify = true
+	} else if len(rnr.cacert) != 0 {
+		certpool, err := x509.SystemCertPool()
+		if err != nil {
+			// FIXME for Windows
+			// ref: https://github.com/golang/go/issues/18609
+			certpool = x509.NewCertPool()
+		}
+		if ok := certpool.AppendCertsFromPEM(rnr.cacert); !ok {
+			return nil, errors.New("failed to append cacert")
+		}
+		tlsc.RootCAs = certpool
+	}
+	return tlsc, nil
+}
+
+// connectReplayServer connects to the local gRPC server that replays the fixtures instead of the target.
+func (rnr *grpcRunner) connectReplayServer() error {
+	srv, err := rnr.fixtures.startGRPCReplayServer(rnr.name)
+	if err != nil {
+		return err
+	}
+	opts := []grpc.DialOption{
+		grpc.WithUserAgent(fmt.Sprintf("runn/%s", version.Version)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	opts = append(opts, rnr.fixtures.grpcDialOptions()...)
+	cc, err := grpc.NewClient(fmt.Sprintf("passthrough:%s", srv.addr), opts...)
+	if err != nil {
+		srv.stop()
+		return err
+	}
+	rnr.cc = cc
+	rnr.replayServer = srv
+	rnr.mds = srv.methods()
 	return nil
 }
 
@@ -285,12 +422,11 @@ func (rnr *grpcRunner) invokeUnary(ctx context.Context, md protoreflect.MethodDe
 		defer cancel()
 	}
 
-	ctx = setHeaders(ctx, r.headers)
 	req := dynamicpb.NewMessage(md.Input())
 
 	o.capturers.captureGRPCRequestHeaders(r.headers)
 
-	if err := rnr.setMessage(req, r.messages[0].params, s); err != nil {
+	if err := rnr.setMessage(req, r, r.messages[0].params, s); err != nil {
 		return err
 	}
 
@@ -299,7 +435,19 @@ func (rnr *grpcRunner) invokeUnary(ctx context.Context, md protoreflect.MethodDe
 		resTrailers metadata.MD
 	)
 	res := dynamicpb.NewMessage(md.Output())
-	err := rnr.cc.Invoke(ctx, toEndpoint(md.FullName()), req, res, grpc.Header(&resHeaders), grpc.Trailer(&resTrailers))
+	err := rnr.cc.Invoke(setHeaders(ctx, r.headers), toEndpoint(md.FullName()), req, res, grpc.Header(&resHeaders), grpc.Trailer(&resTrailers))
+	if status.Code(err) == codes.Unauthenticated && r.authorized && rnr.auth.expire() {
+		// Retry with the new token
+		r.authorized = false
+		r.headers.Delete(grpcAuthorizationKey)
+		if err := rnr.authorize(ctx, r, o); err != nil {
+			return err
+		}
+		o.capturers.captureGRPCRequestHeaders(r.headers)
+		resHeaders, resTrailers = nil, nil
+		res = dynamicpb.NewMessage(md.Output())
+		err = rnr.cc.Invoke(setHeaders(ctx, r.headers), toEndpoint(md.FullName()), req, res, grpc.Header(&resHeaders), grpc.Trailer(&resTrailers))
+	}
 	stat, ok := status.FromError(err)
 	if !ok {
 		return err
@@ -336,9 +484,7 @@ func (rnr *grpcRunner) invokeUnary(ctx context.Context, md protoreflect.MethodDe
 		d[grpcStoreMessageKey] = stat.Message()
 	}
 
-	o.record(s.idx, map[string]any{
-		string(grpcStoreResponseKey): d,
-	})
+	o.record(s.idx, rnr.storeValues(r, d))
 	return nil
 }
 
@@ -358,7 +504,7 @@ func (rnr *grpcRunner) invokeServerStreaming(ctx context.Context, md protoreflec
 
 	o.capturers.captureGRPCRequestHeaders(r.headers)
 
-	if err := rnr.setMessage(req, r.messages[0].params, s); err != nil {
+	if err := rnr.setMessage(req, r, r.messages[0].params, s); err != nil {
 		return err
 	}
 
@@ -431,9 +577,7 @@ func (rnr *grpcRunner) invokeServerStreaming(ctx context.Context, md protoreflec
 
 	o.capturers.captureGRPCResponseTrailers(t)
 
-	o.record(s.idx, map[string]any{
-		string(grpcStoreResponseKey): d,
-	})
+	o.record(s.idx, rnr.storeValues(r, d))
 
 	return nil
 }
@@ -470,7 +614,7 @@ func (rnr *grpcRunner) invokeClientStreaming(ctx context.Context, md protoreflec
 		case GRPCOpMessage:
 			req := dynamicpb.NewMessage(md.Input())
 
-			if err := rnr.setMessage(req, m.params, s); err != nil {
+			if err := rnr.setMessage(req, r, m.params, s); err != nil {
 				return err
 			}
 
@@ -528,9 +672,7 @@ func (rnr *grpcRunner) invokeClientStreaming(ctx context.Context, md protoreflec
 
 	o.capturers.captureGRPCResponseTrailers(t)
 
-	o.record(s.idx, map[string]any{
-		string(grpcStoreResponseKey): d,
-	})
+	o.record(s.idx, rnr.storeValues(r, d))
 
 	return nil
 }
@@ -550,6 +692,9 @@ func (rnr *grpcRunner) invokeBidiStreaming(ctx context.Context, md protoreflect.
 		ClientStreams: md.IsStreamingClient(),
 	}
 
+	// The stream is canceled when receiving messages times out.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	stream, err := rnr.cc.NewStream(ctx, streamDesc, toEndpoint(md.FullName()))
 	if err != nil {
 		return err
@@ -567,7 +712,8 @@ L:
 		switch m.op {
 		case GRPCOpMessage:
 			req := dynamicpb.NewMessage(md.Input())
-			if err := rnr.setMessage(req, m.params, s); err != nil {
+			// The message can refer to the messages received so far as `current.res`.
+			if err := rnr.setMessageWithCurrent(req, r, m.params, s, d); err != nil {
 				return err
 			}
 			err = stream.SendMsg(req)
@@ -580,28 +726,43 @@ L:
 
 			req.Reset()
 		case GRPCOpReceive:
-			res := dynamicpb.NewMessage(md.Output())
-			err := stream.RecvMsg(res)
-			if errors.Is(err, context.Canceled) {
-				break L
-			}
-			if errors.Is(err, io.EOF) {
-				break L
-			}
-			stat, ok := status.FromError(err)
-			if !ok {
-				return err
+			var timeout <-chan time.Time
+			if m.timeout > 0 {
+				timeout = time.After(m.timeout)
 			}
-			d[grpcStoreStatusKey] = int64(stat.Code())
+			for {
+				res := dynamicpb.NewMessage(md.Output())
+				err := recvMsgWithTimeout(stream, res, timeout)
+				if errors.Is(err, errGRPCReceiveTimeout) {
+					cancel()
+					if m.until != "" {
+						return fmt.Errorf("receive timed out after %s: until %q", m.timeout, m.until)
+					}
+					return fmt.Errorf("receive timed out after %s", m.timeout)
+				}
+				if errors.Is(err, context.Canceled) {
+					break L
+				}
+				if errors.Is(err, io.EOF) {
+					break L
+				}
+				stat, ok := status.FromError(err)
+				if !ok {
+					return err
+				}
+				d[grpcStoreStatusKey] = int64(stat.Code())
 
-			o.capturers.captureGRPCResponseStatus(stat)
+				o.capturers.captureGRPCResponseStatus(stat)
 
-			if h, err := stream.Header(); err == nil {
-				d[grpcStoreHeaderKey] = h
+				if h, err := stream.Header(); err == nil {
+					d[grpcStoreHeaderKey] = h
 
-				o.capturers.captureGRPCResponseHeaders(h)
-			}
-			if stat.Code() == codes.OK {
+					o.capturers.captureGRPCResponseHeaders(h)
+				}
+				if stat.Code() != codes.OK {
+					d[grpcStoreMessageKey] = stat.Message()
+					break
+				}
 				b, err := protojson.MarshalOptions{UseProtoNames: true, UseEnumNumbers: true, EmitUnpopulated: true}.Marshal(res)
 				if err != nil {
 					return err
@@ -615,8 +776,17 @@ L:
 				o.capturers.captureGRPCResponseMessage(msg)
 
 				messages = append(messages, msg)
-			} else {
-				d[grpcStoreMessageKey] = stat.Message()
+				d[grpcStoreMessagesKey] = messages
+				if m.until == "" {
+					break
+				}
+				tf, err := expr.EvalCond(m.until, rnr.storeMapWithCurrent(s, d))
+				if err != nil {
+					return fmt.Errorf("receive failed: %w", err)
+				}
+				if tf {
+					break
+				}
 			}
 		case GRPCOpClose:
 			clientClose = true
@@ -717,9 +887,7 @@ L:
 
 	o.capturers.captureGRPCResponseTrailers(t)
 
-	o.record(s.idx, map[string]any{
-		string(grpcStoreResponseKey): d,
-	})
+	o.record(s.idx, rnr.storeValues(r, d))
 
 	return nil
 }
@@ -735,10 +903,23 @@ func setHeaders(ctx context.Context, h metadata.MD) context.Context {
 	return ctx
 }
 
-func (rnr *grpcRunner) setMessage(req proto.Message, message map[string]any, s *step) error {
+func (rnr *grpcRunner) setMessage(req proto.Message, r *grpcRequest, message map[string]any, s *step) error {
+	return rnr.setMessageWithCurrent(req, r, message, s, nil)
+}
+
+// setMessageWithCurrent sets the message expanded with `current` that holds the response being recorded (e.g. the messages received in the bidirectional stream).
+func (rnr *grpcRunner) setMessageWithCurrent(req proto.Message, r *grpcRequest, message map[string]any, s *step, current map[string]any) error {
 	o := s.parent
 	// Lazy expand due to the possibility of computing variables between multiple messages.
-	e, err := o.expandBeforeRecord(message, s)
+	var (
+		e   any
+		err error
+	)
+	if current == nil {
+		e, err = o.expandBeforeRecord(message, s)
+	} else {
+		e, err = expr.EvalExpand(message, rnr.storeMapWithCurrent(s, current))
+	}
 	if err != nil {
 		return err
 	}
@@ -747,11 +928,74 @@ func (rnr *grpcRunner) setMessage(req proto.Message, message map[string]any, s *
 		return fmt.Errorf("invalid message: %v", e)
 	}
 	o.capturers.captureGRPCRequestMessage(m)
+	if err := validateMessage(req.ProtoReflect().Descriptor(), m, true); err != nil {
+		return err
+	}
 	b, err := json.Marshal(e)
 	if err != nil {
 		return err
 	}
-	return protojson.Unmarshal(b, req)
+	if err := protojson.Unmarshal(b, req); err != nil {
+		return err
+	}
+	if rnr.storeRequest {
+		sent, err := protoMessageToMap(req)
+		if err != nil {
+			return err
+		}
+		r.sent = append(r.sent, sent)
+	}
+	return nil
+}
+
+// storeValues returns the values of the step to be stored.
+func (rnr *grpcRunner) storeValues(r *grpcRequest, d map[string]any) map[string]any {
+	v := map[string]any{
+		grpcStoreResponseKey: d,
+	}
+	if rnr.storeRequest {
+		req := map[string]any{
+			grpcStoreMessageKey:  nil,
+			grpcStoreMessagesKey: r.sent,
+		}
+		if len(r.sent) > 0 {
+			req[grpcStoreMessageKey] = r.sent[len(r.sent)-1]
+		}
+		v[grpcStoreRequestKey] = req
+	}
+	return v
+}
+
+// storeMapWithCurrent returns the store values to evaluate expressions with `current` that holds the response being recorded.
+func (rnr *grpcRunner) storeMapWithCurrent(s *step, d map[string]any) map[string]any {
+	o := s.parent
+	sm := o.store.ToMap()
+	sm[store.RootKeyIncluded] = o.included
+	if !s.deferred {
+		sm[store.RootKeyPrevious] = o.store.Latest()
+	}
+	sm[store.RootKeyCurrent] = map[string]any{
+		grpcStoreResponseKey: d,
+	}
+	return sm
+}
+
+// recvMsgWithTimeout receives the message from the stream. It returns errGRPCReceiveTimeout if the timeout fires first.
+// Since RecvMsg cannot be interrupted, the stream should be canceled after the timeout.
+func recvMsgWithTimeout(stream grpc.ClientStream, m proto.Message, timeout <-chan time.Time) error {
+	if timeout == nil {
+		return stream.RecvMsg(m)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- stream.RecvMsg(m)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-timeout:
+		return errGRPCReceiveTimeout
+	}
 }
 
 func (rnr *grpcRunner) resolveAllMethodsUsingReflection(ctx context.Context) error {
@@ -797,6 +1041,14 @@ func (rnr *grpcRunner) findDescripter(svc protoreflect.FullName) (protoreflect.D
 }
 
 func (rnr *grpcRunner) resolveAllMethodsUsingProtos(ctx context.Context) error {
+	if len(rnr.protosets) > 0 {
+		if err := rnr.resolveAllMethodsUsingProtosets(); err != nil {
+			return err
+		}
+		if len(rnr.importPaths) == 0 && len(rnr.protos) == 0 && len(rnr.bufDirs) == 0 && len(rnr.bufLocks) == 0 && len(rnr.bufConfigs) == 0 && len(rnr.bufModules) == 0 {
+			return nil
+		}
+	}
 	protos, err := fs.FetchPaths(strings.Join(rnr.protos, string(os.PathListSeparator)))
 	if err != nil {
 		return err
@@ -834,35 +1086,130 @@ func (rnr *grpcRunner) resolveAllMethodsUsingProtos(ctx context.Context) error {
 		return err
 	}
 	for _, fd := range fds {
-		for i := range fd.Services().Len() {
-			svc := fd.Services().Get(i)
-			for j := range svc.Methods().Len() {
-				m := svc.Methods().Get(j)
-				key := fmt.Sprintf("%s/%s", svc.FullName(), m.Name())
-				rnr.mds[key] = m
+		rnr.addMethods(fd)
+	}
+	return nil
+}
+
+// resolveAllMethodsUsingProtosets resolves methods using the compiled descriptor sets (e.g. `buf build -o app.binpb` or `protoc --descriptor_set_out=app.protoset`).
+func (rnr *grpcRunner) resolveAllMethodsUsingProtosets() error {
+	protosets, err := fs.FetchPaths(strings.Join(rnr.protosets, string(os.PathListSeparator)))
+	if err != nil {
+		return err
+	}
+	fdps := map[string]*descriptorpb.FileDescriptorProto{}
+	var paths []string
+	for _, p := range protosets {
+		b, err := fs.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		fds := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, fds); err != nil {
+			return fmt.Errorf("invalid descriptor set %s: %w", p, err)
+		}
+		for _, fdp := range fds.GetFile() {
+			if _, ok := fdps[fdp.GetName()]; ok {
+				continue
 			}
+			fdps[fdp.GetName()] = fdp
+			paths = append(paths, fdp.GetName())
 		}
 	}
+	files := &protoregistry.Files{}
+	var resolved []protoreflect.FileDescriptor
+	var resolve func(path string, seen []string) error
+	resolve = func(path string, seen []string) error {
+		if _, err := files.FindFileByPath(path); err == nil {
+			return nil
+		}
+		if slices.Contains(seen, path) {
+			return fmt.Errorf("import cycle in descriptor set: %s", strings.Join(append(seen, path), " -> "))
+		}
+		fdp, ok := fdps[path]
+		if !ok {
+			// Dependencies not included in the descriptor sets (e.g. well-known types) are resolved from the global registry
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(path); err != nil {
+				return fmt.Errorf("failed to resolve %s in descriptor sets (build them including imports): %w", path, err)
+			}
+			return nil
+		}
+		for _, dep := range fdp.GetDependency() {
+			if err := resolve(dep, append(seen, path)); err != nil {
+				return err
+			}
+		}
+		fd, err := protodesc.NewFile(fdp, &protosetResolver{files: files})
+		if err != nil {
+			return err
+		}
+		if err := files.RegisterFile(fd); err != nil {
+			return err
+		}
+		resolved = append(resolved, fd)
+		return nil
+	}
+	for _, p := range paths {
+		if err := resolve(p, nil); err != nil {
+			return err
+		}
+	}
+	if err := registerFiles(resolved); err != nil {
+		return err
+	}
+	for _, fd := range resolved {
+		rnr.addMethods(fd)
+	}
 	return nil
 }
 
-func (r *grpcRequest) setTraceHeader(s *step) error {
+func (rnr *grpcRunner) addMethods(fd protoreflect.FileDescriptor) {
+	for i := range fd.Services().Len() {
+		svc := fd.Services().Get(i)
+		for j := range svc.Methods().Len() {
+			m := svc.Methods().Get(j)
+			key := fmt.Sprintf("%s/%s", svc.FullName(), m.Name())
+			rnr.mds[key] = m
+		}
+	}
+}
+
+// protosetResolver resolves the dependencies of the files in descriptor sets from the files already resolved and the global registry.
+type protosetResolver struct {
+	files *protoregistry.Files
+}
+
+func (r *protosetResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.files.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r *protosetResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.files.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+func (r *grpcRequest) setTraceHeader(ctx context.Context, s *step) error {
 	if r.trace == nil || !*r.trace {
 		return nil
 	}
-	// Generate trace
-	t := newTrace(s)
-	// Trace structure to json
-	tj, err := json.Marshal(t)
+	var format, headerName string
+	if s.grpcRunner != nil {
+		format = s.grpcRunner.traceFormat
+		headerName = s.grpcRunner.traceHeaderName
+	}
+	// Generate trace metadata
+	h, err := traceHeaders(ctx, s, format, headerName)
 	if err != nil {
 		return err
 	}
-	// Set Trace in the header
-	if s.grpcRunner != nil && s.grpcRunner.traceHeaderName != "" {
-		r.headers.Set(s.grpcRunner.traceHeaderName, string(tj))
-	} else {
-		// by Default
-		r.headers.Set(DefaultTraceHeaderName, string(tj))
+	// Set Trace in the metadata
+	for k, v := range h {
+		r.headers.Set(k, v)
 	}
 	return nil
 }
@@ -878,7 +1225,7 @@ func toEndpoint(mn protoreflect.FullName) string {
 	return fmt.Sprintf("/%s/%s", service, method)
 }
 
-func registerFiles(fds linker.Files) (err error) {
+func registerFiles[F protoreflect.FileDescriptor](fds []F) (err error) {
 	for _, fd := range fds {
 		// Skip registration of already registered descriptors
 		if _, err := protoregistry.GlobalFiles.FindFileByPath(fd.Path()); !errors.Is(err, protoregistry.NotFound) {
@@ -0,0 +1,183 @@
+package runn
+
+import (
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/dustin/go-humanize"
+	"github.com/goccy/go-json"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+)
+
+// grpcClientOptions is the options of the gRPC client of the runner.
+type grpcClientOptions struct {
+	compression    string
+	keepalive      *keepalive.ClientParameters
+	maxSendMsgSize int
+	maxRecvMsgSize int
+	authority      string
+	serviceConfig  string
+}
+
+func newGRPCClientOptions(c *grpcRunnerConfig) (*grpcClientOptions, error) {
+	co := &grpcClientOptions{
+		authority: c.Authority,
+	}
+	switch c.Compression {
+	case "", gzip.Name:
+		co.compression = c.Compression
+	default:
+		return nil, fmt.Errorf("invalid compression: %q (should be %q)", c.Compression, gzip.Name)
+	}
+	if c.Keepalive != nil {
+		kp := &keepalive.ClientParameters{
+			PermitWithoutStream: c.Keepalive.PermitWithoutStream,
+		}
+		if c.Keepalive.Time != "" {
+			d, err := parseDuration(c.Keepalive.Time)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keepalive time: %w", err)
+			}
+			kp.Time = d
+		}
+		if c.Keepalive.Timeout != "" {
+			d, err := parseDuration(c.Keepalive.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid keepalive timeout: %w", err)
+			}
+			kp.Timeout = d
+		}
+		co.keepalive = kp
+	}
+	var err error
+	co.maxSendMsgSize, err = parseMsgSize(c.MaxSendMsgSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxSendMsgSize: %w", err)
+	}
+	co.maxRecvMsgSize, err = parseMsgSize(c.MaxRecvMsgSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxRecvMsgSize: %w", err)
+	}
+	switch v := c.ServiceConfig.(type) {
+	case nil:
+	case string:
+		if !json.Valid([]byte(v)) {
+			return nil, fmt.Errorf("invalid serviceConfig: %s", v)
+		}
+		co.serviceConfig = v
+	default:
+		// The service config written in YAML
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid serviceConfig: %w", err)
+		}
+		co.serviceConfig = string(b)
+	}
+	return co, nil
+}
+
+// parseMsgSize parses the size of messages in bytes (e.g. 4194304, "4MiB" or "4MB").
+func parseMsgSize(v any) (int, error) {
+	switch vv := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return vv, nil
+	case uint64:
+		return int(vv), nil //nolint:gosec
+	case int64:
+		return int(vv), nil
+	case float64:
+		return int(vv), nil
+	case string:
+		n, err := humanize.ParseBytes(vv)
+		if err != nil {
+			return 0, err
+		}
+		return int(n), nil //nolint:gosec
+	default:
+		return 0, fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+// dialOptions returns the options of grpc.ClientConn.
+func (co *grpcClientOptions) dialOptions() []grpc.DialOption {
+	if co == nil {
+		return nil
+	}
+	var (
+		opts     []grpc.DialOption
+		callOpts []grpc.CallOption
+	)
+	if co.compression != "" {
+		callOpts = append(callOpts, grpc.UseCompressor(co.compression))
+	}
+	if co.maxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(co.maxSendMsgSize))
+	}
+	if co.maxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(co.maxRecvMsgSize))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if co.keepalive != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*co.keepalive))
+	}
+	if co.authority != "" {
+		opts = append(opts, grpc.WithAuthority(co.authority))
+	}
+	if co.serviceConfig != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(co.serviceConfig))
+	}
+	return opts
+}
+
+// connectOptions returns the options of the gRPC-Web or Connect client.
+// Keepalive, authority and service config are applicable only to native gRPC.
+func (co *grpcClientOptions) connectOptions() []connect.ClientOption {
+	if co == nil {
+		return nil
+	}
+	var opts []connect.ClientOption
+	if co.compression == gzip.Name {
+		opts = append(opts, connect.WithSendGzip())
+	}
+	if co.maxSendMsgSize > 0 {
+		opts = append(opts, connect.WithSendMaxBytes(co.maxSendMsgSize))
+	}
+	if co.maxRecvMsgSize > 0 {
+		opts = append(opts, connect.WithReadMaxBytes(co.maxRecvMsgSize))
+	}
+	return opts
+}
+
+// String returns the chosen options for debug output.
+func (co *grpcClientOptions) String() string {
+	if co == nil {
+		return ""
+	}
+	var s []string
+	if co.compression != "" {
+		s = append(s, fmt.Sprintf("compression=%s", co.compression))
+	}
+	if co.keepalive != nil {
+		s = append(s, fmt.Sprintf("keepalive.time=%s", co.keepalive.Time), fmt.Sprintf("keepalive.timeout=%s", co.keepalive.Timeout), fmt.Sprintf("keepalive.permitWithoutStream=%t", co.keepalive.PermitWithoutStream))
+	}
+	if co.maxSendMsgSize > 0 {
+		s = append(s, fmt.Sprintf("maxSendMsgSize=%d", co.maxSendMsgSize))
+	}
+	if co.maxRecvMsgSize > 0 {
+		s = append(s, fmt.Sprintf("maxRecvMsgSize=%d", co.maxRecvMsgSize))
+	}
+	if co.authority != "" {
+		s = append(s, fmt.Sprintf("authority=%s", co.authority))
+	}
+	if co.serviceConfig != "" {
+		s = append(s, fmt.Sprintf("serviceConfig=%s", co.serviceConfig))
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,228 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn/internal/scope"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+func TestNewGRPCClientOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *grpcClientOptions
+		wantErr bool
+	}{
+		{
+			"empty",
+			`addr: example.com:443`,
+			&grpcClientOptions{},
+			false,
+		},
+		{
+			"all",
+			`
+addr: example.com:443
+compression: gzip
+keepalive:
+  time: 30sec
+  timeout: 10sec
+  permitWithoutStream: true
+maxSendMsgSize: 1024
+maxRecvMsgSize: 16MiB
+authority: api.example.com
+serviceConfig:
+  loadBalancingConfig:
+    - round_robin: {}
+`,
+			&grpcClientOptions{
+				compression: "gzip",
+				keepalive: &keepalive.ClientParameters{
+					Time:                30 * time.Second,
+					Timeout:             10 * time.Second,
+					PermitWithoutStream: true,
+				},
+				maxSendMsgSize: 1024,
+				maxRecvMsgSize: 16 * 1024 * 1024,
+				authority:      "api.example.com",
+				serviceConfig:  `{"loadBalancingConfig":[{"round_robin":{}}]}`,
+			},
+			false,
+		},
+		{
+			"service config in JSON",
+			`
+addr: example.com:443
+serviceConfig: '{"methodConfig":[{"name":[{"service":"grpc.health.v1.Health"}],"timeout":"1s"}]}'
+`,
+			&grpcClientOptions{
+				serviceConfig: `{"methodConfig":[{"name":[{"service":"grpc.health.v1.Health"}],"timeout":"1s"}]}`,
+			},
+			false,
+		},
+		{
+			"invalid compression",
+			`
+addr: example.com:443
+compression: br
+`,
+			nil,
+			true,
+		},
+		{
+			"invalid service config",
+			`
+addr: example.com:443
+serviceConfig: '{invalid'
+`,
+			nil,
+			true,
+		},
+		{
+			"invalid size",
+			`
+addr: example.com:443
+maxRecvMsgSize: large
+`,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &grpcRunnerConfig{}
+			if err := yaml.Unmarshal([]byte(tt.in), c); err != nil {
+				t.Fatal(err)
+			}
+			got, err := newGRPCClientOptions(c)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("want error")
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(grpcClientOptions{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestGrpcRunnerClientOptions(t *testing.T) {
+	sh := &compressionStatsHandler{}
+	// Server without the reflection service to test the small maximum size of messages
+	srv := grpc.NewServer(grpc.StatsHandler(sh))
+	hs := health.NewServer()
+	hs.SetServingStatus("runn", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+	protoset := writeHealthProtoset(t)
+
+	tests := []struct {
+		name         string
+		opts         []grpcRunnerOption
+		wantStatus   codes.Code
+		wantEncoding string
+		wantDebug    string
+	}{
+		{"default", nil, codes.OK, "", ""},
+		{"gzip", []grpcRunnerOption{GRPCCompression("gzip")}, codes.OK, "gzip", "gRPC client options of greq: compression=gzip"},
+		{"max receive message size", []grpcRunnerOption{GRPCMaxRecvMsgSize(1)}, codes.ResourceExhausted, "", "maxRecvMsgSize=1"},
+		{"service config", []grpcRunnerOption{GRPCServiceConfig(`{"loadBalancingConfig":[{"round_robin":{}}]}`)}, codes.OK, "", `serviceConfig={"loadBalancingConfig":[{"round_robin":{}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sh.reset()
+			ctx, cancel := donegroup.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			stderr := new(bytes.Buffer)
+			opts := append([]grpcRunnerOption{Protosets([]string{protoset})}, tt.opts...)
+			o, err := New(GrpcRunnerWithOptions("greq", l.Addr().String(), opts...), GRPCNoTLS(true), Scopes(scope.AllowReadParent), Debug(true), Stderr(stderr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				o.Close(true)
+			})
+			req := &grpcRequest{
+				service:  "grpc.health.v1.Health",
+				method:   "Check",
+				headers:  metadata.MD{},
+				messages: []*grpcMessage{{op: GRPCOpMessage, params: map[string]any{"service": "runn"}}},
+			}
+			if err := o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+				t.Fatal(err)
+			}
+			res := o.store.Latest()["res"].(map[string]any)
+			if got := res["status"]; got != int(tt.wantStatus) {
+				t.Errorf("got %v want %v", got, tt.wantStatus)
+			}
+			if got := sh.compression(); got != tt.wantEncoding {
+				t.Errorf("got %q want %q", got, tt.wantEncoding)
+			}
+			if tt.wantDebug != "" && !strings.Contains(stderr.String(), tt.wantDebug) {
+				t.Errorf("got %q want %q", stderr.String(), tt.wantDebug)
+			}
+		})
+	}
+}
+
+// compressionStatsHandler records the compression of the received requests.
+type compressionStatsHandler struct {
+	got string
+	mu  sync.Mutex
+}
+
+func (h *compressionStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionStatsHandler) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if in, ok := s.(*stats.InHeader); ok {
+		h.mu.Lock()
+		h.got = in.Compression
+		h.mu.Unlock()
+	}
+}
+
+func (h *compressionStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *compressionStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func (h *compressionStatsHandler) compression() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.got
+}
+
+func (h *compressionStatsHandler) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.got = ""
+}
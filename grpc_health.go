@@ -0,0 +1,35 @@
+package runn
+
+import (
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// grpcHealthKey is the key of the `health:` step of gRPC runners.
+	grpcHealthKey = "health"
+	// grpcHealthCheckMethod is the method called by the `health:` step.
+	grpcHealthCheckMethod = "grpc.health.v1.Health/Check"
+)
+
+// healthCheckMethodDescriptor returns the descriptor of grpc.health.v1.Health/Check.
+// It is used when the methods of the server cannot be resolved (e.g. the server without the reflection service).
+func healthCheckMethodDescriptor() protoreflect.MethodDescriptor {
+	return healthpb.File_grpc_health_v1_health_proto.Services().ByName("Health").Methods().ByName("Check")
+}
+
+// grpcHealthStatus returns the name of the serving status recorded as the number (e.g. 1 => "SERVING").
+func grpcHealthStatus(v any) string {
+	var n int32
+	switch vv := v.(type) {
+	case float64:
+		n = int32(vv)
+	case int:
+		n = int32(vv) //nolint:gosec
+	case int64:
+		n = int32(vv) //nolint:gosec
+	case string:
+		return vv
+	}
+	return healthpb.HealthCheckResponse_ServingStatus(n).String()
+}
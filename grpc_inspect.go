@@ -0,0 +1,297 @@
+package runn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// grpcInspectorRunnerName is the name of the runner created from the address of the gRPC server.
+const grpcInspectorRunnerName = "greq"
+
+// GRPCInspector inspects the gRPC server using the gRPC runner.
+// TLS settings and the resolution of methods (protos, descriptor sets, Buf and reflection) of the runner are reused.
+type GRPCInspector struct {
+	o   *operator
+	rnr *grpcRunner
+}
+
+// GRPCMethod is the method of the gRPC service.
+type GRPCMethod struct {
+	Service string
+	Name    string
+	Type    GRPCType
+	Input   string
+	Output  string
+}
+
+// NewGRPCInspector returns GRPCInspector for the gRPC runner of the runbook (set by the Book option) or the address of the gRPC server.
+func NewGRPCInspector(runnerOrAddr string, opts ...Option) (*GRPCInspector, error) {
+	o, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if rnr, ok := o.grpcRunners[runnerOrAddr]; ok {
+		return &GRPCInspector{o: o, rnr: rnr}, nil
+	}
+	// The operator is built again with the runner of the address.
+	o.Close(true)
+	if strings.Contains(runnerOrAddr, "://") && !strings.HasPrefix(runnerOrAddr, "grpc://") {
+		return nil, fmt.Errorf("cannot find gRPC runner: %s", runnerOrAddr)
+	}
+	opts = append(opts, GrpcRunnerWithOptions(grpcInspectorRunnerName, strings.TrimPrefix(runnerOrAddr, "grpc://")))
+	o, err = New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	rnr, ok := o.grpcRunners[grpcInspectorRunnerName]
+	if !ok {
+		o.Close(true)
+		return nil, fmt.Errorf("invalid address of gRPC server: %s", runnerOrAddr)
+	}
+	return &GRPCInspector{o: o, rnr: rnr}, nil
+}
+
+// Services returns the names of services of the server.
+func (i *GRPCInspector) Services(ctx context.Context) ([]string, error) {
+	if err := i.resolve(ctx); err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, md := range i.rnr.mds {
+		svc := string(md.Parent().FullName())
+		if !slices.Contains(services, svc) {
+			services = append(services, svc)
+		}
+	}
+	slices.Sort(services)
+	return services, nil
+}
+
+// Methods returns the methods of the service.
+func (i *GRPCInspector) Methods(ctx context.Context, service string) ([]*GRPCMethod, error) {
+	if err := i.resolve(ctx); err != nil {
+		return nil, err
+	}
+	var methods []*GRPCMethod
+	for _, md := range i.rnr.mds {
+		if string(md.Parent().FullName()) != service {
+			continue
+		}
+		methods = append(methods, &GRPCMethod{
+			Service: service,
+			Name:    string(md.Name()),
+			Type:    grpcType(md),
+			Input:   string(md.Input().FullName()),
+			Output:  string(md.Output().FullName()),
+		})
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("cannot find service: %s", service)
+	}
+	slices.SortFunc(methods, func(a, b *GRPCMethod) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return methods, nil
+}
+
+// Describe returns the step templates of the service or the method, or the template of the message in YAML.
+// The symbol is the name of the service (package.Service), the method (package.Service/Method) or the message.
+func (i *GRPCInspector) Describe(ctx context.Context, symbol string) ([]byte, error) {
+	if err := i.resolve(ctx); err != nil {
+		return nil, err
+	}
+	symbol = strings.TrimPrefix(symbol, "/")
+	var mds []protoreflect.MethodDescriptor
+	for _, md := range i.rnr.mds {
+		svc := string(md.Parent().FullName())
+		if svc == symbol || fmt.Sprintf("%s/%s", svc, md.Name()) == symbol || string(md.FullName()) == symbol {
+			mds = append(mds, md)
+		}
+	}
+	if len(mds) > 0 {
+		slices.SortFunc(mds, func(a, b protoreflect.MethodDescriptor) int {
+			return strings.Compare(string(a.FullName()), string(b.FullName()))
+		})
+		steps := make([]yaml.MapSlice, 0, len(mds))
+		for _, md := range mds {
+			steps = append(steps, createGRPCStepMapSlice(i.rnr.name, md))
+		}
+		return yaml.Marshal(steps)
+	}
+	if m := i.findMessage(protoreflect.FullName(symbol)); m != nil {
+		return yaml.Marshal(messageTemplate(m, nil))
+	}
+	return nil, fmt.Errorf("cannot find symbol: %s", symbol)
+}
+
+// Health calls grpc.health.v1.Health/Check and returns the serving status (e.g. "SERVING").
+func (i *GRPCInspector) Health(ctx context.Context, service string) (string, error) {
+	s := newStep(0, grpcHealthKey, i.o, nil)
+	req, err := parseGrpcRequest(map[string]any{grpcHealthKey: service}, s, i.o.expandBeforeRecord)
+	if err != nil {
+		return "", err
+	}
+	if err := i.rnr.run(ctx, req, s); err != nil {
+		return "", err
+	}
+	res, ok := i.o.store.Latest()[grpcStoreResponseKey].(map[string]any)
+	if !ok {
+		return "", errors.New("failed to get the response of health checking")
+	}
+	if stat, ok := res[grpcStoreStatusKey].(int); ok && stat != 0 {
+		return "", fmt.Errorf("health checking failed with status code %d", stat)
+	}
+	msg, ok := res[grpcStoreMessageKey].(map[string]any)
+	if !ok {
+		return "", errors.New("failed to get the response of health checking")
+	}
+	return grpcHealthStatus(msg["status"]), nil
+}
+
+// Close closes the connection to the server.
+func (i *GRPCInspector) Close() {
+	i.o.Close(true)
+}
+
+func (i *GRPCInspector) resolve(ctx context.Context) error {
+	if len(i.rnr.mds) > 0 {
+		return nil
+	}
+	return i.rnr.connectAndResolve(ctx, i.o)
+}
+
+// findMessage finds the message used by the methods of the server.
+func (i *GRPCInspector) findMessage(name protoreflect.FullName) protoreflect.MessageDescriptor {
+	seen := map[protoreflect.FullName]struct{}{}
+	var find func(m protoreflect.MessageDescriptor) protoreflect.MessageDescriptor
+	find = func(m protoreflect.MessageDescriptor) protoreflect.MessageDescriptor {
+		if _, ok := seen[m.FullName()]; ok {
+			return nil
+		}
+		seen[m.FullName()] = struct{}{}
+		if m.FullName() == name {
+			return m
+		}
+		fields := m.Fields()
+		for j := range fields.Len() {
+			if fm := fields.Get(j).Message(); fm != nil {
+				if found := find(fm); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+	for _, md := range i.rnr.mds {
+		if found := find(md.Input()); found != nil {
+			return found
+		}
+		if found := find(md.Output()); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// createGRPCStepMapSlice creates the step template of the method.
+func createGRPCStepMapSlice(key string, md protoreflect.MethodDescriptor) yaml.MapSlice {
+	m := messageTemplate(md.Input(), nil)
+	var req yaml.MapItem
+	switch grpcType(md) {
+	case GRPCClientStreaming:
+		req = yaml.MapItem{Key: "messages", Value: []any{m}}
+	case GRPCBidiStreaming:
+		req = yaml.MapItem{Key: "messages", Value: []any{m, string(GRPCOpReceive), string(GRPCOpClose)}}
+	default:
+		req = yaml.MapItem{Key: "message", Value: m}
+	}
+	return yaml.MapSlice{
+		{Key: key, Value: yaml.MapSlice{
+			{Key: fmt.Sprintf("%s/%s", md.Parent().FullName(), md.Name()), Value: yaml.MapSlice{
+				req,
+			}},
+		}},
+	}
+}
+
+// messageTemplate returns the template of the message filled with the default values.
+// The recursive messages are left empty.
+func messageTemplate(m protoreflect.MessageDescriptor, parents []protoreflect.FullName) any {
+	if v, ok := wellKnownTypeTemplate(m.FullName()); ok {
+		return v
+	}
+	t := yaml.MapSlice{}
+	if slices.Contains(parents, m.FullName()) {
+		return t
+	}
+	parents = append(parents, m.FullName())
+	fields := m.Fields()
+	for j := range fields.Len() {
+		f := fields.Get(j)
+		// Only the first field of oneof can be set
+		if o := f.ContainingOneof(); o != nil && !o.IsSynthetic() && o.Fields().Get(0) != f {
+			continue
+		}
+		var v any
+		switch {
+		case f.IsMap():
+			v = yaml.MapSlice{{Key: fieldTemplate(f.MapKey(), parents), Value: fieldTemplate(f.MapValue(), parents)}}
+		case f.IsList():
+			v = []any{fieldTemplate(f, parents)}
+		default:
+			v = fieldTemplate(f, parents)
+		}
+		t = append(t, yaml.MapItem{Key: string(f.Name()), Value: v})
+	}
+	return t
+}
+
+func fieldTemplate(f protoreflect.FieldDescriptor, parents []protoreflect.FullName) any {
+	switch f.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageTemplate(f.Message(), parents)
+	case protoreflect.EnumKind:
+		return string(f.Enum().Values().Get(0).Name())
+	case protoreflect.BoolKind:
+		return false
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return ""
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return 0.0
+	default:
+		return 0
+	}
+}
+
+func wellKnownTypeTemplate(name protoreflect.FullName) (any, bool) {
+	switch name {
+	case "google.protobuf.Timestamp":
+		return "1970-01-01T00:00:00Z", true
+	case "google.protobuf.Duration":
+		return "0s", true
+	case "google.protobuf.FieldMask", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return "", true
+	case "google.protobuf.BoolValue":
+		return false, true
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue":
+		return 0.0, true
+	case "google.protobuf.Int32Value", "google.protobuf.Int64Value", "google.protobuf.UInt32Value", "google.protobuf.UInt64Value":
+		return 0, true
+	case "google.protobuf.Struct", "google.protobuf.Empty":
+		return yaml.MapSlice{}, true
+	case "google.protobuf.ListValue":
+		return []any{}, true
+	case "google.protobuf.Value":
+		return nil, true
+	case "google.protobuf.Any":
+		return yaml.MapSlice{{Key: "@type", Value: ""}}, true
+	default:
+		return nil, false
+	}
+}
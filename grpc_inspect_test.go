@@ -0,0 +1,195 @@
+package runn
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func TestGRPCInspector(t *testing.T) {
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("runn", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("stopped", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	ctx, cancel := donegroup.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	i, err := NewGRPCInspector(l.Addr().String(), GRPCNoTLS(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(i.Close)
+
+	t.Run("Services", func(t *testing.T) {
+		got, err := i.Services(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"grpc.health.v1.Health", "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("Methods", func(t *testing.T) {
+		got, err := i.Methods(ctx, "grpc.health.v1.Health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*GRPCMethod{
+			{Service: "grpc.health.v1.Health", Name: "Check", Type: GRPCUnary, Input: "grpc.health.v1.HealthCheckRequest", Output: "grpc.health.v1.HealthCheckResponse"},
+			{Service: "grpc.health.v1.Health", Name: "List", Type: GRPCUnary, Input: "grpc.health.v1.HealthListRequest", Output: "grpc.health.v1.HealthListResponse"},
+			{Service: "grpc.health.v1.Health", Name: "Watch", Type: GRPCServerStreaming, Input: "grpc.health.v1.HealthCheckRequest", Output: "grpc.health.v1.HealthCheckResponse"},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Error(diff)
+		}
+		if _, err := i.Methods(ctx, "unknown.Service"); err == nil {
+			t.Error("want error")
+		}
+	})
+
+	t.Run("Describe", func(t *testing.T) {
+		tests := []struct {
+			symbol string
+			want   string
+		}{
+			{
+				"grpc.health.v1.Health/Check",
+				`- greq:
+    grpc.health.v1.Health/Check:
+      message:
+        service: ""
+`,
+			},
+			{
+				"grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+				`- greq:
+    grpc.reflection.v1.ServerReflection/ServerReflectionInfo:
+      messages:
+      - host: ""
+        file_by_filename: ""
+      - receive
+      - close
+`,
+			},
+			{
+				"grpc.health.v1.HealthCheckResponse",
+				`status: UNKNOWN
+`,
+			},
+		}
+		for _, tt := range tests {
+			got, err := i.Describe(ctx, tt.symbol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, string(got)); diff != "" {
+				t.Error(diff)
+			}
+		}
+		got, err := i.Describe(ctx, "grpc.health.v1.Health")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := strings.Count(string(got), "- greq:"); c != 3 {
+			t.Errorf("got %d steps want 3", c)
+		}
+		if _, err := i.Describe(ctx, "unknown.Message"); err == nil {
+			t.Error("want error")
+		}
+	})
+
+	t.Run("Health", func(t *testing.T) {
+		tests := []struct {
+			service string
+			want    string
+			wantErr bool
+		}{
+			{"", "SERVING", false},
+			{"runn", "SERVING", false},
+			{"stopped", "NOT_SERVING", false},
+			{"unknown", "", true},
+		}
+		for _, tt := range tests {
+			got, err := i.Health(ctx, tt.service)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("got error: %v", err)
+				}
+				continue
+			}
+			if tt.wantErr {
+				t.Errorf("want error: %s", tt.service)
+			}
+			if got != tt.want {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		}
+	})
+}
+
+func TestGrpcRunnerHealth(t *testing.T) {
+	// Server without the reflection service
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("runn", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	tests := []struct {
+		in   map[string]any
+		want float64
+	}{
+		{map[string]any{"health": nil}, float64(healthpb.HealthCheckResponse_SERVING)},
+		{map[string]any{"health": "runn"}, float64(healthpb.HealthCheckResponse_SERVING)},
+		{map[string]any{"health": map[string]any{"service": "runn", "timeout": "3sec"}}, float64(healthpb.HealthCheckResponse_SERVING)},
+	}
+	for _, tt := range tests {
+		ctx, cancel := donegroup.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		o, err := New(GrpcRunnerWithOptions("greq", l.Addr().String()), GRPCNoTLS(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			o.Close(true)
+		})
+		s := newStep(0, "stepKey", o, nil)
+		req, err := parseGrpcRequest(tt.in, s, o.expandBeforeRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.grpcRunners["greq"].run(ctx, req, s); err != nil {
+			t.Fatal(err)
+		}
+		res := o.store.Latest()["res"].(map[string]any)
+		if got := res["status"]; got != 0 {
+			t.Errorf("got %v want %v", got, 0)
+		}
+		if got := res["message"].(map[string]any)["status"]; got != tt.want {
+			t.Errorf("got %v want %v", got, tt.want)
+		}
+	}
+}
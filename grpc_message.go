@@ -0,0 +1,239 @@
+package runn
+
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// validateMessage validates the message of the step against the descriptor of the message.
+// If expanded is false, the values that are not expanded yet (e.g. "{{ vars.id }}") are not validated.
+// The error points at the field path (e.g. "user.roles[0]") and suggests the closest field name.
+func validateMessage(md protoreflect.MessageDescriptor, m map[string]any, expanded bool) error {
+	return (&messageValidator{expanded: expanded}).validateMessage(md, m, "")
+}
+
+type messageValidator struct {
+	expanded bool
+}
+
+func (v *messageValidator) validateMessage(md protoreflect.MessageDescriptor, m map[string]any, path string) error {
+	fields := md.Fields()
+	oneofs := map[protoreflect.FullName]string{}
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		p := joinFieldPath(path, k)
+		if !v.expanded && isUnexpanded(k) {
+			continue
+		}
+		fd := fields.ByName(protoreflect.Name(k))
+		if fd == nil {
+			fd = fields.ByJSONName(k)
+		}
+		if fd == nil {
+			msg := fmt.Sprintf("%s: unknown field of %s", p, md.FullName())
+			if s := closestFieldName(md, k); s != "" {
+				msg = fmt.Sprintf("%s (did you mean %q?)", msg, s)
+			}
+			return fmt.Errorf("invalid message: %s", msg)
+		}
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() && m[k] != nil {
+			if other, ok := oneofs[od.FullName()]; ok {
+				return fmt.Errorf("invalid message: %s: %q and %q of oneof %s cannot be set at the same time", p, other, k, od.Name())
+			}
+			oneofs[od.FullName()] = k
+		}
+		if err := v.validateField(fd, m[k], p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *messageValidator) validateField(fd protoreflect.FieldDescriptor, val any, path string) error {
+	if val == nil {
+		return nil
+	}
+	if s, ok := val.(string); ok && !v.expanded && isUnexpanded(s) {
+		return nil
+	}
+	switch {
+	case fd.IsMap():
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Map {
+			return v.typeError(path, "map", val)
+		}
+		keys := rv.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+		})
+		for _, k := range keys {
+			if err := v.validateValue(fd.MapValue(), rv.MapIndex(k).Interface(), fmt.Sprintf("%s[%v]", path, k.Interface())); err != nil {
+				return err
+			}
+		}
+		return nil
+	case fd.IsList():
+		rv := reflect.ValueOf(val)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return v.typeError(path, "list", val)
+		}
+		for i := range rv.Len() {
+			if err := v.validateValue(fd, rv.Index(i).Interface(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return v.validateValue(fd, val, path)
+	}
+}
+
+func (v *messageValidator) validateValue(fd protoreflect.FieldDescriptor, val any, path string) error {
+	if val == nil {
+		return nil
+	}
+	if s, ok := val.(string); ok && !v.expanded && isUnexpanded(s) {
+		return nil
+	}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if _, ok := wellKnownTypeTemplate(fd.Message().FullName()); ok {
+			// The format of well-known types is validated by protojson
+			return nil
+		}
+		mv, ok := val.(map[string]any)
+		if !ok {
+			if reflect.ValueOf(val).Kind() == reflect.Map {
+				// Typed maps (e.g. the results of expressions) are validated by protojson
+				return nil
+			}
+			return v.typeError(path, string(fd.Message().FullName()), val)
+		}
+		return v.validateMessage(fd.Message(), mv, path)
+	case protoreflect.EnumKind:
+		switch vv := val.(type) {
+		case string:
+			if fd.Enum().Values().ByName(protoreflect.Name(vv)) != nil {
+				return nil
+			}
+			var names []string
+			values := fd.Enum().Values()
+			for i := range values.Len() {
+				names = append(names, string(values.Get(i).Name()))
+			}
+			return fmt.Errorf("invalid message: %s: unknown value %q of %s (should be one of %s)", path, vv, fd.Enum().FullName(), strings.Join(names, ", "))
+		default:
+			if !isNumber(val) {
+				return v.typeError(path, string(fd.Enum().FullName()), val)
+			}
+		}
+	case protoreflect.BoolKind:
+		if _, ok := val.(bool); !ok {
+			return v.typeError(path, "bool", val)
+		}
+	case protoreflect.StringKind:
+		if _, ok := val.(string); !ok {
+			return v.typeError(path, "string", val)
+		}
+	case protoreflect.BytesKind:
+		s, ok := val.(string)
+		if !ok {
+			return v.typeError(path, "bytes (base64 encoded string)", val)
+		}
+		if !isBase64(s) {
+			return fmt.Errorf("invalid message: %s: should be base64 encoded string", path)
+		}
+	default:
+		// Numbers. protojson also accepts numbers in strings
+		if _, ok := val.(string); !ok && !isNumber(val) {
+			return v.typeError(path, fd.Kind().String(), val)
+		}
+	}
+	return nil
+}
+
+// isBase64 reports whether the string is base64 encoded in the same way as protojson accepts (standard or URL-safe, with or without padding).
+func isBase64(s string) bool {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if _, err := enc.DecodeString(s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *messageValidator) typeError(path, want string, got any) error {
+	return fmt.Errorf("invalid message: %s: should be %s, but got %T (%v)", path, want, got, got)
+}
+
+func isNumber(v any) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// isUnexpanded returns whether the value contains the expression that is not expanded yet.
+func isUnexpanded(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// closestFieldName returns the field name of the message closest to the name.
+func closestFieldName(md protoreflect.MessageDescriptor, name string) string {
+	var (
+		closest string
+		minDist = -1
+	)
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		for _, n := range []string{string(fd.Name()), fd.JSONName()} {
+			d := levenshtein(strings.ToLower(name), strings.ToLower(n))
+			if minDist < 0 || d < minDist {
+				closest, minDist = n, d
+			}
+		}
+	}
+	// Too different to be a typo
+	if minDist < 0 || minDist > max(len(name)/2, 2) {
+		return ""
+	}
+	return closest
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
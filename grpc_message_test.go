@@ -0,0 +1,164 @@
+package runn
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestValidateMessage(t *testing.T) {
+	md := (&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Descriptor()
+	fileMD := (&descriptorpb.FileDescriptorProto{}).ProtoReflect().Descriptor()
+	tests := []struct {
+		name     string
+		m        map[string]any
+		expanded bool
+		want     string
+	}{
+		{"valid", map[string]any{"name": "id", "number": uint64(1), "type": "TYPE_INT32", "label": 1, "json_name": "id"}, true, ""},
+		{"JSON name", map[string]any{"jsonName": "id", "oneofIndex": int64(0)}, true, ""},
+		{"null", map[string]any{"name": nil}, true, ""},
+		{"number in string", map[string]any{"number": "1"}, true, ""},
+		{"misspelled field", map[string]any{"nmae": "id"}, true, `invalid message: nmae: unknown field of google.protobuf.FieldDescriptorProto (did you mean "name"?)`},
+		{"misspelled JSON name", map[string]any{"jsonNmae": "id"}, true, `invalid message: jsonNmae: unknown field of google.protobuf.FieldDescriptorProto (did you mean "jsonName"?)`},
+		{"unknown field", map[string]any{"xyz": "id"}, true, `invalid message: xyz: unknown field of google.protobuf.FieldDescriptorProto`},
+		{"wrong enum name", map[string]any{"type": "TYPE_INT"}, true, `invalid message: type: unknown value "TYPE_INT" of google.protobuf.FieldDescriptorProto.Type`},
+		{"wrong type of string", map[string]any{"name": uint64(1)}, true, `invalid message: name: should be string, but got uint64 (1)`},
+		{"wrong type of number", map[string]any{"number": true}, true, `invalid message: number: should be int32, but got bool (true)`},
+		{"wrong type of message", map[string]any{"options": "deprecated"}, true, `invalid message: options: should be google.protobuf.FieldOptions, but got string (deprecated)`},
+		{"nested field", map[string]any{"options": map[string]any{"deprecatd": true}}, true, `invalid message: options.deprecatd: unknown field of google.protobuf.FieldOptions (did you mean "deprecated"?)`},
+		{"wrong type of nested field", map[string]any{"options": map[string]any{"deprecated": "yes"}}, true, `invalid message: options.deprecated: should be bool, but got string (yes)`},
+		{"bytes", map[string]any{"options": map[string]any{"uninterpretedOption": []any{map[string]any{"stringValue": "YWI="}}}}, true, ""},
+		{"unpadded bytes", map[string]any{"options": map[string]any{"uninterpretedOption": []any{map[string]any{"stringValue": "YWI"}}}}, true, ""},
+		{"unpadded URL-safe bytes", map[string]any{"options": map[string]any{"uninterpretedOption": []any{map[string]any{"stringValue": "-_8"}}}}, true, ""},
+		{"invalid bytes", map[string]any{"options": map[string]any{"uninterpretedOption": []any{map[string]any{"stringValue": "!!"}}}}, true, `invalid message: options.uninterpretedOption[0].stringValue: should be base64 encoded string`},
+		{"unexpanded value", map[string]any{"number": "{{ vars.number }}"}, false, ""},
+		{"unexpanded value is not skipped after expansion", map[string]any{"options": "{{ vars.options }}"}, true, `invalid message: options: should be google.protobuf.FieldOptions, but got string ({{ vars.options }})`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMessage(md, tt.m, tt.expanded)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("got error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("want error")
+			}
+			if got := err.Error(); !cmpPrefix(got, tt.want) {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("repeated field", func(t *testing.T) {
+		m := map[string]any{
+			"dependency":   []string{"a.proto", "b.proto"},
+			"message_type": []any{map[string]any{"name": "A"}, map[string]any{"nme": "B"}},
+		}
+		err := validateMessage(fileMD, m, true)
+		want := `invalid message: message_type[1].nme: unknown field of google.protobuf.DescriptorProto (did you mean "name"?)`
+		if err == nil || err.Error() != want {
+			t.Errorf("got %v want %q", err, want)
+		}
+	})
+}
+
+func TestGrpcRunnerStoreRequest(t *testing.T) {
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	tests := []struct {
+		name    string
+		opts    []grpcRunnerOption
+		message map[string]any
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			"store request with default values",
+			[]grpcRunnerOption{GRPCStoreRequest(true)},
+			map[string]any{},
+			map[string]any{
+				"message":  map[string]any{"service": ""},
+				"messages": []map[string]any{{"service": ""}},
+			},
+			"",
+		},
+		{
+			"not store request",
+			nil,
+			map[string]any{},
+			nil,
+			"",
+		},
+		{
+			"misspelled field",
+			nil,
+			map[string]any{"servce": ""},
+			nil,
+			`grpc.health.v1.Health/Check: invalid message: servce: unknown field of grpc.health.v1.HealthCheckRequest (did you mean "service"?)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := donegroup.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			o, err := New(GrpcRunnerWithOptions("greq", l.Addr().String(), tt.opts...), GRPCNoTLS(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				o.Close(true)
+			})
+			req := &grpcRequest{
+				service:  "grpc.health.v1.Health",
+				method:   "Check",
+				headers:  metadata.MD{},
+				messages: []*grpcMessage{{op: GRPCOpMessage, params: tt.message}},
+				health:   true,
+			}
+			err = o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("got %v want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := o.store.Latest()["req"]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("got %v want nil", got)
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func cmpPrefix(got, want string) bool {
+	return len(got) >= len(want) && got[:len(want)] == want
+}
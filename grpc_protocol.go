@@ -0,0 +1,390 @@
+package runn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/goccy/go-json"
+	"github.com/k1LoW/runn/version"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	grpcProtocolGRPC    = "grpc"
+	grpcProtocolGRPCWeb = "grpcweb"
+	grpcProtocolConnect = "connect"
+)
+
+const (
+	grpcCodecProto = "proto"
+	grpcCodecJSON  = "json"
+)
+
+func validateGRPCProtocol(protocol, codec string) error {
+	switch protocol {
+	case "", grpcProtocolGRPC:
+		if codec != "" && codec != grpcCodecProto {
+			return fmt.Errorf("codec %q is not supported with the %q protocol", codec, grpcProtocolGRPC)
+		}
+		return nil
+	case grpcProtocolGRPCWeb, grpcProtocolConnect:
+	default:
+		return fmt.Errorf("invalid protocol: %q (should be %q, %q or %q)", protocol, grpcProtocolGRPC, grpcProtocolGRPCWeb, grpcProtocolConnect)
+	}
+	switch codec {
+	case "", grpcCodecProto, grpcCodecJSON:
+		return nil
+	default:
+		return fmt.Errorf("invalid codec: %q (should be %q or %q)", codec, grpcCodecProto, grpcCodecJSON)
+	}
+}
+
+// overHTTP returns whether the runner calls RPCs over plain HTTP (gRPC-Web or Connect) instead of grpc.ClientConn.
+// When replaying fixtures, RPCs are always called to the local replay server using native gRPC.
+func (rnr *grpcRunner) overHTTP() bool {
+	if rnr.fixtures.replaying() {
+		return false
+	}
+	return rnr.protocol == grpcProtocolGRPCWeb || rnr.protocol == grpcProtocolConnect
+}
+
+func grpcType(md protoreflect.MethodDescriptor) GRPCType {
+	switch {
+	case md.IsStreamingServer() && md.IsStreamingClient():
+		return GRPCBidiStreaming
+	case md.IsStreamingServer():
+		return GRPCServerStreaming
+	case md.IsStreamingClient():
+		return GRPCClientStreaming
+	default:
+		return GRPCUnary
+	}
+}
+
+// httpClientForProtocol returns the HTTP client to call RPCs using the gRPC-Web or Connect protocol.
+// TLS, proxy, socket and host rules of the runner are applied in the same way as grpc.ClientConn.
+func (rnr *grpcRunner) httpClientForProtocol() (*http.Client, error) {
+	if rnr.httpClient != nil {
+		return rnr.httpClient, nil
+	}
+	tlsc, err := rnr.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	ts := &http.Transport{
+		TLSClientConfig:   tlsc,
+		ForceAttemptHTTP2: true,
+	}
+	dialer, err := rnr.contextDialerFunc()
+	if err != nil {
+		return nil, err
+	}
+	if dialer != nil {
+		ts.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer(ctx, addr)
+		}
+	}
+	rnr.httpClient = &http.Client{Transport: ts}
+	return rnr.httpClient, nil
+}
+
+// baseURL returns the base URL of RPCs. The target can also be the URL with the path prefix (e.g. https://api.example.com/rpc).
+func (rnr *grpcRunner) baseURL() string {
+	if strings.HasPrefix(rnr.target, "http://") || strings.HasPrefix(rnr.target, "https://") {
+		return strings.TrimSuffix(rnr.target, "/")
+	}
+	if rnr.useTLS() {
+		return fmt.Sprintf("https://%s", rnr.target)
+	}
+	return fmt.Sprintf("http://%s", rnr.target)
+}
+
+// dialTarget returns the address to connect to using native gRPC (e.g. for the reflection service).
+// If the target is the URL for gRPC-Web or Connect, the host of the URL is used.
+func (rnr *grpcRunner) dialTarget() string {
+	if !strings.HasPrefix(rnr.target, "http://") && !strings.HasPrefix(rnr.target, "https://") {
+		return rnr.target
+	}
+	u, err := url.Parse(rnr.target)
+	if err != nil {
+		return rnr.target
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "http" {
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return net.JoinHostPort(u.Hostname(), "443")
+}
+
+func (rnr *grpcRunner) newConnectClient(md protoreflect.MethodDescriptor) (*connect.Client[dynamicpb.Message, dynamicpb.Message], error) {
+	hc, err := rnr.httpClientForProtocol()
+	if err != nil {
+		return nil, err
+	}
+	opts := []connect.ClientOption{
+		connect.WithSchema(md),
+		connect.WithResponseInitializer(func(spec connect.Spec, msg any) error {
+			m, ok := msg.(*dynamicpb.Message)
+			if !ok {
+				return fmt.Errorf("unexpected message type: %T", msg)
+			}
+			md, ok := spec.Schema.(protoreflect.MethodDescriptor)
+			if !ok {
+				return fmt.Errorf("unexpected schema type: %T", spec.Schema)
+			}
+			*m = *dynamicpb.NewMessage(md.Output())
+			return nil
+		}),
+	}
+	if rnr.protocol == grpcProtocolGRPCWeb {
+		opts = append(opts, connect.WithGRPCWeb())
+	}
+	if rnr.codec == grpcCodecJSON {
+		opts = append(opts, connect.WithProtoJSON())
+	}
+	opts = append(opts, rnr.clientOpts.connectOptions()...)
+	return connect.NewClient[dynamicpb.Message, dynamicpb.Message](hc, rnr.baseURL()+toEndpoint(md.FullName()), opts...), nil
+}
+
+// invokeOverHTTP calls the RPC using the gRPC-Web or Connect protocol.
+// Only unary and server streaming RPCs are supported, as they are the RPCs that browsers can call.
+func (rnr *grpcRunner) invokeOverHTTP(ctx context.Context, md protoreflect.MethodDescriptor, r *grpcRequest, s *step) error {
+	switch {
+	case !md.IsStreamingServer() && !md.IsStreamingClient():
+		return rnr.invokeUnaryOverHTTP(ctx, md, r, s)
+	case md.IsStreamingServer() && !md.IsStreamingClient():
+		return rnr.invokeServerStreamingOverHTTP(ctx, md, r, s)
+	default:
+		return fmt.Errorf("client and bidirectional streaming RPCs are not supported with the %q protocol: %s", rnr.protocol, md.FullName())
+	}
+}
+
+func (rnr *grpcRunner) invokeUnaryOverHTTP(ctx context.Context, md protoreflect.MethodDescriptor, r *grpcRequest, s *step) error {
+	o := s.parent
+	if len(r.messages) != 1 {
+		return errors.New("unary RPC message should be 1")
+	}
+	if r.timeout > 0 {
+		cctx, cancel := context.WithTimeout(ctx, r.timeout)
+		ctx = cctx
+		defer cancel()
+	}
+	client, err := rnr.newConnectClient(md)
+	if err != nil {
+		return err
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+
+	o.capturers.captureGRPCRequestHeaders(r.headers)
+
+	if err := rnr.setMessage(req, r, r.messages[0].params, s); err != nil {
+		return err
+	}
+
+	res, err := client.CallUnary(ctx, rnr.newConnectRequest(req, r.headers))
+	if connect.CodeOf(err) == connect.CodeUnauthenticated && r.authorized && rnr.auth.expire() {
+		// Retry with the new token
+		r.authorized = false
+		r.headers.Delete(grpcAuthorizationKey)
+		if err := rnr.authorize(ctx, r, o); err != nil {
+			return err
+		}
+		o.capturers.captureGRPCRequestHeaders(r.headers)
+		res, err = client.CallUnary(ctx, rnr.newConnectRequest(req, r.headers))
+	}
+	stat, resHeaders, resTrailers, err := connectResult(err)
+	if err != nil {
+		return err
+	}
+	if res != nil {
+		resHeaders = toMetadata(res.Header())
+		resTrailers = toMetadata(res.Trailer())
+	}
+
+	d := map[string]any{
+		string(grpcStoreStatusKey):  int(stat.Code()),
+		string(grpcStoreHeaderKey):  resHeaders,
+		string(grpcStoreTrailerKey): resTrailers,
+		string(grpcStoreMessageKey): nil,
+	}
+
+	o.capturers.captureGRPCResponseStatus(stat)
+	o.capturers.captureGRPCResponseHeaders(resHeaders)
+	o.capturers.captureGRPCResponseTrailers(resTrailers)
+
+	var messages []map[string]any
+	if stat.Code() == codes.OK {
+		msg, err := protoMessageToMap(res.Msg)
+		if err != nil {
+			return err
+		}
+		d[grpcStoreMessageKey] = msg
+
+		o.capturers.captureGRPCResponseMessage(msg)
+
+		messages = append(messages, msg)
+		d[grpcStoreMessagesKey] = messages
+	} else {
+		d[grpcStoreMessageKey] = stat.Message()
+	}
+
+	o.record(s.idx, rnr.storeValues(r, d))
+	return nil
+}
+
+func (rnr *grpcRunner) invokeServerStreamingOverHTTP(ctx context.Context, md protoreflect.MethodDescriptor, r *grpcRequest, s *step) error {
+	o := s.parent
+	if len(r.messages) != 1 {
+		return errors.New("server streaming RPC message should be 1")
+	}
+	if r.timeout > 0 {
+		cctx, cancel := context.WithTimeout(ctx, r.timeout)
+		ctx = cctx
+		defer cancel()
+	}
+	client, err := rnr.newConnectClient(md)
+	if err != nil {
+		return err
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+
+	o.capturers.captureGRPCRequestHeaders(r.headers)
+
+	if err := rnr.setMessage(req, r, r.messages[0].params, s); err != nil {
+		return err
+	}
+
+	stream, err := client.CallServerStream(ctx, rnr.newConnectRequest(req, r.headers))
+	if err != nil {
+		var cerr *connect.Error
+		if !errors.As(err, &cerr) {
+			return err
+		}
+	}
+
+	d := map[string]any{
+		string(grpcStoreHeaderKey):  metadata.MD{},
+		string(grpcStoreTrailerKey): metadata.MD{},
+		string(grpcStoreMessageKey): nil,
+	}
+	var messages []map[string]any
+
+	if stream != nil {
+		defer stream.Close()
+		for stream.Receive() {
+			d[grpcStoreStatusKey] = int64(codes.OK)
+
+			o.capturers.captureGRPCResponseStatus(status.New(codes.OK, ""))
+
+			msg, err := protoMessageToMap(stream.Msg())
+			if err != nil {
+				return err
+			}
+			d[grpcStoreMessageKey] = msg
+
+			o.capturers.captureGRPCResponseMessage(msg)
+
+			messages = append(messages, msg)
+		}
+		err = stream.Err()
+	}
+	stat, h, t, err := connectResult(err)
+	if err != nil {
+		return err
+	}
+	if stream != nil {
+		h = toMetadata(stream.ResponseHeader())
+		t = toMetadata(stream.ResponseTrailer())
+	}
+	d[grpcStoreStatusKey] = int64(stat.Code())
+
+	o.capturers.captureGRPCResponseStatus(stat)
+
+	if stat.Code() != codes.OK {
+		d[grpcStoreMessageKey] = stat.Message()
+	}
+	d[grpcStoreMessagesKey] = messages
+	d[grpcStoreHeaderKey] = h
+
+	o.capturers.captureGRPCResponseHeaders(h)
+
+	d[grpcStoreTrailerKey] = t
+
+	o.capturers.captureGRPCResponseTrailers(t)
+
+	o.record(s.idx, rnr.storeValues(r, d))
+
+	return nil
+}
+
+func (rnr *grpcRunner) newConnectRequest(req *dynamicpb.Message, headers metadata.MD) *connect.Request[dynamicpb.Message] {
+	creq := connect.NewRequest(req)
+	creq.Header().Set("User-Agent", fmt.Sprintf("runn/%s", version.Version))
+	for k, v := range headers {
+		for _, vv := range v {
+			if strings.HasSuffix(k, "-bin") {
+				vv = connect.EncodeBinaryHeader([]byte(vv))
+			}
+			creq.Header().Add(k, vv)
+		}
+	}
+	return creq
+}
+
+// connectResult converts the error of connect-go to the gRPC status.
+// The metadata of the error is returned as headers because it is not possible to distinguish between headers and trailers.
+func connectResult(err error) (*status.Status, metadata.MD, metadata.MD, error) {
+	if err == nil {
+		return status.New(codes.OK, ""), metadata.MD{}, metadata.MD{}, nil
+	}
+	var cerr *connect.Error
+	if !errors.As(err, &cerr) {
+		return nil, nil, nil, err
+	}
+	return status.New(codes.Code(cerr.Code()), cerr.Message()), toMetadata(cerr.Meta()), metadata.MD{}, nil
+}
+
+// toMetadata converts HTTP headers to gRPC metadata.
+func toMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range h {
+		k = strings.ToLower(k)
+		for _, vv := range v {
+			if strings.HasSuffix(k, "-bin") {
+				if b, err := connect.DecodeBinaryHeader(vv); err == nil {
+					vv = string(b)
+				}
+			}
+			md.Append(k, vv)
+		}
+	}
+	return md
+}
+
+func protoMessageToMap(m proto.Message) (map[string]any, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: true, UseEnumNumbers: true, EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,116 @@
+package runn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/google/go-cmp/cmp"
+	"github.com/k1LoW/donegroup"
+	"github.com/k1LoW/runn/internal/scope"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGrpcRunnerProtocol(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/grpc.health.v1.Health/Check", connect.NewUnaryHandler("/grpc.health.v1.Health/Check", func(ctx context.Context, req *connect.Request[healthpb.HealthCheckRequest]) (*connect.Response[healthpb.HealthCheckResponse], error) {
+		if req.Msg.GetService() != "runn" {
+			return nil, connect.NewError(connect.CodeNotFound, errors.New("unknown service"))
+		}
+		res := connect.NewResponse(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+		res.Header().Set("hello", "header")
+		res.Trailer().Set("hello", "trailer")
+		return res, nil
+	}))
+	mux.Handle("/grpc.health.v1.Health/Watch", connect.NewServerStreamHandler("/grpc.health.v1.Health/Watch", func(ctx context.Context, req *connect.Request[healthpb.HealthCheckRequest], stream *connect.ServerStream[healthpb.HealthCheckResponse]) error {
+		for _, st := range []healthpb.HealthCheckResponse_ServingStatus{healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_SERVING} {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	protoset := writeHealthProtoset(t)
+
+	tests := []struct {
+		protocol string
+		codec    string
+	}{
+		{grpcProtocolGRPCWeb, ""},
+		{grpcProtocolGRPCWeb, grpcCodecJSON},
+		{grpcProtocolConnect, ""},
+		{grpcProtocolConnect, grpcCodecJSON},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join([]string{tt.protocol, tt.codec}, "+"), func(t *testing.T) {
+			run := func(t *testing.T, method, service string) map[string]any {
+				t.Helper()
+				ctx, cancel := donegroup.WithCancel(context.Background())
+				t.Cleanup(cancel)
+				o, err := New(GrpcRunnerWithOptions("greq", strings.TrimPrefix(ts.URL, "http://"), Protosets([]string{protoset}), GRPCProtocol(tt.protocol), GRPCCodec(tt.codec)), GRPCNoTLS(true), Scopes(scope.AllowReadParent))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() {
+					o.Close(true)
+				})
+				req := &grpcRequest{
+					service:  "grpc.health.v1.Health",
+					method:   method,
+					messages: []*grpcMessage{{op: GRPCOpMessage, params: map[string]any{"service": service}}},
+				}
+				if err := o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+					t.Fatal(err)
+				}
+				return o.store.Latest()["res"].(map[string]any)
+			}
+
+			t.Run("unary", func(t *testing.T) {
+				res := run(t, "Check", "runn")
+				if got := res[grpcStoreStatusKey]; got != 0 {
+					t.Errorf("got %v want %v", got, 0)
+				}
+				if diff := cmp.Diff(map[string]any{"status": float64(healthpb.HealthCheckResponse_SERVING)}, res[grpcStoreMessageKey]); diff != "" {
+					t.Error(diff)
+				}
+				if got := res[grpcStoreHeaderKey].(metadata.MD).Get("hello"); len(got) != 1 || got[0] != "header" {
+					t.Errorf("got %v", got)
+				}
+				if got := res[grpcStoreTrailerKey].(metadata.MD).Get("hello"); len(got) != 1 || got[0] != "trailer" {
+					t.Errorf("got %v", got)
+				}
+			})
+
+			t.Run("unary error", func(t *testing.T) {
+				res := run(t, "Check", "other")
+				if got := res[grpcStoreStatusKey]; got != 5 {
+					t.Errorf("got %v want %v", got, 5)
+				}
+				if got := res[grpcStoreMessageKey]; got != "unknown service" {
+					t.Errorf("got %v", got)
+				}
+			})
+
+			t.Run("server streaming", func(t *testing.T) {
+				res := run(t, "Watch", "runn")
+				if got := res[grpcStoreStatusKey]; got != int64(0) {
+					t.Errorf("got %v want %v", got, 0)
+				}
+				want := []map[string]any{
+					{"status": float64(healthpb.HealthCheckResponse_NOT_SERVING)},
+					{"status": float64(healthpb.HealthCheckResponse_SERVING)},
+				}
+				if diff := cmp.Diff(want, res[grpcStoreMessagesKey]); diff != "" {
+					t.Error(diff)
+				}
+			})
+		})
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/k1LoW/donegroup"
 	"github.com/k1LoW/grpcstub"
+	"github.com/k1LoW/runn/internal/scope"
 	"github.com/k1LoW/runn/testutil"
 	"github.com/k1LoW/runn/version"
 	"google.golang.org/grpc"
@@ -20,6 +23,9 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func TestGrpcRunner(t *testing.T) {
@@ -795,3 +801,168 @@ func TestGrpcRunnerReusableLifecycle(t *testing.T) {
 		}
 	})
 }
+
+func TestGrpcRunnerProtoset(t *testing.T) {
+	// Server without the reflection service
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("runn", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	protoset := writeHealthProtoset(t)
+
+	tests := []struct {
+		name    string
+		opts    []grpcRunnerOption
+		wantErr bool
+	}{
+		{"without protoset", nil, true},
+		{"with protoset", []grpcRunnerOption{Protosets([]string{protoset})}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := donegroup.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			o, err := New(GrpcRunnerWithOptions("greq", l.Addr().String(), tt.opts...), GRPCNoTLS(true), Scopes(scope.AllowReadParent))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				o.Close(true)
+			})
+			req := &grpcRequest{
+				service:  "grpc.health.v1.Health",
+				method:   "Check",
+				messages: []*grpcMessage{{op: GRPCOpMessage, params: map[string]any{"service": "runn"}}},
+			}
+			if err := o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+				if !tt.wantErr {
+					t.Fatal(err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("want error")
+			}
+			res := o.store.Latest()["res"].(map[string]any)
+			want := map[string]any{"status": float64(healthpb.HealthCheckResponse_SERVING)}
+			if diff := cmp.Diff(want, res["message"]); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+// writeHealthProtoset writes the descriptor set of grpc.health.v1 for the servers without the reflection service.
+func writeHealthProtoset(t *testing.T) string {
+	t.Helper()
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "health.protoset")
+	if err := os.WriteFile(p, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGrpcRunnerBidiResponseDriven(t *testing.T) {
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	reflection.Register(srv)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	tests := []struct {
+		name         string
+		messages     []*grpcMessage
+		wantMessages int
+		wantErr      string
+	}{
+		{
+			"send the message computed from the received message",
+			[]*grpcMessage{
+				{op: GRPCOpMessage, params: map[string]any{"list_services": ""}},
+				{op: GRPCOpReceive},
+				{op: GRPCOpMessage, params: map[string]any{"file_containing_symbol": "{{ current.res.message.list_services_response.service[0].name }}"}},
+				{op: GRPCOpReceive, until: "current.res.message.file_descriptor_response != nil", timeout: 5 * time.Second},
+				{op: GRPCOpClose},
+			},
+			2,
+			"",
+		},
+		{
+			"receive until the condition holds",
+			[]*grpcMessage{
+				{op: GRPCOpMessage, params: map[string]any{"list_services": ""}},
+				{op: GRPCOpMessage, params: map[string]any{"list_services": ""}},
+				{op: GRPCOpMessage, params: map[string]any{"list_services": ""}},
+				{op: GRPCOpReceive, until: "len(current.res.messages) == 3", timeout: 5 * time.Second},
+				{op: GRPCOpClose},
+			},
+			3,
+			"",
+		},
+		{
+			"receive timed out",
+			[]*grpcMessage{
+				{op: GRPCOpMessage, params: map[string]any{"list_services": ""}},
+				{op: GRPCOpReceive, until: "len(current.res.messages) == 2", timeout: 100 * time.Millisecond},
+			},
+			0,
+			"receive timed out",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := donegroup.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			o, err := New(GrpcRunnerWithOptions("greq", l.Addr().String()), GRPCNoTLS(true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				o.Close(true)
+			})
+			req := &grpcRequest{
+				service:  "grpc.reflection.v1.ServerReflection",
+				method:   "ServerReflectionInfo",
+				headers:  metadata.MD{},
+				messages: tt.messages,
+			}
+			err = o.grpcRunners["greq"].run(ctx, req, newStep(0, "stepKey", o, nil))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got %v want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := o.store.Latest()["res"].(map[string]any)
+			messages := res["messages"].([]map[string]any)
+			if len(messages) != tt.wantMessages {
+				t.Fatalf("got %d messages want %d: %v", len(messages), tt.wantMessages, messages)
+			}
+			if tt.wantMessages == 2 {
+				if messages[1]["file_descriptor_response"] == nil {
+					t.Errorf("got %v", messages[1])
+				}
+			}
+		})
+	}
+}
@@ -35,25 +35,10 @@ func (r hostRules) dialContextFunc() func(ctx context.Context, network, addr str
 		KeepAlive: 30 * time.Second,
 	}
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
-		host, port, err := net.SplitHostPort(addr)
+		addr, err := r.replaceAddr(addr)
 		if err != nil {
 			return nil, err
 		}
-		for _, rule := range r {
-			if wildcard.Match(rule.host, host) {
-				var rhost, rport string
-				if strings.Contains(rule.rule, ":") {
-					rhost, rport, err = net.SplitHostPort(rule.rule)
-					if err != nil {
-						return nil, err
-					}
-				} else {
-					rhost = rule.rule
-					rport = port
-				}
-				return dialer.DialContext(ctx, network, net.JoinHostPort(rhost, rport))
-			}
-		}
 		return dialer.DialContext(ctx, network, addr)
 	}
 }
@@ -62,56 +47,43 @@ func (r hostRules) dialContextFunc() func(ctx context.Context, network, addr str
 func (r hostRules) contextDialerFunc() func(ctx context.Context, address string) (net.Conn, error) { //nostyle:recvtype
 	dialer := &net.Dialer{} // Same as google.golang.org/grpc@v1.58.3/internal/transport.dial()
 	return func(ctx context.Context, address string) (net.Conn, error) {
-		host, port, err := net.SplitHostPort(address)
+		address, err := r.replaceAddr(address)
 		if err != nil {
 			return nil, err
 		}
-		var network string
-		for _, rule := range r {
-			if wildcard.Match(rule.host, host) {
-				var rhost, rport string
-				if strings.Contains(rule.rule, ":") {
-					rhost, rport, err = net.SplitHostPort(rule.rule)
-					if err != nil {
-						return nil, err
-					}
-				} else {
-					rhost = rule.rule
-					rport = port
+		network, address := parseDialTarget(address)
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// replaceAddr returns the address (host:port) rewritten by the rules.
+func (r hostRules) replaceAddr(addr string) (string, error) { //nostyle:recvtype
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	for _, rule := range r {
+		if wildcard.Match(rule.host, host) {
+			rhost, rport := rule.rule, port
+			if strings.Contains(rule.rule, ":") {
+				rhost, rport, err = net.SplitHostPort(rule.rule)
+				if err != nil {
+					return "", fmt.Errorf("invalid host rule %q: %w", rule.rule, err)
 				}
-				address = net.JoinHostPort(rhost, rport)
-				network, address = parseDialTarget(address)
-				return dialer.DialContext(ctx, network, address)
 			}
+			return net.JoinHostPort(rhost, rport), nil
 		}
-		network, address = parseDialTarget(address)
-		return dialer.DialContext(ctx, network, address)
 	}
+	return addr, nil
 }
 
 // dialTimeoutFunc returns DialTimeout() for sshc.DialTimeoutFunc.
 func (r hostRules) dialTimeoutFunc() func(network, address string, timeout time.Duration) (net.Conn, error) { //nostyle:recvtype
 	return func(network, address string, timeout time.Duration) (net.Conn, error) {
-		host, port, err := net.SplitHostPort(address)
+		address, err := r.replaceAddr(address)
 		if err != nil {
 			return nil, err
 		}
-		for _, rule := range r {
-			if wildcard.Match(rule.host, host) {
-				var rhost, rport string
-				if strings.Contains(rule.rule, ":") {
-					rhost, rport, err = net.SplitHostPort(rule.rule)
-					if err != nil {
-						return nil, err
-					}
-				} else {
-					rhost = rule.rule
-					rport = port
-				}
-				address = net.JoinHostPort(rhost, rport)
-				return net.DialTimeout(network, address, timeout)
-			}
-		}
 		return net.DialTimeout(network, address, timeout)
 	}
 }
@@ -179,6 +179,39 @@ func TestReplaceDSN(t *testing.T) {
 	}
 }
 
+func TestReplaceAddr(t *testing.T) {
+	tests := []struct {
+		addr      string
+		hostRules hostRules
+		want      string
+		wantErr   bool
+	}{
+		{"app.example.com:80", hostRules{{"app.example.com", "127.0.0.1"}}, "127.0.0.1:80", false},
+		{"app.example.com:80", hostRules{{"app.example.com", "127.0.0.1:8080"}}, "127.0.0.1:8080", false},
+		{"app.example.com:80", hostRules{{"*.example.com", "[::1]:8080"}}, "[::1]:8080", false},
+		{"other.example.org:80", hostRules{{"app.example.com", "127.0.0.1"}}, "other.example.org:80", false},
+		{"app.example.com:80", hostRules{{"app.example.com", "127.0.0.1:8080:1"}}, "", true},
+		{"app.example.com", hostRules{{"app.example.com", "127.0.0.1"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := tt.hostRules.replaceAddr(tt.addr)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("got error: %v", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Error("want error")
+			}
+			if got != tt.want {
+				t.Errorf("got %s want %s", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestHostRulesOrder(t *testing.T) {
 	// The host rules specified by the option take precedence.
 	book := "testdata/book/grpc_with_host_rules.yml"
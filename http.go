@@ -10,10 +10,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"mime"
 	"mime/multipart"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/textproto"
 	"net/url"
 	"os"
@@ -22,9 +24,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/ajg/form"
-	"github.com/goccy/go-json"
 	internalfs "github.com/k1LoW/runn/internal/fs"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
@@ -73,6 +74,16 @@ type httpRunner struct {
 	useCookie         *bool
 	trace             *bool
 	traceHeaderName   string
+	traceFormat       string
+	codecs            map[string]HTTPBodyCodec
+	auth              *authenticator
+	sign              *SignConfig
+	proxy             *url.URL
+	socket            string
+	hostRules         hostRules
+	protocol          string
+	fixtures          *fixtures
+	cookieJar         *cookieJar
 	tlsOnce           sync.Once
 	tlsErr            error
 }
@@ -85,6 +96,12 @@ type httpRequest struct {
 	body      any
 	useCookie *bool
 	trace     *bool
+	stream    *httpStream
+	sign      *SignConfig
+	// saveTo - The path of the file to write the response body to instead of the store
+	saveTo string
+	// codecs - Codecs set by the runner option
+	codecs map[string]HTTPBodyCodec
 
 	multipartWriter   *multipart.Writer
 	multipartBoundary string
@@ -144,6 +161,9 @@ func (r *httpRequest) validate() error {
 			return fmt.Errorf("%s method requires body", r.method)
 		}
 	}
+	if r.stream != nil && r.saveTo != "" {
+		return errors.New("stream and saveTo cannot be used at the same time")
+	}
 	if r.isMultipartFormDataMediaType() {
 		return nil
 	}
@@ -158,22 +178,7 @@ func (r *httpRequest) encodeBody() (io.Reader, error) {
 		return r.encodeMultipart()
 	}
 	switch r.mediaType {
-	case MediaTypeApplicationJSON:
-		b, err := json.Marshal(r.body)
-		if err != nil {
-			return nil, err
-		}
-		return bytes.NewBuffer(b), nil
-	case MediaTypeApplicationFormUrlencoded:
-		values, ok := r.body.(map[string]any)
-		if !ok {
-			return nil, fmt.Errorf("invalid body: %v", r.body)
-		}
-		buf := new(bytes.Buffer)
-		if err := form.NewEncoder(buf).Encode(values); err != nil {
-			return nil, err
-		}
-		return buf, nil
+	case MediaTypeApplicationJSON, MediaTypeApplicationFormUrlencoded:
 	case MediaTypeTextPlain:
 		s, ok := r.body.(string)
 		if !ok {
@@ -181,46 +186,55 @@ func (r *httpRequest) encodeBody() (io.Reader, error) {
 		}
 		return strings.NewReader(s), nil
 	default:
-		switch v := r.body.(type) {
-		case map[string]any:
-			vv, ok := v["filename"]
-			if !ok {
-				return nil, fmt.Errorf("invalid body: %v", r.body)
-			}
-			fileName, ok := vv.(string)
-			if !ok {
-				return nil, fmt.Errorf("invalid body: %v", r.body)
-			}
-			p, err := internalfs.Path(fileName, r.root)
-			if err != nil {
-				return nil, err
-			}
-			b, err := internalfs.ReadFile(p)
-			if err != nil {
-				return nil, err
+		// The body of the file
+		if m, ok := r.body.(map[string]any); ok && len(m) == 1 {
+			if fileName, ok := m["filename"].(string); ok {
+				p, err := internalfs.Path(fileName, r.root)
+				if err != nil {
+					return nil, err
+				}
+				// Stream the file instead of reading it into memory
+				return openSizedBody([]*sizedBodyPart{{path: p}})
 			}
-			return bytes.NewBuffer(b), nil
-		case string:
-			return strings.NewReader(v), nil
-		case []byte:
-			return bytes.NewBuffer(v), nil
-		case []any:
-			arr, ok := r.body.([]any)
+		}
+	}
+	if c, ok := findHTTPBodyCodec(r.mediaType, r.codecs); ok {
+		b, err := c.Encode(r.body)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(b), nil
+	}
+	// Media types without codecs: string and bytes bodies are sent as they are
+	if b, ok := rawHTTPBody(r.mediaType, r.body); ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("invalid body: %v", r.body)
+}
+
+// rawHTTPBody returns the body as it is if the body is a string or bytes.
+// A list of bytes is accepted only for application/octet-stream.
+func rawHTTPBody(mediaType string, body any) (io.Reader, bool) {
+	switch v := body.(type) {
+	case string:
+		return strings.NewReader(v), true
+	case []byte:
+		return bytes.NewBuffer(v), true
+	case []any:
+		if mt, _, err := mime.ParseMediaType(mediaType); err != nil || mt != MediaTypeApplicationOctetStream {
+			return nil, false
+		}
+		b := make([]byte, len(v))
+		for i := range v {
+			u64, ok := v[i].(uint64)
 			if !ok {
-				return nil, fmt.Errorf("invalid body: %v", r.body)
+				return nil, false
 			}
-			b := make([]byte, len(arr))
-			for i := range arr {
-				u64, ok := arr[i].(uint64)
-				if !ok {
-					return nil, fmt.Errorf("invalid body: %v", r.body)
-				}
-				b[i] = (uint8)(u64 & 0xff) //nolint:gosec
-			}
-			return bytes.NewBuffer(b), nil
+			b[i] = (uint8)(u64 & 0xff) //nolint:gosec
 		}
-		return nil, fmt.Errorf("invalid body: %v", r.body)
+		return bytes.NewBuffer(b), true
 	}
+	return nil, false
 }
 
 func (r *httpRequest) isMultipartFormDataMediaType() bool {
@@ -232,7 +246,8 @@ func (r *httpRequest) isMultipartFormDataMediaType() bool {
 
 func (r *httpRequest) encodeMultipart() (io.Reader, error) {
 	quoteEscaper := strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
-	buf := &bytes.Buffer{}
+	// Files are streamed instead of being read into memory
+	buf := &sizedBodyBuilder{}
 	mw := multipart.NewWriter(buf)
 	if r.multipartBoundary != "" {
 		_ = mw.SetBoundary(r.multipartBoundary)
@@ -283,7 +298,7 @@ func (r *httpRequest) encodeMultipart() (io.Reader, error) {
 			if err != nil {
 				return nil, err
 			}
-			b, err := internalfs.ReadFile(p)
+			contentType, err := detectFileContentType(p)
 			patherr := &fs.PathError{}
 			if err != nil && ((!errors.Is(err, os.ErrNotExist) && !errors.As(err, &patherr)) || strings.HasPrefix(fileName, internalfs.PrefixFile)) {
 				return nil, err
@@ -291,26 +306,32 @@ func (r *httpRequest) encodeMultipart() (io.Reader, error) {
 			h := make(textproto.MIMEHeader)
 			if errors.Is(err, os.ErrNotExist) || errors.As(err, &patherr) {
 				// Value is NOT file
-				b = []byte(fileName)
 				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(k))) //nostyle:useq FIXME
-			} else {
-				// Value is file
-				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, //nostyle:useq FIXME
-					quoteEscaper.Replace(k), quoteEscaper.Replace(filepath.Base(fileName))))
-				h.Set("Content-Type", http.DetectContentType(b))
-			}
-			fw, err := mw.CreatePart(h)
-			if err != nil {
-				return nil, err
+				fw, err := mw.CreatePart(h)
+				if err != nil {
+					return nil, err
+				}
+				if _, err = io.WriteString(fw, fileName); err != nil {
+					return nil, err
+				}
+				continue
 			}
-			if _, err = io.Copy(fw, bytes.NewReader(b)); err != nil {
+			// Value is file
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, //nostyle:useq FIXME
+				quoteEscaper.Replace(k), quoteEscaper.Replace(filepath.Base(fileName))))
+			h.Set("Content-Type", contentType)
+			if _, err := mw.CreatePart(h); err != nil {
 				return nil, err
 			}
+			buf.addFile(p)
 		}
 	}
 	// for Content-Type multipart/form-data with this Writer's Boundary
 	r.multipartWriter = mw
-	return buf, mw.Close()
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.open()
 }
 
 func (r *httpRequest) setContentTypeHeader(req *http.Request) {
@@ -361,23 +382,23 @@ func (r *httpRequest) setCookieHeader(req *http.Request, cookies map[string]map[
 	}
 }
 
-func (r *httpRequest) setTraceHeader(s *step) error {
+func (r *httpRequest) setTraceHeader(ctx context.Context, s *step) error {
 	if r.trace == nil || !*r.trace {
 		return nil
 	}
-	// Generate trace
-	t := newTrace(s)
-	// Trace structure to json
-	tj, err := json.Marshal(t)
+	var format, headerName string
+	if s.httpRunner != nil {
+		format = s.httpRunner.traceFormat
+		headerName = s.httpRunner.traceHeaderName
+	}
+	// Generate trace headers
+	h, err := traceHeaders(ctx, s, format, headerName)
 	if err != nil {
 		return err
 	}
 	// Set Trace in the header
-	if s.httpRunner != nil && s.httpRunner.traceHeaderName != "" {
-		r.headers.Set(s.httpRunner.traceHeaderName, string(tj))
-	} else {
-		// by Default
-		r.headers.Set(DefaultTraceHeaderName, string(tj))
+	for k, v := range h {
+		r.headers.Set(k, v)
 	}
 	return nil
 }
@@ -434,7 +455,7 @@ func (rnr *httpRunner) configureTLS() error {
 		}
 		ts, ok := rnr.client.Transport.(*http.Transport)
 		if !ok {
-			if len(rnr.cacert) != 0 || len(rnr.cert) != 0 || len(rnr.key) != 0 {
+			if len(rnr.cacert) != 0 || len(rnr.cert) != 0 || len(rnr.key) != 0 || rnr.protocol != "" {
 				rnr.tlsErr = fmt.Errorf("cannot configure TLS: client transport is %T, want *http.Transport", rnr.client.Transport)
 			}
 			return
@@ -466,6 +487,7 @@ func (rnr *httpRunner) configureTLS() error {
 			}
 			ts.TLSClientConfig.Certificates = []tls.Certificate{cert}
 		}
+		rnr.tlsErr = rnr.configureProtocol(ts)
 	})
 	return rnr.tlsErr
 }
@@ -477,16 +499,47 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 	o := s.parent
 	r.multipartBoundary = rnr.multipartBoundary
 	r.root = o.root
+	r.codecs = rnr.codecs
 	reqBody, err := r.encodeBody()
 	if err != nil {
 		return err
 	}
+	if sb, ok := reqBody.(*sizedBody); ok {
+		defer sb.Close()
+	}
+	var (
+		fc           *fixtureCall
+		reqBodyBytes []byte
+	)
+	if rnr.fixtures != nil {
+		ctx, fc = withFixtureCall(ctx, rnr.name, s)
+		_, fc.streamed = reqBody.(*sizedBody)
+		if rnr.fixtures.recording() {
+			reqBody, reqBodyBytes, err = readFixtureRequestBody(reqBody)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	// Override useCookie
 	if r.useCookie == nil && rnr.useCookie != nil && *rnr.useCookie {
 		r.useCookie = rnr.useCookie
 	}
 
+	// Load cookies persisted in the cookie jar
+	if rnr.cookieJar != nil {
+		var host string
+		if rnr.endpoint != nil {
+			host = rnr.endpoint.Host
+		}
+		cookies, err := rnr.cookieJar.Cookies(host)
+		if err != nil {
+			return err
+		}
+		o.store.MergeCookies(cookies)
+	}
+
 	// Override trace
 	switch {
 	case r.trace == nil && rnr.trace == nil:
@@ -494,7 +547,7 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 	case r.trace == nil && rnr.trace != nil:
 		r.trace = rnr.trace
 	}
-	if err := r.setTraceHeader(s); err != nil {
+	if err := r.setTraceHeader(ctx, s); err != nil {
 		return newErrUnrecoverable(err)
 	}
 
@@ -502,16 +555,35 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 		req *http.Request
 		res *http.Response
 	)
+	timing := newHTTPTiming()
+	client := rnr.client
+	if r.stream != nil {
+		// The stream is read until the timeout of the stream instead of the timeout of the client.
+		var (
+			timeout time.Duration
+			cancel  context.CancelFunc
+		)
+		if rnr.client != nil {
+			timeout = rnr.client.Timeout
+			c := *rnr.client
+			c.Timeout = 0
+			client = &c
+		}
+		ctx, cancel = r.stream.streamContext(ctx, timeout)
+		defer cancel()
+	}
 	switch {
-	case rnr.client != nil:
+	case client != nil:
 		u, err := mergeURL(rnr.endpoint, r.path)
 		if err != nil {
 			return newErrUnrecoverable(err)
 		}
+		ctx = httptrace.WithClientTrace(ctx, timing.clientTrace())
 		req, err = http.NewRequestWithContext(ctx, r.method, u.String(), reqBody)
 		if err != nil {
 			return newErrUnrecoverable(err)
 		}
+		setSizedBody(req, reqBody)
 		r.setContentTypeHeader(req)
 		r.setCookieHeader(req, o.store.Cookies())
 		for k, v := range r.headers {
@@ -523,6 +595,13 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 				}
 			}
 		}
+		if err := rnr.authorize(ctx, r, req, o); err != nil {
+			return err
+		}
+		injectTraceContext(ctx, propagation.HeaderCarrier(req.Header))
+		if err := rnr.signRequest(req, r, s); err != nil {
+			return err
+		}
 
 		o.capturers.captureHTTPRequest(rnr.name, req)
 
@@ -530,13 +609,35 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 			return err
 		}
 
-		res, err = rnr.client.Do(req) //nolint:gosec
+		timing.reset()
+		res, err = rnr.do(client, req)
 		if err != nil {
 			return err
 		}
+		retry, err := rnr.reauthorize(ctx, r, req, res, o)
+		if err != nil {
+			_ = res.Body.Close()
+			return err
+		}
+		if retry != nil {
+			_ = res.Body.Close()
+			req = retry
+			// The encoded body of the retry is closed on every path
+			defer req.Body.Close()
+			if err := rnr.signRequest(req, r, s); err != nil {
+				return err
+			}
+			o.capturers.captureHTTPRequest(rnr.name, req)
+			timing.reset()
+			res, err = rnr.do(client, req)
+			if err != nil {
+				return err
+			}
+		}
 		defer res.Body.Close()
 	case rnr.handler != nil:
-		req = httptest.NewRequest(r.method, r.path, reqBody)
+		req = httptest.NewRequestWithContext(ctx, r.method, r.path, reqBody)
+		setSizedBody(req, reqBody)
 		r.setContentTypeHeader(req)
 		r.setCookieHeader(req, o.store.Cookies())
 		for k, v := range r.headers {
@@ -548,6 +649,13 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 				}
 			}
 		}
+		if err := rnr.authorize(ctx, r, req, o); err != nil {
+			return err
+		}
+		injectTraceContext(ctx, propagation.HeaderCarrier(req.Header))
+		if err := rnr.signRequest(req, r, s); err != nil {
+			return err
+		}
 
 		o.capturers.captureHTTPRequest(rnr.name, req)
 
@@ -555,17 +663,86 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 			return err
 		}
 		w := httptest.NewRecorder()
+		timing.reset()
+		timing.wroteRequestAt(timing.start)
 		rnr.handler.ServeHTTP(w, req)
+		timing.gotFirstByteAt(time.Now())
+		if fc != nil && fc.err != nil {
+			return fc.err
+		}
 		res = w.Result()
+		retry, err := rnr.reauthorize(ctx, r, req, res, o)
+		if err != nil {
+			_ = res.Body.Close()
+			return err
+		}
+		if retry != nil {
+			_ = res.Body.Close()
+			req = retry
+			// The encoded body of the retry is closed on every path
+			defer req.Body.Close()
+			if err := rnr.signRequest(req, r, s); err != nil {
+				return err
+			}
+			o.capturers.captureHTTPRequest(rnr.name, req)
+			w = httptest.NewRecorder()
+			timing.reset()
+			timing.wroteRequestAt(timing.start)
+			rnr.handler.ServeHTTP(w, req)
+			timing.gotFirstByteAt(time.Now())
+			if fc != nil && fc.err != nil {
+				return fc.err
+			}
+			res = w.Result()
+		}
 		defer res.Body.Close()
 	default:
 		return fmt.Errorf("invalid http runner: %s", rnr.name)
 	}
+	res.Body = timing.wrapBody(res.Body)
 
-	var resError error //nostyle:repetition
+	var (
+		resError error //nostyle:repetition
+		resBody  []byte
+		// recBody - Response body to record as a fixture
+		recBody []byte
+	)
+	d := map[string]any{}
+	d[httpStoreStatusKey] = res.StatusCode
+	d[httpStoreProtoKey] = res.Proto
+	d[httpStoreHeaderKey] = res.Header
+	if r.stream != nil {
+		// Read the stream first because capturers and the validator read the whole body.
+		events, raw, err := rnr.readStream(ctx, res, r.stream, d, s)
+		if err != nil {
+			return err
+		}
+		d[httpStoreEventsKey] = events
+		resBody = raw
+		res.Body = io.NopCloser(bytes.NewReader(raw))
+		res.Header.Del("Content-Encoding")
+	}
+	if r.saveTo != "" {
+		// Write the body to the file instead of reading it into memory.
+		f, err := rnr.saveBody(res, r.saveTo, o)
+		if err != nil {
+			return err
+		}
+		d[httpStoreFileKey] = f
+		res.Body = http.NoBody
+		if rnr.fixtures.recording() {
+			// Record the saved file so that it is saved again on replay
+			recBody, err = os.ReadFile(f[httpFilePathKey].(string))
+			if err != nil {
+				return err
+			}
+		}
+	}
 	o.capturers.captureHTTPResponse(rnr.name, res)
 
-	if err := rnr.validator.ValidateResponse(ctx, req, res); err != nil {
+	if r.saveTo != "" {
+		o.Debugf("Skip validate response because the body is saved to the file: %s", r.saveTo)
+	} else if err := rnr.validator.ValidateResponse(ctx, req, res); err != nil {
 		if _, ok := errors.AsType[*UnsupportedError](err); ok {
 			o.Debugf("Skip validate response due to unsupported format: %s", err.Error())
 			resError = errors.Join(resError, fmt.Errorf("unsupported response format: %w", err))
@@ -574,26 +751,35 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 		}
 	}
 
-	resBody, err := readPlainBody(res)
-	if err != nil {
-		o.Debugf("Failed to read response body: %s", err.Error())
-		resError = errors.Join(resError, fmt.Errorf("failed to read response body: %w", err))
+	if r.stream == nil && r.saveTo == "" {
+		resBody, err = readPlainBody(res)
+		if err != nil {
+			o.Debugf("Failed to read response body: %s", err.Error())
+			resError = errors.Join(resError, fmt.Errorf("failed to read response body: %w", err))
+		}
 	}
 
-	d := map[string]any{}
-	d[httpStoreStatusKey] = res.StatusCode
-	if strings.Contains(res.Header.Get("Content-Type"), "json") && len(resBody) > 0 {
-		var b any
-		if err := json.Unmarshal(resBody, &b); err != nil {
-			o.Debugf("Failed to unmarshal response body: %s", err.Error())
-			resError = errors.Join(resError, fmt.Errorf("failed to unmarshal response body: %w", err))
+	d[httpStoreBodyKey] = nil
+	if c, ok := findHTTPBodyCodec(res.Header.Get("Content-Type"), rnr.codecs); ok && len(resBody) > 0 {
+		b, err := c.Decode(resBody)
+		if err != nil {
+			o.Debugf("Failed to decode response body: %s", err.Error())
+			resError = errors.Join(resError, fmt.Errorf("failed to decode response body: %w", err))
 		}
 		d[httpStoreBodyKey] = b
-	} else {
-		d[httpStoreBodyKey] = nil
 	}
 	d[httpStoreRawBodyKey] = string(resBody)
-	d[httpStoreHeaderKey] = res.Header
+	if rnr.fixtures.recording() {
+		if r.saveTo == "" {
+			recBody = resBody
+		}
+		if err := rnr.fixtures.recordHTTP(fc, r, req, reqBodyBytes, res, recBody); err != nil {
+			return err
+		}
+	}
+	timing.done()
+	d[httpStoreTimingKey] = timing.toMap()
+	timing.recordProfile(s)
 
 	cookies := res.Cookies()
 
@@ -610,6 +796,11 @@ func (rnr *httpRunner) run(ctx context.Context, r *httpRequest, s *step) error {
 
 		d[httpStoreCookieKey] = keyMap
 		o.recordCookie(cookies)
+		if rnr.cookieJar != nil {
+			if err := rnr.cookieJar.Record(cookies); err != nil {
+				return err
+			}
+		}
 	} else {
 		d[httpStoreCookieKey] = map[string]http.Cookie{}
 	}
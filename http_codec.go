@@ -0,0 +1,449 @@
+package runn
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/goccy/go-json"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/net/html"
+)
+
+const (
+	MediaTypeApplicationXML         = "application/xml"
+	MediaTypeTextXML                = "text/xml"
+	MediaTypeTextHTML               = "text/html"
+	MediaTypeApplicationNDJSON      = "application/x-ndjson"
+	MediaTypeApplicationJSONL       = "application/jsonl"
+	MediaTypeApplicationMsgpack     = "application/msgpack"
+	MediaTypeApplicationCBOR        = "application/cbor"
+	MediaTypeApplicationOctetStream = "application/octet-stream"
+)
+
+const (
+	// xmlAttrPrefix is the prefix of the keys of XML attributes in the decoded body.
+	xmlAttrPrefix = "-"
+	// xmlTextKey is the key of the text of XML elements that have attributes or child elements in the decoded body.
+	xmlTextKey = "#text"
+)
+
+// HTTPBodyCodec encodes request bodies and decodes response bodies of a media type for HTTP runners.
+type HTTPBodyCodec interface {
+	// Encode encodes the value of `body:` in the runbook to the request body.
+	Encode(v any) ([]byte, error)
+	// Decode decodes the response body to the value of `res.body`.
+	Decode(b []byte) (any, error)
+}
+
+type httpBodyCodecFuncs struct {
+	encode func(v any) ([]byte, error)
+	decode func(b []byte) (any, error)
+}
+
+func (c httpBodyCodecFuncs) Encode(v any) ([]byte, error) { //nostyle:recvtype
+	return c.encode(v)
+}
+
+func (c httpBodyCodecFuncs) Decode(b []byte) (any, error) { //nostyle:recvtype
+	return c.decode(b)
+}
+
+var (
+	jsonCodec    = httpBodyCodecFuncs{encode: encodeJSON, decode: decodeJSON}
+	xmlCodec     = httpBodyCodecFuncs{encode: encodeXML, decode: decodeXML}
+	htmlCodec    = httpBodyCodecFuncs{encode: encodeXML, decode: decodeHTML}
+	formCodec    = httpBodyCodecFuncs{encode: encodeForm, decode: decodeForm}
+	ndjsonCodec  = httpBodyCodecFuncs{encode: encodeNDJSON, decode: decodeNDJSON}
+	msgpackCodec = httpBodyCodecFuncs{encode: encodeMsgpack, decode: decodeMsgpack}
+	cborCodec    = httpBodyCodecFuncs{encode: encodeCBOR, decode: decodeCBOR}
+)
+
+// builtinHTTPBodyCodecs is the codecs by media type (without parameters).
+var builtinHTTPBodyCodecs = map[string]HTTPBodyCodec{
+	MediaTypeApplicationJSON:           jsonCodec,
+	MediaTypeApplicationXML:            xmlCodec,
+	MediaTypeTextXML:                   xmlCodec,
+	MediaTypeTextHTML:                  htmlCodec,
+	"application/xhtml+xml":            xmlCodec,
+	MediaTypeApplicationFormUrlencoded: formCodec,
+	MediaTypeApplicationNDJSON:         ndjsonCodec,
+	MediaTypeApplicationJSONL:          ndjsonCodec,
+	"application/x-jsonlines":          ndjsonCodec,
+	MediaTypeApplicationMsgpack:        msgpackCodec,
+	"application/x-msgpack":            msgpackCodec,
+	"application/vnd.msgpack":          msgpackCodec,
+	MediaTypeApplicationCBOR:           cborCodec,
+}
+
+// findHTTPBodyCodec returns the codec for the media type (Content-Type).
+// Codecs set by the runner option take precedence over the built-in codecs.
+func findHTTPBodyCodec(mediaType string, codecs map[string]HTTPBodyCodec) (HTTPBodyCodec, bool) {
+	mt := mediaType
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mt = parsed
+	}
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	if mt == "" {
+		return nil, false
+	}
+	if c, ok := codecs[mt]; ok {
+		return c, true
+	}
+	if c, ok := builtinHTTPBodyCodecs[mt]; ok {
+		return c, true
+	}
+	// Structured syntax suffixes (RFC 6839).
+	switch {
+	case strings.HasSuffix(mt, "+json"):
+		return jsonCodec, true
+	case strings.HasSuffix(mt, "+xml"):
+		return xmlCodec, true
+	case strings.HasSuffix(mt, "+cbor"):
+		return cborCodec, true
+	case strings.HasSuffix(mt, "+msgpack"):
+		return msgpackCodec, true
+	case strings.Contains(mt, "json"):
+		// Keep compatibility with the decoding of responses whose Content-Type contains `json`.
+		return jsonCodec, true
+	}
+	return nil, false
+}
+
+func encodeJSON(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func decodeJSON(b []byte) (any, error) {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func encodeForm(v any) ([]byte, error) {
+	values, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid body: %v", v)
+	}
+	buf := new(bytes.Buffer)
+	if err := form.NewEncoder(buf).Encode(values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeForm decodes the form to map. A key with multiple values is decoded to a slice.
+func decodeForm(b []byte) (any, error) {
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	for k, vs := range values {
+		if len(vs) == 1 {
+			m[k] = vs[0]
+			continue
+		}
+		var s []any
+		for _, v := range vs {
+			s = append(s, v)
+		}
+		m[k] = s
+	}
+	return m, nil
+}
+
+func encodeNDJSON(v any) ([]byte, error) {
+	s, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid body: %v", v)
+	}
+	buf := new(bytes.Buffer)
+	for _, vv := range s {
+		b, err := json.Marshal(vv)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeNDJSON decodes newline delimited JSON to a slice of the values. Empty lines are ignored.
+func decodeNDJSON(b []byte) (any, error) {
+	s := []any{}
+	for l := range bytes.Lines(b) {
+		l = bytes.TrimSpace(l)
+		if len(l) == 0 {
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(l, &v); err != nil {
+			return nil, err
+		}
+		s = append(s, v)
+	}
+	return s, nil
+}
+
+func encodeMsgpack(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func decodeMsgpack(b []byte) (any, error) {
+	var v any
+	if err := msgpack.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return normalizeDecoded(v), nil
+}
+
+func encodeCBOR(v any) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func decodeCBOR(b []byte) (any, error) {
+	var v any
+	if err := cbor.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return normalizeDecoded(v), nil
+}
+
+// normalizeDecoded normalizes the decoded value of binary formats to the same types as JSON (map[string]any and float64).
+func normalizeDecoded(v any) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, e := range vv {
+			vv[k] = normalizeDecoded(e)
+		}
+		return vv
+	case map[any]any:
+		m := make(map[string]any, len(vv))
+		for k, e := range vv {
+			m[fmt.Sprint(k)] = normalizeDecoded(e)
+		}
+		return m
+	case []any:
+		for i, e := range vv {
+			vv[i] = normalizeDecoded(e)
+		}
+		return vv
+	case int:
+		return float64(vv)
+	case int8:
+		return float64(vv)
+	case int16:
+		return float64(vv)
+	case int32:
+		return float64(vv)
+	case int64:
+		return float64(vv)
+	case uint:
+		return float64(vv)
+	case uint8:
+		return float64(vv)
+	case uint16:
+		return float64(vv)
+	case uint32:
+		return float64(vv)
+	case uint64:
+		return float64(vv)
+	case float32:
+		return float64(vv)
+	default:
+		return v
+	}
+}
+
+// xmlNode is the element of XML and HTML documents.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// decodeXML decodes the XML document to map.
+// The element is decoded to the text if it has neither attributes nor child elements.
+// Otherwise it is decoded to map whose keys are the names of the attributes (prefixed with "-"), the child elements and "#text".
+// Child elements with the same name are decoded to a slice.
+func decodeXML(b []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		cur := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: t.Attr}
+			cur.children = append(cur.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			cur.text.Write(t)
+		}
+	}
+	return root.toMap(), nil
+}
+
+// decodeHTML decodes the HTML document to map in the same way as decodeXML.
+func decodeHTML(b []byte) (any, error) {
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	root := &xmlNode{}
+	var walk func(hn *html.Node, n *xmlNode)
+	walk = func(hn *html.Node, n *xmlNode) {
+		for c := hn.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Type {
+			case html.ElementNode:
+				cn := &xmlNode{name: c.Data}
+				for _, a := range c.Attr {
+					cn.attrs = append(cn.attrs, xml.Attr{Name: xml.Name{Local: a.Key}, Value: a.Val})
+				}
+				n.children = append(n.children, cn)
+				walk(c, cn)
+			case html.TextNode:
+				n.text.WriteString(c.Data)
+			}
+		}
+	}
+	walk(doc, root)
+	return root.toMap(), nil
+}
+
+func (n *xmlNode) toMap() map[string]any {
+	m := map[string]any{}
+	for _, c := range n.children {
+		v := c.value()
+		switch e := m[c.name].(type) {
+		case nil:
+			m[c.name] = v
+		case []any:
+			m[c.name] = append(e, v)
+		default:
+			m[c.name] = []any{e, v}
+		}
+	}
+	return m
+}
+
+func (n *xmlNode) value() any {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		return text
+	}
+	m := n.toMap()
+	for _, a := range n.attrs {
+		m[xmlAttrPrefix+a.Name.Local] = a.Value
+	}
+	if text != "" {
+		m[xmlTextKey] = text
+	}
+	return m
+}
+
+// encodeXML encodes the value to the XML document in the reverse way of decodeXML.
+// The string is encoded as it is.
+func encodeXML(v any) ([]byte, error) {
+	switch vv := v.(type) {
+	case string:
+		return []byte(vv), nil
+	case map[string]any:
+		buf := new(bytes.Buffer)
+		enc := xml.NewEncoder(buf)
+		for _, k := range sortedKeys(vv) {
+			if err := encodeXMLElement(enc, k, vv[k]); err != nil {
+				return nil, err
+			}
+		}
+		if err := enc.Flush(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("invalid body: %v", v)
+	}
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, v any) error {
+	if s, ok := v.([]any); ok {
+		for _, e := range s {
+			if err := encodeXMLElement(enc, name, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	m, ok := v.(map[string]any)
+	if !ok {
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if v != nil {
+			if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+	keys := sortedKeys(m)
+	for _, k := range keys {
+		if strings.HasPrefix(k, xmlAttrPrefix) {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: strings.TrimPrefix(k, xmlAttrPrefix)}, Value: fmt.Sprint(m[k])})
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if t, ok := m[xmlTextKey]; ok {
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(t))); err != nil {
+			return err
+		}
+	}
+	for _, k := range keys {
+		if k == xmlTextKey || strings.HasPrefix(k, xmlAttrPrefix) {
+			continue
+		}
+		if err := encodeXMLElement(enc, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,221 @@
+package runn
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestHTTPBodyCodecDecode(t *testing.T) {
+	msgpackBody, err := msgpack.Marshal(map[string]any{"id": 1, "tags": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborBody, err := cbor.Marshal(map[string]any{"id": 1, "tags": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		contentType string
+		body        []byte
+		want        any
+	}{
+		{"application/json", []byte(`{"id":1}`), map[string]any{"id": float64(1)}},
+		{"application/problem+json; charset=utf-8", []byte(`{"id":1}`), map[string]any{"id": float64(1)}},
+		{
+			"application/xml; charset=utf-8",
+			[]byte(`<?xml version="1.0"?><user id="1"><name>alice</name><tag>a</tag><tag>b</tag><empty/></user>`),
+			map[string]any{"user": map[string]any{"-id": "1", "name": "alice", "tag": []any{"a", "b"}, "empty": ""}},
+		},
+		{
+			"text/xml",
+			[]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Result>ok</Result></soap:Body></soap:Envelope>`),
+			map[string]any{"Envelope": map[string]any{"-soap": "http://schemas.xmlsoap.org/soap/envelope/", "Body": map[string]any{"Result": "ok"}}},
+		},
+		{
+			"text/html",
+			[]byte(`<html><head><title>Hello</title></head><body><p class="msg">hi <b>you</b></p></body></html>`),
+			map[string]any{"html": map[string]any{
+				"head": map[string]any{"title": "Hello"},
+				"body": map[string]any{"p": map[string]any{"-class": "msg", "#text": "hi", "b": "you"}},
+			}},
+		},
+		{"application/x-www-form-urlencoded", []byte(`name=alice&tag=a&tag=b`), map[string]any{"name": "alice", "tag": []any{"a", "b"}}},
+		{"application/x-ndjson", []byte("{\"id\":1}\n\n{\"id\":2}\n"), []any{map[string]any{"id": float64(1)}, map[string]any{"id": float64(2)}}},
+		{"application/msgpack", msgpackBody, map[string]any{"id": float64(1), "tags": []any{"a", "b"}}},
+		{"application/cbor", cborBody, map[string]any{"id": float64(1), "tags": []any{"a", "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			c, ok := findHTTPBodyCodec(tt.contentType, nil)
+			if !ok {
+				t.Fatalf("codec not found: %s", tt.contentType)
+			}
+			got, err := c.Decode(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestHTTPBodyCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		body      any
+	}{
+		{"application/json", map[string]any{"id": float64(1)}},
+		{"application/xml", map[string]any{"user": map[string]any{"-id": "1", "name": "alice", "tag": []any{"a", "b"}}}},
+		{"application/x-www-form-urlencoded", map[string]any{"name": "alice"}},
+		{"application/x-ndjson", []any{map[string]any{"id": float64(1)}, map[string]any{"id": float64(2)}}},
+		{"application/msgpack", map[string]any{"id": float64(1), "tags": []any{"a", "b"}}},
+		{"application/cbor", map[string]any{"id": float64(1), "tags": []any{"a", "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			r := &httpRequest{mediaType: tt.mediaType, body: tt.body}
+			rd, err := r.encodeBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, ok := findHTTPBodyCodec(tt.mediaType, nil)
+			if !ok {
+				t.Fatalf("codec not found: %s", tt.mediaType)
+			}
+			got, err := c.Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.body, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestEncodeRawBody(t *testing.T) {
+	tests := []struct {
+		mediaType string
+		body      any
+		want      []byte
+	}{
+		{"application/octet-stream", []any{uint64(1), uint64(2), uint64(300)}, []byte{0x01, 0x02, 0x2c}},
+		{"application/octet-stream", "raw", []byte("raw")},
+		{"image/png", []byte{0x89, 0x50, 0x4e, 0x47}, []byte{0x89, 0x50, 0x4e, 0x47}},
+		{"application/vnd.custom", `{"id":1}`, []byte(`{"id":1}`)},
+		// Media types with codecs encode strings by the codecs
+		{"application/json", `{"id":1}`, []byte(`"{\"id\":1}"`)},
+		{"application/vnd.api+json", `{"id":1}`, []byte(`"{\"id\":1}"`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			r := &httpRequest{mediaType: tt.mediaType, body: tt.body}
+			rd, err := r.encodeBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	// A list of integers is not a list of bytes for media types other than application/octet-stream
+	r := &httpRequest{mediaType: "image/png", body: []any{uint64(1), uint64(2), uint64(300)}}
+	if _, err := r.encodeBody(); err == nil {
+		t.Error("want error")
+	}
+}
+
+func TestEncodeIntegerListBody(t *testing.T) {
+	body := []any{uint64(1), uint64(2), uint64(300)}
+	tests := []struct {
+		mediaType string
+		want      any
+	}{
+		{"application/json", []any{float64(1), float64(2), float64(300)}},
+		{"application/x-ndjson", []any{float64(1), float64(2), float64(300)}},
+		{"application/msgpack", []any{float64(1), float64(2), float64(300)}},
+		{"application/cbor", []any{float64(1), float64(2), float64(300)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			r := &httpRequest{mediaType: tt.mediaType, body: body}
+			rd, err := r.encodeBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, ok := findHTTPBodyCodec(tt.mediaType, nil)
+			if !ok {
+				t.Fatalf("codec not found: %s", tt.mediaType)
+			}
+			got, err := c.Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestHTTPCodec(t *testing.T) {
+	ctx := context.Background()
+	codec := httpBodyCodecFuncs{
+		encode: func(v any) ([]byte, error) { return []byte("encoded"), nil },
+		decode: func(b []byte) (any, error) { return map[string]any{"decoded": string(b)}, nil },
+	}
+	s := http.NewServeMux()
+	s.HandleFunc("/custom", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/vnd.custom")
+		_, _ = w.Write(b)
+	})
+	o, err := New(HTTPRunnerWithHandler("req", s, HTTPCodec("application/vnd.custom", codec)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &httpRequest{
+		path:      "/custom",
+		method:    http.MethodPost,
+		mediaType: "application/vnd.custom",
+		body:      map[string]any{"key": "value"},
+	}
+	step := newStep(0, "stepKey", o, nil)
+	if err := o.httpRunners["req"].run(ctx, req, step); err != nil {
+		t.Fatal(err)
+	}
+	sl, ok := o.store.ToMap()["steps"].([]map[string]any)
+	if !ok {
+		t.Fatal("steps not found")
+	}
+	res, ok := sl[0]["res"].(map[string]any)
+	if !ok {
+		t.Fatalf("invalid steps res: %v", sl[0]["res"])
+	}
+	want := map[string]any{"decoded": "encoded"}
+	if diff := cmp.Diff(want, res["body"]); diff != "" {
+		t.Error(diff)
+	}
+}
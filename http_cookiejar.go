@@ -0,0 +1,405 @@
+package runn
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+)
+
+const (
+	cookieJarFormatNetscape = "netscape"
+	cookieJarFormatJSON     = "json"
+
+	netscapeHTTPOnlyPrefix = "#HttpOnly_"
+)
+
+// cookieJar loads cookies of HTTP runners from the file and saves them to the file to persist them across runs.
+// The file is read at every access, so the changes of the file (e.g. by other runbooks or processes) are always reflected.
+// The cookies are keyed by domain and cookie name in the same way as the cookies in the store.
+// Domains starting with "." match their subdomains (see httpRequest.setCookieHeader).
+type cookieJar struct {
+	path   string
+	format string
+	mu     *sync.Mutex
+}
+
+// cookieJarCookie is the cookie in the JSON format exported by browser extensions (e.g. Cookie-Editor).
+type cookieJarCookie struct {
+	Domain         string  `json:"domain"`
+	ExpirationDate float64 `json:"expirationDate,omitempty"`
+	HostOnly       bool    `json:"hostOnly"`
+	HTTPOnly       bool    `json:"httpOnly"`
+	Name           string  `json:"name"`
+	Path           string  `json:"path"`
+	SameSite       string  `json:"sameSite,omitempty"`
+	Secure         bool    `json:"secure"`
+	Session        bool    `json:"session"`
+	Value          string  `json:"value"`
+}
+
+// cookieJarLocks - Locks of the cookie jar files shared by the runners of all runbooks, keyed by the absolute path.
+// They serialize reading and writing the same file in the process.
+var cookieJarLocks sync.Map
+
+// openCookieJar returns the cookie jar of the file.
+// The format is JSON if the extension is .json, otherwise Netscape cookies.txt.
+func openCookieJar(p string) (*cookieJar, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	format := cookieJarFormatNetscape
+	if strings.EqualFold(filepath.Ext(abs), ".json") {
+		format = cookieJarFormatJSON
+	}
+	mu, _ := cookieJarLocks.LoadOrStore(abs, &sync.Mutex{})
+	return &cookieJar{
+		path:   abs,
+		format: format,
+		mu:     mu.(*sync.Mutex),
+	}, nil
+}
+
+// setCookieJar sets the cookie jar of the file to the runner.
+// Sending cookies is enabled unless useCookie is set explicitly.
+func (rnr *httpRunner) setCookieJar(p string) error {
+	j, err := openCookieJar(p)
+	if err != nil {
+		return err
+	}
+	rnr.cookieJar = j
+	if rnr.useCookie == nil {
+		useCookie := true
+		rnr.useCookie = &useCookie
+	}
+	return nil
+}
+
+// Cookies returns the unexpired cookies in the jar.
+// The domains in the jar have no port number, so the cookies for the host of the endpoint are keyed by host (host:port)
+// in the same way as the cookies received from the endpoint.
+func (j *cookieJar) Cookies(host string) (map[string]map[string]*http.Cookie, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	loaded, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cookies := map[string]map[string]*http.Cookie{}
+	for domain, domainCookies := range loaded {
+		for name, c := range domainCookies {
+			if !c.Expires.IsZero() && c.Expires.Before(now) {
+				continue
+			}
+			key := domain
+			if host != "" && domain == stripCookieDomainPort(host) {
+				key = host
+			}
+			if _, ok := cookies[key]; !ok {
+				cookies[key] = map[string]*http.Cookie{}
+			}
+			cc := cloneHTTPCookie(c)
+			cc.Domain = key
+			cookies[key][name] = cc
+		}
+	}
+	return cookies, nil
+}
+
+// Record records the cookies received by the runner and saves the jar to the file.
+func (j *cookieJar) Record(cookies []*http.Cookie) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jarCookies, err := j.load()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, c := range cookies {
+		domain := stripCookieDomainPort(c.Domain)
+		if domain == "" {
+			domain = "localhost"
+		}
+		if _, ok := jarCookies[domain]; !ok {
+			jarCookies[domain] = map[string]*http.Cookie{}
+		}
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			// Remove expired cookie
+			delete(jarCookies[domain], c.Name)
+			continue
+		}
+		cc := cloneHTTPCookie(c)
+		cc.Domain = domain
+		if c.MaxAge > 0 {
+			cc.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+			cc.MaxAge = 0
+		}
+		jarCookies[domain][c.Name] = cc
+	}
+	return j.save(jarCookies)
+}
+
+// load reads the cookies from the file.
+func (j *cookieJar) load() (map[string]map[string]*http.Cookie, error) {
+	jarCookies := map[string]map[string]*http.Cookie{}
+	b, err := os.ReadFile(j.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return jarCookies, nil
+	}
+	var cookies []*http.Cookie
+	switch j.format {
+	case cookieJarFormatJSON:
+		cookies, err = parseJSONCookies(b)
+	default:
+		cookies, err = parseNetscapeCookies(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie jar %s: %w", j.path, err)
+	}
+	for _, c := range cookies {
+		if _, ok := jarCookies[c.Domain]; !ok {
+			jarCookies[c.Domain] = map[string]*http.Cookie{}
+		}
+		jarCookies[c.Domain][c.Name] = c
+	}
+	return jarCookies, nil
+}
+
+// save writes the cookies to the file.
+func (j *cookieJar) save(jarCookies map[string]map[string]*http.Cookie) error {
+	var cookies []*http.Cookie
+	for _, domainCookies := range jarCookies {
+		for _, c := range domainCookies {
+			cookies = append(cookies, c)
+		}
+	}
+	slices.SortFunc(cookies, func(a, b *http.Cookie) int {
+		if c := strings.Compare(a.Domain, b.Domain); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	var (
+		b   []byte
+		err error
+	)
+	switch j.format {
+	case cookieJarFormatJSON:
+		b, err = formatJSONCookies(cookies)
+	default:
+		b = formatNetscapeCookies(cookies)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(j.path, b, 0o600)
+}
+
+// writeFileAtomic writes the data to the temporary file in the same directory and renames it to the path,
+// so that the file is never left truncated by a crash or a concurrent write.
+func writeFileAtomic(p string, b []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// parseNetscapeCookies parses cookies in the Netscape cookies.txt format (curl, wget and browser extensions).
+func parseNetscapeCookies(b []byte) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimRight(sc.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, netscapeHTTPOnlyPrefix) {
+			httpOnly = true
+			line = strings.TrimPrefix(line, netscapeHTTPOnlyPrefix)
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: invalid number of fields: %d", n, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiration: %w", n, err)
+		}
+		c := &http.Cookie{
+			Domain:   cookieJarDomain(fields[0], strings.EqualFold(fields[1], "TRUE")),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+func formatNetscapeCookies(cookies []*http.Cookie) []byte {
+	buf := new(bytes.Buffer)
+	_, _ = buf.WriteString("# Netscape HTTP Cookie File\n# This file was generated by runn. Edit at your own risk.\n\n")
+	for _, c := range cookies {
+		domain := stripCookieDomainPort(c.Domain)
+		if c.HttpOnly {
+			domain = netscapeHTTPOnlyPrefix + domain
+		}
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		_, _ = fmt.Fprintf(buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, netscapeBool(strings.HasPrefix(c.Domain, ".")), path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+	}
+	return buf.Bytes()
+}
+
+func parseJSONCookies(b []byte) ([]*http.Cookie, error) {
+	var jcs []*cookieJarCookie
+	if err := json.Unmarshal(b, &jcs); err != nil {
+		return nil, err
+	}
+	cookies := make([]*http.Cookie, 0, len(jcs))
+	for _, jc := range jcs {
+		c := &http.Cookie{
+			Domain:   cookieJarDomain(jc.Domain, !jc.HostOnly),
+			Path:     jc.Path,
+			Secure:   jc.Secure,
+			Name:     jc.Name,
+			Value:    jc.Value,
+			HttpOnly: jc.HTTPOnly,
+		}
+		if !jc.Session && jc.ExpirationDate > 0 {
+			sec, frac := math.Modf(jc.ExpirationDate)
+			c.Expires = time.Unix(int64(sec), int64(frac*float64(time.Second)))
+		}
+		switch strings.ToLower(jc.SameSite) {
+		case "lax":
+			c.SameSite = http.SameSiteLaxMode
+		case "strict":
+			c.SameSite = http.SameSiteStrictMode
+		case "no_restriction", "none":
+			c.SameSite = http.SameSiteNoneMode
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, nil
+}
+
+func formatJSONCookies(cookies []*http.Cookie) ([]byte, error) {
+	jcs := make([]*cookieJarCookie, 0, len(cookies))
+	for _, c := range cookies {
+		jc := &cookieJarCookie{
+			Domain:   stripCookieDomainPort(c.Domain),
+			HostOnly: !strings.HasPrefix(c.Domain, "."),
+			HTTPOnly: c.HttpOnly,
+			Name:     c.Name,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			Session:  c.Expires.IsZero(),
+			Value:    c.Value,
+		}
+		if jc.Path == "" {
+			jc.Path = "/"
+		}
+		if !c.Expires.IsZero() {
+			jc.ExpirationDate = float64(c.Expires.Unix())
+		}
+		switch c.SameSite {
+		case http.SameSiteLaxMode:
+			jc.SameSite = "lax"
+		case http.SameSiteStrictMode:
+			jc.SameSite = "strict"
+		case http.SameSiteNoneMode:
+			jc.SameSite = "no_restriction"
+		}
+		jcs = append(jcs, jc)
+	}
+	return json.MarshalIndent(jcs, "", "  ")
+}
+
+// cookieJarDomain returns the domain of the cookie as the key of the store.
+func cookieJarDomain(domain string, includeSubdomains bool) string {
+	domain = strings.TrimPrefix(domain, ".")
+	if includeSubdomains {
+		return "." + domain
+	}
+	return domain
+}
+
+// stripCookieDomainPort strips the port number of the domain that is taken over from the endpoint.
+func stripCookieDomainPort(domain string) string {
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		return h
+	}
+	return domain
+}
+
+func netscapeBool(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func cloneHTTPCookie(c *http.Cookie) *http.Cookie {
+	cc := *c
+	return &cc
+}
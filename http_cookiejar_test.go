@@ -0,0 +1,154 @@
+package runn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCookieJar(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "logged-in", Path: "/", MaxAge: 3600, HttpOnly: true})
+			w.WriteHeader(http.StatusOK)
+		case "/me":
+			c, err := r.Cookie("session")
+			if err != nil || c.Value != "logged-in" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	for _, name := range []string{"cookies.txt", "cookies.json"} {
+		t.Run(name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), name)
+			var last *operator
+			run := func(path string) int {
+				t.Helper()
+				o, err := New(HTTPRunner("req", ts.URL, ts.Client()), CookieJar(p))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req := &httpRequest{path: path, method: http.MethodGet}
+				if err := o.httpRunners["req"].run(context.Background(), req, newStep(0, "stepKey", o, nil)); err != nil {
+					t.Fatal(err)
+				}
+				last = o
+				return o.store.Latest()["res"].(map[string]any)["status"].(int)
+			}
+			host := ts.Listener.Addr().String()
+			if got := run("/login"); got != http.StatusOK {
+				t.Fatalf("got %v", got)
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), "logged-in") {
+				t.Errorf("cookie is not saved: %s", b)
+			}
+			if strings.Contains(string(b), host) {
+				t.Errorf("the port number is saved in the domain: %s", b)
+			}
+			if got := run("/me"); got != http.StatusOK {
+				t.Errorf("got %v want %v", got, http.StatusOK)
+			}
+			// The cookies loaded from the jar are keyed by host:port in the store in the same way as without the jar.
+			cookies := last.store.Cookies()
+			if _, ok := cookies[host]["session"]; !ok {
+				t.Errorf("cookies[%q] not found: %v", host, cookies)
+			}
+			if len(cookies) != 1 {
+				t.Errorf("got %d domains, want 1: %v", len(cookies), cookies)
+			}
+			entries, err := os.ReadDir(filepath.Dir(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("temporary files are left: %v", entries)
+			}
+
+			// The changes of the file are reflected in the same process.
+			if err := os.Remove(p); err != nil {
+				t.Fatal(err)
+			}
+			if got := run("/me"); got != http.StatusUnauthorized {
+				t.Errorf("got %v want %v", got, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestParseNetscapeCookies(t *testing.T) {
+	in := `# Netscape HTTP Cookie File
+# https://curl.se/docs/http-cookies.html
+
+.example.com	TRUE	/	TRUE	2000000000	id	abc
+#HttpOnly_api.example.com	FALSE	/v1	FALSE	0	session	xyz
+`
+	got, err := parseNetscapeCookies([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*http.Cookie{
+		{Domain: ".example.com", Path: "/", Secure: true, Expires: time.Unix(2000000000, 0), Name: "id", Value: "abc"},
+		{Domain: "api.example.com", Path: "/v1", HttpOnly: true, Name: "session", Value: "xyz"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+
+	reparsed, err := parseNetscapeCookies(formatNetscapeCookies(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, reparsed); diff != "" {
+		t.Error(diff)
+	}
+
+	if _, err := parseNetscapeCookies([]byte("example.com\tFALSE\t/\n")); err == nil {
+		t.Error("want error")
+	}
+}
+
+func TestParseJSONCookies(t *testing.T) {
+	in := `[
+  {"domain": ".example.com", "expirationDate": 2000000000, "hostOnly": false, "httpOnly": false, "name": "id", "path": "/", "sameSite": "lax", "secure": true, "session": false, "value": "abc"},
+  {"domain": "api.example.com", "hostOnly": true, "httpOnly": true, "name": "session", "path": "/v1", "secure": false, "session": true, "value": "xyz"}
+]`
+	got, err := parseJSONCookies([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*http.Cookie{
+		{Domain: ".example.com", Path: "/", Secure: true, Expires: time.Unix(2000000000, 0), SameSite: http.SameSiteLaxMode, Name: "id", Value: "abc"},
+		{Domain: "api.example.com", Path: "/v1", HttpOnly: true, Name: "session", Value: "xyz"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+
+	b, err := formatJSONCookies(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := parseJSONCookies(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, reparsed); diff != "" {
+		t.Error(diff)
+	}
+}
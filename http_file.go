@@ -0,0 +1,183 @@
+package runn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	internalfs "github.com/k1LoW/runn/internal/fs"
+)
+
+const (
+	httpStoreFileKey = "file"
+
+	httpFileSizeKey        = "size"
+	httpFileContentTypeKey = "contentType"
+	httpFileSha256Key      = "sha256"
+	httpFilePathKey        = "path"
+)
+
+// sizedBody is the request body with the known size that streams files instead of reading them into memory.
+type sizedBody struct {
+	io.Reader
+	size    int64
+	parts   []*sizedBodyPart
+	closers []io.Closer
+}
+
+// sizedBodyPart is the bytes or the file of the part of sizedBody.
+type sizedBodyPart struct {
+	b    []byte
+	path string
+}
+
+// sizedBodyBuilder builds sizedBody. The bytes written to the builder (e.g. by multipart.Writer) are the parts between files.
+type sizedBodyBuilder struct {
+	parts []*sizedBodyPart
+	buf   bytes.Buffer
+}
+
+func (b *sizedBodyBuilder) Write(p []byte) (int, error) {
+	return b.buf.Write(p)
+}
+
+func (b *sizedBodyBuilder) addFile(p string) {
+	b.flush()
+	b.parts = append(b.parts, &sizedBodyPart{path: p})
+}
+
+func (b *sizedBodyBuilder) flush() {
+	if b.buf.Len() == 0 {
+		return
+	}
+	b.parts = append(b.parts, &sizedBodyPart{b: bytes.Clone(b.buf.Bytes())})
+	b.buf.Reset()
+}
+
+func (b *sizedBodyBuilder) open() (*sizedBody, error) {
+	b.flush()
+	return openSizedBody(b.parts)
+}
+
+func openSizedBody(parts []*sizedBodyPart) (*sizedBody, error) {
+	sb := &sizedBody{parts: parts}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		if p.path == "" {
+			readers = append(readers, bytes.NewReader(p.b))
+			sb.size += int64(len(p.b))
+			continue
+		}
+		f, size, err := internalfs.Open(p.path)
+		if err != nil {
+			_ = sb.Close()
+			return nil, err
+		}
+		readers = append(readers, f)
+		sb.closers = append(sb.closers, f)
+		sb.size += size
+	}
+	sb.Reader = io.MultiReader(readers...)
+	return sb, nil
+}
+
+// Close closes the files of the body.
+func (b *sizedBody) Close() error {
+	var err error
+	for _, c := range b.closers {
+		err = errors.Join(err, c.Close())
+	}
+	b.closers = nil
+	return err
+}
+
+// setSizedBody sets the size of the request body streamed from files and the function to open the files again (e.g. for redirects).
+func setSizedBody(req *http.Request, body io.Reader) {
+	sb, ok := body.(*sizedBody)
+	if !ok {
+		return
+	}
+	req.ContentLength = sb.size
+	req.GetBody = func() (io.ReadCloser, error) {
+		return openSizedBody(sb.parts)
+	}
+}
+
+// detectFileContentType detects the content type of the file by reading the beginning of the file.
+func detectFileContentType(p string) (string, error) {
+	f, _, err := internalfs.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// saveBody writes the response body to the file without reading it into memory.
+// The body is written to the temporary file in the same directory and renamed to the path on success,
+// so that a partial body is never left at the path.
+// It returns the size, the content type and the SHA-256 hash of the body to be recorded instead of the body.
+func (rnr *httpRunner) saveBody(res *http.Response, p string, o *operator) (_ map[string]any, err error) {
+	p, err = internalfs.Path(p, o.root)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(p, "://") {
+		return nil, fmt.Errorf("saveTo should be the path of the local file: %s", p)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	var body io.Reader = res.Body
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		body = gr
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), body)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		httpFilePathKey:        p,
+		httpFileSizeKey:        size,
+		httpFileContentTypeKey: res.Header.Get("Content-Type"),
+		httpFileSha256Key:      hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
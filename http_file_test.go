@@ -0,0 +1,162 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/k1LoW/runn/internal/scope"
+)
+
+func TestHTTPRunnerUploadFile(t *testing.T) {
+	dummy, err := os.ReadFile("testdata/dummy.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		gotLength int64
+		gotBody   []byte
+		gotPart   []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLength = r.ContentLength
+		switch r.URL.Path {
+		case "/upload":
+			gotBody, _ = io.ReadAll(r.Body)
+		case "/multipart":
+			f, _, err := r.FormFile("upload")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			gotPart, _ = io.ReadAll(f)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	o, err := New(HTTPRunner("req", ts.URL, ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("file", func(t *testing.T) {
+		req := &httpRequest{
+			path:      "/upload",
+			method:    http.MethodPut,
+			mediaType: "application/octet-stream",
+			body:      map[string]any{"filename": "testdata/dummy.png"},
+		}
+		if err := o.httpRunners["req"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if gotLength != int64(len(dummy)) {
+			t.Errorf("got %v want %v", gotLength, len(dummy))
+		}
+		if !bytes.Equal(gotBody, dummy) {
+			t.Error("body is not uploaded")
+		}
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		req := &httpRequest{
+			path:      "/multipart",
+			method:    http.MethodPost,
+			mediaType: MediaTypeMultipartFormData,
+			body:      map[string]any{"upload": "testdata/dummy.png", "name": "dummy"},
+		}
+		if err := o.httpRunners["req"].run(ctx, req, newStep(1, "stepKey", o, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if gotLength <= int64(len(dummy)) {
+			t.Errorf("got %v", gotLength)
+		}
+		if !bytes.Equal(gotPart, dummy) {
+			t.Error("file is not uploaded")
+		}
+	})
+}
+
+func TestHTTPRunnerSaveTo(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(payload)
+	}))
+	t.Cleanup(ts.Close)
+	// The relative path is resolved against the root of the runbook (the working directory without the book path).
+	dir := t.TempDir()
+	t.Chdir(dir)
+	o, err := New(HTTPRunner("req", ts.URL, ts.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "artifacts", "payload.bin")
+	req := &httpRequest{
+		path:   "/artifact",
+		method: http.MethodGet,
+		saveTo: filepath.Join("artifacts", "payload.bin"),
+	}
+	if err := o.httpRunners["req"].run(context.Background(), req, newStep(0, "stepKey", o, nil)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("body is not saved")
+	}
+	res := o.store.Latest()["res"].(map[string]any)
+	if res["body"] != nil || res["rawBody"] != "" {
+		t.Errorf("body should not be recorded: %v", res["body"])
+	}
+	sum := sha256.Sum256(payload)
+	f := res["file"].(map[string]any)
+	if f["size"] != int64(len(payload)) {
+		t.Errorf("got %v want %v", f["size"], len(payload))
+	}
+	if f["sha256"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("got %v", f["sha256"])
+	}
+	if f["contentType"] != "application/octet-stream" {
+		t.Errorf("got %v", f["contentType"])
+	}
+}
+
+func TestHTTPRunnerSaveToPartialBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The connection is closed before the declared length of the body is sent.
+		w.Header().Set("Content-Length", "1024")
+		_, _ = w.Write([]byte("partial"))
+	}))
+	t.Cleanup(ts.Close)
+	o, err := New(HTTPRunner("req", ts.URL, ts.Client()), Scopes(scope.AllowReadParent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	p := filepath.Join(dir, "payload.bin")
+	req := &httpRequest{
+		path:   "/artifact",
+		method: http.MethodGet,
+		saveTo: p,
+	}
+	if err := o.httpRunners["req"].run(context.Background(), req, newStep(0, "stepKey", o, nil)); err == nil {
+		t.Fatal("want error")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("partial files are left: %v", entries)
+	}
+}
@@ -0,0 +1,64 @@
+package runn
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+const (
+	httpProtocolHTTP1 = "http1"
+	httpProtocolH2    = "h2"
+	httpProtocolH2C   = "h2c"
+	httpProtocolH3    = "h3"
+)
+
+const httpStoreProtoKey = "proto"
+
+func validateHTTPProtocol(p string) error {
+	switch p {
+	case "", httpProtocolHTTP1, httpProtocolH2, httpProtocolH2C, httpProtocolH3:
+		return nil
+	default:
+		return fmt.Errorf("invalid protocol: %q (should be %q, %q, %q or %q)", p, httpProtocolHTTP1, httpProtocolH2, httpProtocolH2C, httpProtocolH3)
+	}
+}
+
+// configureProtocol configures the transport of the client for the protocol.
+// If the protocol is not set, HTTP/1.1 or HTTP/2 is negotiated as usual.
+func (rnr *httpRunner) configureProtocol(ts *http.Transport) error {
+	switch rnr.protocol {
+	case "":
+		return nil
+	case httpProtocolHTTP1:
+		ts.Protocols = new(http.Protocols)
+		ts.Protocols.SetHTTP1(true)
+		// NextProtos may have been set by the transport that has already been used.
+		ts.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	case httpProtocolH2:
+		if rnr.endpoint.Scheme != "https" {
+			return fmt.Errorf("protocol %q requires the https endpoint: %s", rnr.protocol, rnr.endpoint)
+		}
+		ts.Protocols = new(http.Protocols)
+		ts.Protocols.SetHTTP2(true)
+		ts.TLSClientConfig.NextProtos = []string{"h2"}
+	case httpProtocolH2C:
+		if rnr.endpoint.Scheme != "http" {
+			return fmt.Errorf("protocol %q requires the http endpoint: %s", rnr.protocol, rnr.endpoint)
+		}
+		ts.Protocols = new(http.Protocols)
+		ts.Protocols.SetUnencryptedHTTP2(true)
+	case httpProtocolH3:
+		if rnr.endpoint.Scheme != "https" {
+			return fmt.Errorf("protocol %q requires the https endpoint: %s", rnr.protocol, rnr.endpoint)
+		}
+		rnr.client.Transport = &http3.Transport{
+			TLSClientConfig:    ts.TLSClientConfig,
+			DisableCompression: ts.DisableCompression,
+		}
+	default:
+		return validateHTTPProtocol(rnr.protocol)
+	}
+	return nil
+}
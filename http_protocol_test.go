@@ -0,0 +1,120 @@
+package runn
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTPRunnerProtocol(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, r.Proto)
+	})
+
+	plain := httptest.NewUnstartedServer(h)
+	plain.Config.Protocols = new(http.Protocols)
+	plain.Config.Protocols.SetHTTP1(true)
+	plain.Config.Protocols.SetUnencryptedHTTP2(true)
+	plain.Start()
+	t.Cleanup(plain.Close)
+
+	secure := httptest.NewUnstartedServer(h)
+	secure.EnableHTTP2 = true
+	secure.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}, MinVersion: tls.VersionTLS12}
+	secure.StartTLS()
+	t.Cleanup(secure.Close)
+
+	h3 := newTestHTTP3Server(t, h)
+
+	tests := []struct {
+		protocol string
+		endpoint string
+		want     string
+	}{
+		{"", plain.URL, "HTTP/1.1"},
+		{httpProtocolHTTP1, plain.URL, "HTTP/1.1"},
+		{httpProtocolH2C, plain.URL, "HTTP/2.0"},
+		{httpProtocolHTTP1, secure.URL, "HTTP/1.1"},
+		{httpProtocolH2, secure.URL, "HTTP/2.0"},
+		{httpProtocolH3, h3, "HTTP/3.0"},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.protocol, tt.endpoint), func(t *testing.T) {
+			client := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone(), Timeout: 10 * time.Second}
+			o, err := New(HTTPRunner("req", tt.endpoint, client, HTTPProtocol(tt.protocol), HTTPSkipVerify(true)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := &httpRequest{path: "/", method: http.MethodGet}
+			if err := o.httpRunners["req"].run(ctx, req, newStep(0, "stepKey", o, nil)); err != nil {
+				t.Fatal(err)
+			}
+			res := o.store.Latest()["res"].(map[string]any)
+			if got := res["proto"]; got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := res["rawBody"]; got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPRunnerProtocolError(t *testing.T) {
+	tests := []struct {
+		protocol string
+		endpoint string
+	}{
+		{httpProtocolH2, "http://example.com"},
+		{httpProtocolH2C, "https://example.com"},
+		{httpProtocolH3, "http://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			client := &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+			if _, err := New(HTTPRunner("req", tt.endpoint, client, HTTPProtocol(tt.protocol))); err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+
+	if _, err := New(HTTPRunner("req", "http://example.com", nil, HTTPProtocol("h4"))); err == nil {
+		t.Error("want error")
+	}
+}
+
+// newTestHTTP3Server starts the HTTP/3 server and returns its URL.
+func newTestHTTP3Server(t *testing.T, h http.Handler) string {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair("testdata/cert.pem", "testdata/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http3.Server{
+		Handler: h,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS13,
+		}),
+	}
+	go func() {
+		_ = srv.Serve(conn)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		_ = conn.Close()
+	})
+	return "https://" + conn.LocalAddr().String()
+}
@@ -0,0 +1,230 @@
+package runn
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/goccy/go-yaml"
+	"github.com/k1LoW/runn/internal/expr"
+	"github.com/k1LoW/runn/internal/store"
+)
+
+const (
+	MediaTypeTextEventStream = "text/event-stream"
+)
+
+const (
+	httpStoreEventsKey = "events"
+
+	httpEventIDKey    = "id"
+	httpEventEventKey = "event"
+	httpEventDataKey  = "data"
+	httpEventRetryKey = "retry"
+	httpEventBodyKey  = "body"
+)
+
+const defaultSSEEventType = "message"
+
+// HTTPEvent is an event of the streaming HTTP response.
+// It is an event of Server-Sent Events or a line of the other (e.g. newline-delimited JSON) responses.
+type HTTPEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry int
+}
+
+// httpStream is the setting for reading the HTTP response as a stream.
+type httpStream struct {
+	Count   int    `yaml:"count,omitempty"`
+	Until   string `yaml:"until,omitempty"`
+	Timeout string `yaml:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+func newHTTPStream(v any) (*httpStream, error) {
+	st := &httpStream{}
+	if b, ok := v.(bool); ok {
+		// short syntax
+		if !b {
+			return nil, nil
+		}
+		return st, nil
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("invalid stream: %w", err)
+	}
+	if st.Count < 0 {
+		return nil, fmt.Errorf("invalid stream count: %d", st.Count)
+	}
+	if st.Timeout != "" {
+		st.timeout, err = parseDuration(st.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stream timeout: %w", err)
+		}
+	}
+	return st, nil
+}
+
+// streamContext returns the context to read the stream until the timeout.
+func (st *httpStream) streamContext(ctx context.Context, defaultTimeout time.Duration) (context.Context, context.CancelFunc) {
+	timeout := st.timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// readStream reads the events of the response until the count, the until condition or the timeout of the stream is reached.
+// It returns the events and the raw body read.
+func (rnr *httpRunner) readStream(ctx context.Context, res *http.Response, st *httpStream, d map[string]any, s *step) ([]any, []byte, error) {
+	o := s.parent
+	var body io.Reader = res.Body
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gr.Close()
+		body = gr
+	}
+	raw := new(bytes.Buffer)
+	events := []any{}
+	isSSE := false
+	if mt, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil && mt == MediaTypeTextEventStream {
+		isSSE = true
+	}
+	// done reports whether reading the stream should stop after receiving the event.
+	done := func(e *HTTPEvent) (bool, error) {
+		o.capturers.captureHTTPEvent(rnr.name, e)
+		events = append(events, e.toMap())
+		if st.Count > 0 && len(events) >= st.Count {
+			return true, nil
+		}
+		if st.Until == "" {
+			return false, nil
+		}
+		d[httpStoreEventsKey] = events
+		sm := o.store.ToMap()
+		sm[store.RootKeyIncluded] = o.included
+		if !s.deferred {
+			sm[store.RootKeyPrevious] = o.store.Latest()
+		}
+		sm[store.RootKeyCurrent] = map[string]any{
+			httpStoreResponseKey: d,
+		}
+		tf, err := expr.EvalCond(st.Until, sm)
+		if err != nil {
+			return false, fmt.Errorf("stream failed: %w", err)
+		}
+		return tf, nil
+	}
+
+	br := bufio.NewReader(io.TeeReader(body, raw))
+	e := &HTTPEvent{}
+	var data []string
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && line == "" {
+			switch {
+			case errors.Is(err, io.EOF):
+			case ctx.Err() != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+				o.Debugf("Stop reading the stream due to timeout: %s", err.Error())
+			default:
+				return events, raw.Bytes(), err
+			}
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !isSSE {
+			if line == "" {
+				continue
+			}
+			stop, err := done(&HTTPEvent{Data: line})
+			if err != nil {
+				return events, raw.Bytes(), err
+			}
+			if stop {
+				break
+			}
+			continue
+		}
+		if line == "" {
+			// Dispatch the event
+			if len(data) == 0 {
+				e = &HTTPEvent{ID: e.ID}
+				continue
+			}
+			e.Data = strings.Join(data, "\n")
+			if e.Event == "" {
+				e.Event = defaultSSEEventType
+			}
+			stop, err := done(e)
+			if err != nil {
+				return events, raw.Bytes(), err
+			}
+			if stop {
+				break
+			}
+			// The last event ID is kept.
+			e = &HTTPEvent{ID: e.ID}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case httpEventIDKey:
+			e.ID = value
+		case httpEventEventKey:
+			e.Event = value
+		case httpEventDataKey:
+			data = append(data, value)
+		case httpEventRetryKey:
+			if r, err := strconv.Atoi(value); err == nil {
+				e.Retry = r
+			}
+		}
+	}
+	return events, raw.Bytes(), nil
+}
+
+func (e *HTTPEvent) toMap() map[string]any {
+	m := map[string]any{
+		httpEventIDKey:    e.ID,
+		httpEventEventKey: e.Event,
+		httpEventDataKey:  e.Data,
+		httpEventBodyKey:  nil,
+	}
+	if e.Retry > 0 {
+		m[httpEventRetryKey] = e.Retry
+	}
+	var b any
+	if err := json.Unmarshal([]byte(e.Data), &b); err == nil {
+		m[httpEventBodyKey] = b
+	}
+	return m
+}
@@ -0,0 +1,84 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHTTPStream(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, ": comment\nevent: greeting\nid: 1\ndata: hello\n\n")
+		_, _ = fmt.Fprint(w, "data: {\"id\":2}\n\n")
+		_, _ = fmt.Fprint(w, "data: line1\ndata: line2\n\n")
+		_, _ = fmt.Fprint(w, "event: done\ndata: bye\n\n")
+		w.(http.Flusher).Flush()
+		// Keep the stream open until the client disconnects
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/ndjson", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := range 3 {
+			_, _ = fmt.Fprintf(w, "{\"id\":%d}\n", i+1)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	t.Setenv("HTTP_STREAM_END_POINT", ts.URL)
+
+	stderr := new(bytes.Buffer)
+	o, err := New(Book("testdata/book/http_stream.yml"), Debug(true), Stderr(stderr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(stderr.String(), "-----START HTTP EVENT-----"); got != 2+4+4+3 {
+		t.Errorf("got %v want %v", got, 2+4+4+3)
+	}
+	if !strings.Contains(stderr.String(), "-----START HTTP EVENT-----\nid: 1\nevent: greeting\ndata: hello\n-----END HTTP EVENT-----") {
+		t.Errorf("debugger should print events: %s", stderr.String())
+	}
+}
+
+func TestNewHTTPStream(t *testing.T) {
+	tests := []struct {
+		in      any
+		want    *httpStream
+		wantErr bool
+	}{
+		{true, &httpStream{}, false},
+		{false, nil, false},
+		{map[string]any{"count": 3}, &httpStream{Count: 3}, false},
+		{map[string]any{"until": "true", "timeout": "10"}, &httpStream{Until: "true", Timeout: "10", timeout: 10 * time.Second}, false},
+		{map[string]any{"count": -1}, nil, true},
+		{map[string]any{"timeout": "invalid"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v", tt.in), func(t *testing.T) {
+			got, err := newHTTPStream(tt.in)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("got err: %s", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("want error")
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(httpStream{})); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -1036,7 +1036,7 @@ func TestSetTraceHeader(t *testing.T) {
 				headers: http.Header{},
 				trace:   tt.trace,
 			}
-			if err := r.setTraceHeader(tt.step); err != nil {
+			if err := r.setTraceHeader(context.Background(), tt.step); err != nil {
 				t.Error(err)
 			}
 			got := r.headers.Get(DefaultTraceHeaderName)
@@ -0,0 +1,208 @@
+package runn
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+const (
+	httpStoreTimingKey = "timing"
+
+	httpTimingDNSKey      = "dns"
+	httpTimingConnectKey  = "connect"
+	httpTimingTLSKey      = "tls"
+	httpTimingTTFBKey     = "ttfb"
+	httpTimingTransferKey = "transfer"
+	httpTimingTotalKey    = "total"
+	httpTimingReusedKey   = "reused"
+)
+
+// httpTiming records the timing of the phases of an HTTP request using net/http/httptrace.
+type httpTiming struct {
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	end          time.Time
+	reused       bool
+	mu           sync.Mutex
+}
+
+type httpPhase struct {
+	name  string
+	start time.Time
+	end   time.Time
+}
+
+func newHTTPTiming() *httpTiming {
+	return &httpTiming{start: time.Now()}
+}
+
+// reset starts recording again (e.g. when the request is retried).
+func (t *httpTiming) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start = time.Now()
+	t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+	t.connectStart, t.connectDone = time.Time{}, time.Time{}
+	t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+	t.wroteRequest, t.firstByte, t.end = time.Time{}, time.Time{}, time.Time{}
+	t.reused = false
+}
+
+// clientTrace returns the httptrace.ClientTrace that records the timing.
+// When connecting more than once (e.g. through the proxy), the first start and the last done are recorded.
+func (t *httpTiming) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.setOnce(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone)
+		},
+		ConnectStart: func(string, string) {
+			t.setOnce(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.set(&t.connectDone)
+		},
+		TLSHandshakeStart: func() {
+			t.setOnce(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.set(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.setOnce(&t.firstByte)
+		},
+	}
+}
+
+// wroteRequestAt records that the whole request has been written (for the requests that are not traced).
+func (t *httpTiming) wroteRequestAt(tm time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.wroteRequest = tm
+}
+
+// gotFirstByteAt records that the first byte of the response has been received (for the requests that are not traced).
+func (t *httpTiming) gotFirstByteAt(tm time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.firstByte = tm
+}
+
+// done records the end of the transfer unless the response body has already been read to the end.
+func (t *httpTiming) done() {
+	t.setOnce(&t.end)
+}
+
+func (t *httpTiming) set(v *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*v = time.Now()
+}
+
+func (t *httpTiming) setOnce(v *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if v.IsZero() {
+		*v = time.Now()
+	}
+}
+
+// wrapBody returns the response body that records the end of the transfer when it is read to the end.
+func (t *httpTiming) wrapBody(body io.ReadCloser) io.ReadCloser {
+	return &timingBody{ReadCloser: body, timing: t}
+}
+
+// phases returns the phases of the request in order. Phases that did not occur are omitted.
+func (t *httpTiming) phases() []httpPhase {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ps []httpPhase
+	for _, p := range []httpPhase{
+		{httpTimingDNSKey, t.dnsStart, t.dnsDone},
+		{httpTimingConnectKey, t.connectStart, t.connectDone},
+		{httpTimingTLSKey, t.tlsStart, t.tlsDone},
+		{httpTimingTTFBKey, t.wroteRequest, t.firstByte},
+		{httpTimingTransferKey, t.firstByte, t.end},
+	} {
+		if p.start.IsZero() || p.end.IsZero() || p.end.Before(p.start) {
+			continue
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// toMap returns the timing in milliseconds to be recorded in the store.
+func (t *httpTiming) toMap() map[string]any {
+	m := map[string]any{
+		httpTimingDNSKey:      float64(0),
+		httpTimingConnectKey:  float64(0),
+		httpTimingTLSKey:      float64(0),
+		httpTimingTTFBKey:     float64(0),
+		httpTimingTransferKey: float64(0),
+	}
+	for _, p := range t.phases() {
+		m[p.name] = toMilliseconds(p.end.Sub(p.start))
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m[httpTimingTotalKey] = float64(0)
+	if !t.end.IsZero() {
+		m[httpTimingTotalKey] = toMilliseconds(t.end.Sub(t.start))
+	}
+	m[httpTimingReusedKey] = t.reused
+	return m
+}
+
+// recordProfile records the phases as the breakdown of the step in the profile.
+func (t *httpTiming) recordProfile(s *step) {
+	if s.parent == nil || s.parent.sw == nil {
+		return
+	}
+	trs := s.trails()
+	for _, p := range t.phases() {
+		ids := append(trs.toProfileIDs(), Trail{
+			Type:  TrailTypePhase,
+			Phase: p.name,
+		})
+		s.parent.sw.StartAt(p.start, ids...)
+		s.parent.sw.StopAt(p.end, ids...)
+	}
+}
+
+func toMilliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type timingBody struct {
+	io.ReadCloser
+	timing *httpTiming
+}
+
+func (b *timingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.timing.done()
+	}
+	return n, err
+}
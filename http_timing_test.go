@@ -0,0 +1,68 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/k1LoW/httpstub"
+	"github.com/k1LoW/stopw"
+)
+
+func TestHTTPTiming(t *testing.T) {
+	ts := httpstub.NewServer(t)
+	t.Cleanup(func() {
+		ts.Close()
+	})
+	ts.Method(http.MethodGet).Path("/users/1").Header("Content-Type", "application/json").ResponseString(http.StatusOK, `{"name":"alice"}`)
+	t.Setenv("TEST_HTTP_ENDPOINT", ts.Server().URL)
+	o, err := New(Book("testdata/book/http_timing.yml"), Profile(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	steps, ok := o.store.ToMap()["steps"].([]map[string]any)
+	if !ok {
+		t.Fatal("failed to get steps")
+	}
+	timing, ok := steps[0]["res"].(map[string]any)["timing"].(map[string]any)
+	if !ok {
+		t.Fatal("failed to get timing")
+	}
+	for _, k := range []string{"dns", "connect", "tls", "ttfb", "transfer", "total", "reused"} {
+		if _, ok := timing[k]; !ok {
+			t.Errorf("%s not found in %v", k, timing)
+		}
+	}
+	if timing["connect"].(float64) <= 0 {
+		t.Errorf("got %v", timing["connect"])
+	}
+
+	buf := new(bytes.Buffer)
+	if err := o.DumpProfile(buf); err != nil {
+		t.Fatal(err)
+	}
+	var s stopw.Span
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	var phases []string
+	var walk func(s *stopw.Span)
+	walk = func(s *stopw.Span) {
+		for _, b := range s.Breakdown {
+			if tr, ok := b.ID.(map[string]any); ok && tr["type"] == string(TrailTypePhase) {
+				phases = append(phases, tr["phase"].(string))
+			}
+			walk(b)
+		}
+	}
+	walk(&s)
+	if !slices.Contains(phases, "connect") || !slices.Contains(phases, "ttfb") || !slices.Contains(phases, "transfer") {
+		t.Errorf("got %v", phases)
+	}
+}
@@ -233,6 +233,7 @@ func (o *operator) newNestedOperator(parent *step, opts ...Option) (*operator, e
 	oo.t = o.thisT
 	oo.thisT = o.thisT
 	oo.sw = o.sw
+	oo.tracer = o.tracer
 	oo.capturers = o.capturers
 	oo.parent = parent
 	oo.store.SetParentVars(o.store.ToMap())
@@ -272,6 +273,9 @@ func (o *operator) exportOptionsToBePropagated() []Option {
 	opts = append(opts, SkipTest(o.skipTest))
 	opts = append(opts, Force(o.force))
 	opts = append(opts, Trace(o.trace))
+	if o.fixtures != nil {
+		opts = append(opts, withFixtures(o.fixtures))
+	}
 	for k, f := range o.store.Funcs() {
 		if k == "file" {
 			// Skip file function
@@ -37,7 +37,11 @@ func Diff(x, y any, ignores ...any) (string, error) {
 			return "", fmt.Errorf("invalid ignore specifiers: %v", i)
 		}
 	}
+	return DiffWithOptions(x, y, ignoreSpecifiers)
+}
 
+// DiffWithOptions is the same as Diff, but it takes the ignore specifiers as a slice and additional options of cmp.
+func DiffWithOptions(x, y any, ignoreSpecifiers []string, opts ...cmp.Option) (string, error) {
 	impl := diffImpl{}
 
 	// normalize values
@@ -65,6 +69,8 @@ func Diff(x, y any, ignores ...any) (string, error) {
 		}
 	}
 
+	diffOpts = append(diffOpts, opts...)
+
 	return cmp.Diff(vx, vy, diffOpts...), nil
 }
 
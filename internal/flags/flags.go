@@ -1,9 +1,12 @@
 package flags
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -16,7 +19,13 @@ import (
 	"github.com/k1LoW/runn"
 	"github.com/k1LoW/runn/capture"
 	"github.com/k1LoW/runn/internal/store"
+	"github.com/k1LoW/runn/version"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 var intRe = regexp.MustCompile(`^\-?[0-9]+$`)
@@ -34,12 +43,17 @@ type Flags struct {
 	HTTPOpenApi3s   []string `usage:"set the path to the OpenAPI v3 document for HTTP runners (\"path/to/spec.yml\" or \"key:path/to/spec.yml\")"`
 	GRPCNoTLS       bool     `usage:"disable TLS use in all gRPC runners"`
 	GRPCProtos      []string `usage:"set the name of proto source for gRPC runners"`
+	GRPCProtosets   []string `usage:"set the path to the descriptor set (protoset) for gRPC runners (\"path/to/app.protoset\" or \"key:path/to/app.protoset\")"`
 	GRPCImportPaths []string `usage:"set the path to the directory where proto sources can be imported for gRPC runners"`
 	GRPCBufDirs     []string `usage:"set the path to the buf directory for gRPC runners"`
 	GRPCBufLocks    []string `usage:"set the path to buf.lock for gRPC runners"`
 	GRPCBufConfigs  []string `usage:"set the path to buf.yaml for gRPC runners"`
 	GRPCBufModules  []string `usage:"set the buf modules for gRPC runners (\"buf.build/owner/repository\" or \"buf.build/owner/repository/tree/branch-or-commit\")"`
+	GRPCBook        string   `usage:"set the path to the runbook to use its gRPC runners"`
 	CaptureDir      string   `usage:"destination of runbook run capture results"`
+	RecordDir       string   `usage:"record HTTP/gRPC traffic of runners to the directory as fixtures"`
+	ReplayDir       string   `usage:"replay HTTP/gRPC traffic of runners from the fixtures in the directory"`
+	CookieJar       string   `usage:"load and save cookies of HTTP runners to the file (Netscape cookies.txt or JSON if the extension is .json)"`
 	Vars            []string `usage:"set var to runbook (\"key:value\")"`
 	Runners         []string `usage:"set runner to runbook (\"key:dsn\")"`
 	Overlays        []string `usage:"overlay values on the runbook"`
@@ -59,6 +73,7 @@ type Flags struct {
 	LoadTWarmUp     string   `usage:"warn-up time for load test"`
 	LoadTThreshold  string   `usage:"if this threshold condition is not met, loadt command returns exit status 1 (EXIT_FAILURE)"`
 	LoadTMaxRPS     int      `usage:"max RunN per second for load test. 0 means unlimited"`
+	DiffTolerance   string   `usage:"if this tolerance condition is not met, diff command returns exit status 1 (EXIT_FAILURE)"`
 	Profile         bool     `usage:"profile runs of runbooks"`
 	ProfileOut      string   `usage:"profile output path"`
 	ProfileDepth    int      `usage:"depth of profile"`
@@ -75,6 +90,12 @@ type Flags struct {
 	Verbose         bool     `usage:"verbose"`
 	Coverage        bool     `usage:"coverage for OpenAPI spec and protocol buffers"`
 	CoverageOut     string   `usage:"coverage output path (JSON format)"`
+	OTLPEndpoint    string   `usage:"export traces of runbook runs to the OTLP/HTTP endpoint (\"http://localhost:4318\")"`
+	OTLPFile        string   `usage:"export traces of runbook runs to the file (JSON Lines format)"`
+	MetricsListen   string   `usage:"serve metrics of runbook runs in OpenMetrics format on the address (\":9090\")"`
+	ServeListen     string   `usage:"address to serve the status API of scheduled runbook runs"`
+	HistorySize     int      `usage:"number of results kept per runbook"`
+	HistoryDir      string   `usage:"directory to store results history of runbooks (JSON Lines format)"`
 }
 
 func (f *Flags) ToOpts() ([]runn.Option, error) {
@@ -94,6 +115,7 @@ func (f *Flags) ToOpts() ([]runn.Option, error) {
 		runn.HTTPOpenApi3s(f.HTTPOpenApi3s),
 		runn.GRPCNoTLS(f.GRPCNoTLS),
 		runn.GRPCProtos(f.GRPCProtos),
+		runn.GRPCProtosets(f.GRPCProtosets),
 		runn.GRPCImportPaths(f.GRPCImportPaths),
 		runn.GRPCBufDir(f.GRPCBufDirs...),
 		runn.GRPCBufLock(f.GRPCBufLocks...),
@@ -216,12 +238,79 @@ func (f *Flags) ToOpts() ([]runn.Option, error) {
 		}
 		opts = append(opts, runn.Capture(capture.Runbook(f.CaptureDir)))
 	}
+	if f.CookieJar != "" {
+		opts = append(opts, runn.CookieJar(f.CookieJar))
+	}
+	if f.RecordDir != "" && f.ReplayDir != "" {
+		return nil, errors.New("--record and --replay cannot be used at the same time")
+	}
+	if f.RecordDir != "" {
+		opts = append(opts, runn.Record(f.RecordDir))
+	}
+	if f.ReplayDir != "" {
+		opts = append(opts, runn.Replay(f.ReplayDir))
+	}
 	if f.Format == "" {
 		opts = append(opts, runn.Capture(runn.NewCmdOut(os.Stdout, f.Verbose)))
 	}
 	return opts, nil
 }
 
+// NewTracerProvider returns the TracerProvider that exports traces of runbook runs.
+// It returns nil if neither --otlp-endpoint nor --otlp-file is specified.
+func (f *Flags) NewTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if f.OTLPEndpoint == "" && f.OTLPFile == "" {
+		return nil, nil
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "runn"),
+			attribute.String("service.version", version.Version),
+		)),
+	}
+	if f.OTLPEndpoint != "" {
+		u, err := url.Parse(f.OTLPEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --otlp-endpoint: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid --otlp-endpoint: should be http or https URL: %s", f.OTLPEndpoint)
+		}
+		eopts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(f.OTLPEndpoint)}
+		if u.Path == "" || u.Path == "/" {
+			eopts = append(eopts, otlptracehttp.WithURLPath("/v1/traces"))
+		}
+		exp, err := otlptracehttp.New(ctx, eopts...)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp))
+	}
+	if f.OTLPFile != "" {
+		file, err := os.Create(filepath.Clean(f.OTLPFile))
+		if err != nil {
+			return nil, err
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		opts = append(opts, sdktrace.WithBatcher(&fileSpanExporter{Exporter: exp, file: file}))
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
+}
+
+// fileSpanExporter closes the file when the exporter is shut down.
+type fileSpanExporter struct {
+	*stdouttrace.Exporter
+	file *os.File
+}
+
+func (e *fileSpanExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.Exporter.Shutdown(ctx), e.file.Close())
+}
+
 func (f *Flags) Usage(name string) string {
 	field, ok := reflect.TypeFor[Flags]().FieldByName(name)
 	if !ok {
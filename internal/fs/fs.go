@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -277,6 +278,60 @@ func FetchPath(path string) (string, error) {
 	return paths[0], nil
 }
 
+// Open opens single local file to read it as a stream and returns the size of the file.
+// Files other than local files (e.g. cache files of remote files) are read by ReadFile.
+func Open(p string) (io.ReadCloser, int64, error) {
+	p = strings.TrimPrefix(p, PrefixFile)
+	fi, err := os.Stat(p)
+	if err == nil && !fi.IsDir() {
+		cd, err := cacheDir()
+		if err != nil || !strings.HasPrefix(p, cd) {
+			p, err = localPath(p, fi)
+			if err != nil {
+				return nil, 0, err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return nil, 0, err
+			}
+			return f, fi.Size(), nil
+		}
+	}
+	b, err := ReadFile(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+}
+
+// localPath returns the path of the local file to read, checking the scope.
+func localPath(p string, fi os.FileInfo) (string, error) {
+	if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
+		// Read symlink
+		var err error
+		p, err = os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil {
+		return "", err
+	}
+	if !scope.IsReadParentAllowed() && strings.Contains(rel, "..") {
+		return "", fmt.Errorf("scope error: reading files in the parent directory is not allowed. 'read:parent' scope is required: %s", p)
+	}
+	return p, nil
+}
+
 // ReadFile reads single file from local or cache.
 // When retrieving a cache file, if the cache file does not exist, re-fetch it.
 func ReadFile(p string) ([]byte, error) {
@@ -291,28 +346,10 @@ func ReadFile(p string) ([]byte, error) {
 			}
 			return os.ReadFile(p)
 		}
-		if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
-			// Read symlink
-			p, err = os.Readlink(p)
-			if err != nil {
-				return nil, err
-			}
-		}
-		abs, err := filepath.Abs(p)
-		if err != nil {
-			return nil, err
-		}
-		wd, err := os.Getwd()
+		p, err = localPath(p, fi)
 		if err != nil {
 			return nil, err
 		}
-		rel, err := filepath.Rel(wd, abs)
-		if err != nil {
-			return nil, err
-		}
-		if !scope.IsReadParentAllowed() && strings.Contains(rel, "..") {
-			return nil, fmt.Errorf("scope error: reading files in the parent directory is not allowed. 'read:parent' scope is required: %s", p)
-		}
 		// Read local file
 		return os.ReadFile(p)
 	}
@@ -28,6 +28,7 @@ type loadtResultJSON struct {
 	LatencyAvgMs float64 `json:"latency_avg_ms"`
 	LatencyMedMs float64 `json:"latency_med_ms"`
 	LatencyP90Ms float64 `json:"latency_p90_ms"`
+	LatencyP95Ms float64 `json:"latency_p95_ms"`
 	LatencyP99Ms float64 `json:"latency_p99_ms"`
 }
 
@@ -178,6 +179,7 @@ func (r *loadtResult) ReportJSON(w io.Writer) error {
 		LatencyAvgMs: r.avg * 1000,
 		LatencyMedMs: r.p50 * 1000,
 		LatencyP90Ms: r.p90 * 1000,
+		LatencyP95Ms: r.p95 * 1000,
 		LatencyP99Ms: r.p99 * 1000,
 	}
 	b, err := json.MarshalIndent(j, "", "  ")
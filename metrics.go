@@ -0,0 +1,219 @@
+package runn
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "runn"
+
+var _ Capturer = (*metricsCapturer)(nil)
+
+// metricsCapturer is a Capturer that records results of runbook runs as Prometheus metrics.
+type metricsCapturer struct {
+	runbookRuns     *prometheus.CounterVec
+	runbookDuration *prometheus.HistogramVec
+	stepRuns        *prometheus.CounterVec
+	stepDuration    *prometheus.HistogramVec
+	loadtRequests   *prometheus.GaugeVec
+	loadtRPS        prometheus.Gauge
+	loadtErrorRate  prometheus.Gauge
+	loadtLatency    *prometheus.GaugeVec
+
+	// started holds the start times of running runbooks and steps by ID.
+	// The same runbook may run concurrently (e.g. load test), so the start times are queued.
+	started map[string][]time.Time
+	mu      sync.Mutex
+}
+
+// NewMetricsCapturer returns a Capturer that records results of runbook runs as Prometheus metrics and registers the metrics to reg.
+func NewMetricsCapturer(reg prometheus.Registerer) (*metricsCapturer, error) {
+	m := &metricsCapturer{
+		runbookRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "runbook_runs_total",
+			Help:      "Number of runbook runs by result.",
+		}, []string{"id", "path", "labels", "result"}),
+		runbookDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "runbook_duration_seconds",
+			Help:      "Elapsed time of runbook runs.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"id", "path"}),
+		stepRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "step_runs_total",
+			Help:      "Number of step runs by result.",
+		}, []string{"id", "key", "runner_type", "result"}),
+		stepDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "step_duration_seconds",
+			Help:      "Elapsed time of step runs.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"id", "key", "runner_type"}),
+		loadtRequests: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "loadt_requests",
+			Help:      "Number of runs of the last load test by result.",
+		}, []string{"result"}),
+		loadtRPS: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "loadt_rps",
+			Help:      "RunN per second of the last load test.",
+		}),
+		loadtErrorRate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "loadt_error_rate",
+			Help:      "Error rate (%) of the last load test.",
+		}),
+		loadtLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "loadt_latency_seconds",
+			Help:      "Latency of RunN of the last load test by statistic.",
+		}, []string{"stat"}),
+		started: map[string][]time.Time{},
+	}
+	for _, c := range []prometheus.Collector{
+		m.runbookRuns,
+		m.runbookDuration,
+		m.stepRuns,
+		m.stepDuration,
+		m.loadtRequests,
+		m.loadtRPS,
+		m.loadtErrorRate,
+		m.loadtLatency,
+	} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// SetLoadtResult sets the result of the load test to the gauges.
+func (m *metricsCapturer) SetLoadtResult(r *loadtResult) {
+	m.loadtRequests.WithLabelValues("total").Set(float64(r.total))
+	m.loadtRequests.WithLabelValues(string(resultSuccess)).Set(float64(r.succeeded))
+	m.loadtRequests.WithLabelValues(string(resultFailure)).Set(float64(r.failed))
+	m.loadtRPS.Set(r.rps)
+	m.loadtErrorRate.Set(r.errorRate)
+	m.loadtLatency.WithLabelValues("max").Set(r.max)
+	m.loadtLatency.WithLabelValues("min").Set(r.min)
+	m.loadtLatency.WithLabelValues("avg").Set(r.avg)
+	m.loadtLatency.WithLabelValues("p50").Set(r.p50)
+	m.loadtLatency.WithLabelValues("p90").Set(r.p90)
+	m.loadtLatency.WithLabelValues("p95").Set(r.p95)
+	m.loadtLatency.WithLabelValues("p99").Set(r.p99)
+}
+
+func (m *metricsCapturer) CaptureStart(trs Trails, bookPath, desc string) {
+	m.start(trs.runbookID())
+}
+
+func (m *metricsCapturer) CaptureResult(trs Trails, result *RunResult) {
+	labels := slices.Clone(result.Labels)
+	slices.Sort(labels)
+	m.runbookRuns.WithLabelValues(result.ID, result.Path, strings.Join(labels, ","), metricsResult(result.Skipped, result.Err)).Inc()
+	if d, ok := m.stop(trs.runbookID()); ok {
+		m.runbookDuration.WithLabelValues(result.ID, result.Path).Observe(d.Seconds())
+	}
+}
+
+func (m *metricsCapturer) CaptureEnd(trs Trails, bookPath, desc string) {}
+
+func (m *metricsCapturer) CaptureResultByStep(trs Trails, result *RunResult) {
+	// Steps run in order, so the last step result is the result of the step that has just finished.
+	var sr *StepResult
+	for _, r := range slices.Backward(result.StepResults) {
+		if r != nil {
+			sr = r
+			break
+		}
+	}
+	if sr == nil {
+		return
+	}
+	m.stepRuns.WithLabelValues(sr.ID, sr.Key, string(sr.RunnerType), metricsResult(sr.Skipped, sr.Err)).Inc()
+	if d, ok := m.stop(sr.ID); ok {
+		m.stepDuration.WithLabelValues(sr.ID, sr.Key, string(sr.RunnerType)).Observe(d.Seconds())
+	}
+}
+
+func (m *metricsCapturer) CaptureHTTPRequest(name string, req *http.Request)                  {}
+func (m *metricsCapturer) CaptureHTTPResponse(name string, res *http.Response)                {}
+func (m *metricsCapturer) CaptureHTTPEvent(name string, e *HTTPEvent)                         {}
+func (m *metricsCapturer) CaptureGRPCStart(name string, typ GRPCType, service, method string) {}
+func (m *metricsCapturer) CaptureGRPCRequestHeaders(h map[string][]string)                    {}
+func (m *metricsCapturer) CaptureGRPCRequestMessage(msg map[string]any)                       {}
+func (m *metricsCapturer) CaptureGRPCResponseStatus(s *status.Status)                         {}
+func (m *metricsCapturer) CaptureGRPCResponseHeaders(h map[string][]string)                   {}
+func (m *metricsCapturer) CaptureGRPCResponseMessage(msg map[string]any)                      {}
+func (m *metricsCapturer) CaptureGRPCResponseTrailers(t map[string][]string)                  {}
+func (m *metricsCapturer) CaptureGRPCClientClose()                                            {}
+func (m *metricsCapturer) CaptureGRPCEnd(name string, typ GRPCType, service, method string)   {}
+func (m *metricsCapturer) CaptureCDPStart(name string)                                        {}
+func (m *metricsCapturer) CaptureCDPAction(a CDPAction)                                       {}
+func (m *metricsCapturer) CaptureCDPResponse(a CDPAction, res map[string]any)                 {}
+func (m *metricsCapturer) CaptureCDPEnd(name string)                                          {}
+func (m *metricsCapturer) CaptureSSHCommand(command string)                                   {}
+func (m *metricsCapturer) CaptureSSHStdout(stdout string)                                     {}
+func (m *metricsCapturer) CaptureSSHStderr(stderr string)                                     {}
+func (m *metricsCapturer) CaptureDBStatement(name string, stmt string, args []any)            {}
+func (m *metricsCapturer) CaptureDBResponse(name string, res *DBResponse)                     {}
+func (m *metricsCapturer) CaptureExecCommand(command, shell string, background bool)          {}
+func (m *metricsCapturer) CaptureExecStdin(stdin string)                                      {}
+func (m *metricsCapturer) CaptureExecStdout(stdout string)                                    {}
+func (m *metricsCapturer) CaptureExecStderr(stderr string)                                    {}
+func (m *metricsCapturer) CaptureAgentRequest(_ string, _ *AgentRequest)                      {}
+func (m *metricsCapturer) CaptureAgentResponse(_ string, _ *AgentResponse)                    {}
+
+func (m *metricsCapturer) SetCurrentTrails(trs Trails) {
+	// Only the start of a step is recorded. Loop iterations are included in the step.
+	if len(trs) == 0 || trs[len(trs)-1].Type != TrailTypeStep {
+		return
+	}
+	m.start(trs.runbookID())
+}
+
+func (m *metricsCapturer) Errs() error {
+	return nil
+}
+
+func (m *metricsCapturer) start(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.started[id] = append(m.started[id], time.Now())
+}
+
+func (m *metricsCapturer) stop(id string) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.started[id]
+	if len(q) == 0 {
+		return 0, false
+	}
+	st := q[0]
+	if len(q) == 1 {
+		delete(m.started, id)
+	} else {
+		m.started[id] = q[1:]
+	}
+	return time.Since(st), true
+}
+
+func metricsResult(skipped bool, err error) string {
+	switch {
+	case skipped:
+		return string(resultSkipped)
+	case err != nil:
+		return string(resultFailure)
+	default:
+		return string(resultSuccess)
+	}
+}
@@ -0,0 +1,67 @@
+package runn
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/k1LoW/runn/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsCapturer(t *testing.T) {
+	ctx := context.Background()
+	ts := testutil.HTTPServer(t)
+	t.Setenv("HTTPBIN_END_POINT", ts.URL)
+	reg := prometheus.NewRegistry()
+	mc, err := NewMetricsCapturer(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := Load("testdata/book/otel.yml", Capture(mc), Stdout(io.Discard), Stderr(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := o.RunN(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			switch mf.GetName() {
+			case "runn_runbook_runs_total":
+				got[mf.GetName()+"/"+labels["result"]] += m.GetCounter().GetValue()
+			case "runn_step_runs_total":
+				got[mf.GetName()+"/"+labels["key"]+"/"+labels["runner_type"]+"/"+labels["result"]] += m.GetCounter().GetValue()
+			case "runn_runbook_duration_seconds", "runn_step_duration_seconds":
+				got[mf.GetName()] += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	want := map[string]float64{
+		"runn_runbook_runs_total/success":                    2,
+		"runn_step_runs_total/getUser/http/success":          2,
+		"runn_step_runs_total/getUsersWithLoop/http/success": 2,
+		"runn_runbook_duration_seconds":                      2,
+		"runn_step_duration_seconds":                         4,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("got %v, want %v: %s", got[k], v, k)
+		}
+	}
+	if len(mc.started) != 0 {
+		t.Errorf("start times should be consumed: %v", mc.started)
+	}
+}
@@ -0,0 +1,400 @@
+package runn
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/golang-sql/sqlexp/nest"
+	"github.com/k1LoW/runn/internal/store"
+	"github.com/k1LoW/waitmap"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	defaultMonitorHistorySize = 100
+	monitorRenewTimeout       = 5 * time.Second
+)
+
+// monitor runs runbooks repeatedly on their schedules and keeps the history of the results.
+type monitor struct {
+	entries     []*monitorEntry
+	opn         *operatorN
+	historySize int
+	historyDir  string
+	mu          sync.RWMutex
+}
+
+type monitorEntry struct {
+	op       *operator
+	schedule cron.Schedule
+	next     time.Time
+	running  bool
+	history  []*monitorRecord
+}
+
+// monitorRecord is the result of a scheduled runbook run.
+type monitorRecord struct {
+	StartedAt time.Time `json:"started_at"`
+	runResultSimplified
+}
+
+type monitorStatus struct {
+	ID       string         `json:"id"`
+	Desc     string         `json:"desc,omitempty"`
+	Path     string         `json:"path"`
+	Schedule string         `json:"schedule"`
+	Running  bool           `json:"running"`
+	NextRun  time.Time      `json:"next_run"`
+	Latest   *monitorRecord `json:"latest,omitempty"`
+}
+
+// NewMonitor returns a monitor that runs the runbooks with `schedule:` selected by opn.
+// historySize is the number of results kept per runbook, and if historyDir is not empty, the results are also appended to files in historyDir.
+func NewMonitor(opn *operatorN, historySize int, historyDir string) (*monitor, error) {
+	if historySize <= 0 {
+		historySize = defaultMonitorHistorySize
+	}
+	m := &monitor{
+		opn:         opn,
+		historySize: historySize,
+		historyDir:  historyDir,
+	}
+	if historyDir != "" {
+		if err := os.MkdirAll(historyDir, 0o755); err != nil { //nolint:gosec
+			return nil, err
+		}
+	}
+	ops, err := opn.SelectedOperators()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.schedule == "" {
+			op.Debugln(fmt.Sprintf("Skip %s because it has no schedule", op.bookPathOrID()))
+			continue
+		}
+		s, err := parseSchedule(op.schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule of %s: %w", op.bookPathOrID(), err)
+		}
+		// Runners are kept between scheduled runs.
+		for _, r := range op.grpcRunners {
+			r.reusable = true
+		}
+		for _, r := range op.dbRunners {
+			r.reusable = true
+		}
+		for _, r := range op.sshRunners {
+			r.reusable = true
+		}
+		e := &monitorEntry{
+			op:       op,
+			schedule: s,
+		}
+		if err := m.loadHistory(e); err != nil {
+			return nil, err
+		}
+		m.entries = append(m.entries, e)
+	}
+	if len(m.entries) == 0 {
+		return nil, errors.New("no runbooks with schedule")
+	}
+	return m, nil
+}
+
+// Run runs the runbooks on their schedules until ctx is canceled.
+func (m *monitor) Run(ctx context.Context) error {
+	defer func() {
+		_ = m.opn.Terminate()
+	}()
+	var wg sync.WaitGroup
+	errc := make(chan error, len(m.entries))
+	for _, e := range m.entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.runEntry(ctx, e); err != nil {
+				errc <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	var err error
+	for e := range errc {
+		err = errors.Join(err, e)
+	}
+	return err
+}
+
+// Handler returns the handler of the HTTP API that exposes the status of the runbooks.
+//
+//	GET /status                 - Latest status of all runbooks
+//	GET /runbooks/{id}          - Latest status of the runbook
+//	GET /runbooks/{id}/history  - Results history of the runbook
+func (m *monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		var statuses []*monitorStatus
+		for _, e := range m.entries {
+			statuses = append(statuses, e.status())
+		}
+		writeMonitorJSON(w, http.StatusOK, statuses)
+	})
+	mux.HandleFunc("GET /runbooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		e, err := m.entry(r.PathValue("id"))
+		if err != nil {
+			writeMonitorJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeMonitorJSON(w, http.StatusOK, e.status())
+	})
+	mux.HandleFunc("GET /runbooks/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		e, err := m.entry(r.PathValue("id"))
+		if err != nil {
+			writeMonitorJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		history := e.history
+		if history == nil {
+			history = []*monitorRecord{}
+		}
+		writeMonitorJSON(w, http.StatusOK, history)
+	})
+	return mux
+}
+
+func (m *monitor) runEntry(ctx context.Context, e *monitorEntry) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		now := time.Now()
+		next := e.schedule.Next(now)
+		m.mu.Lock()
+		e.next = next
+		m.mu.Unlock()
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+		m.mu.Lock()
+		if e.running {
+			// Skip this run because the previous run has not finished yet.
+			m.mu.Unlock()
+			continue
+		}
+		e.running = true
+		m.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.runOnce(ctx, e); err != nil {
+				e.op.Debugln(fmt.Sprintf("Failed to record the result of %s: %s", e.op.bookPathOrID(), err))
+			}
+		}()
+	}
+}
+
+func (m *monitor) runOnce(ctx context.Context, e *monitorEntry) error {
+	defer func() {
+		m.mu.Lock()
+		e.running = false
+		m.mu.Unlock()
+	}()
+	op := e.op
+	renewBrokenRunners(ctx, op)
+	// Results for `needs:` are not overwritten, so they are reset for each run.
+	op.nm = waitmap.New[string, *store.Store]()
+	st := time.Now()
+	_ = op.Run(ctx)
+	rec := &monitorRecord{
+		StartedAt:           st,
+		runResultSimplified: *simplifyRunResult(op.Result()),
+	}
+	rec.Elapsed = time.Since(st)
+	m.mu.Lock()
+	e.history = append(e.history, rec)
+	if len(e.history) > m.historySize {
+		e.history = e.history[len(e.history)-m.historySize:]
+	}
+	m.mu.Unlock()
+	return m.appendHistory(e, rec)
+}
+
+func (m *monitor) entry(id string) (*monitorEntry, error) {
+	for _, e := range m.entries {
+		if e.op.runbookID() == id {
+			return e, nil
+		}
+	}
+	// Allow to specify the runbook by ID prefix.
+	var found *monitorEntry
+	for _, e := range m.entries {
+		if id != "" && strings.HasPrefix(e.op.runbookID(), id) {
+			if found != nil {
+				return nil, fmt.Errorf("multiple runbooks found: %s", id)
+			}
+			found = e
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("runbook not found: %s", id)
+	}
+	return found, nil
+}
+
+func (m *monitor) historyPath(e *monitorEntry) string {
+	return filepath.Join(m.historyDir, fmt.Sprintf("%s.jsonl", e.op.runbookID()))
+}
+
+func (m *monitor) loadHistory(e *monitorEntry) error {
+	if m.historyDir == "" {
+		return nil
+	}
+	f, err := os.Open(m.historyPath(e))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 64*1024*1024)
+	for s.Scan() {
+		rec := &monitorRecord{}
+		if err := json.Unmarshal(s.Bytes(), rec); err != nil {
+			return fmt.Errorf("invalid history of %s: %w", e.op.bookPathOrID(), err)
+		}
+		e.history = append(e.history, rec)
+		if len(e.history) > m.historySize {
+			e.history = e.history[1:]
+		}
+	}
+	return s.Err()
+}
+
+func (m *monitor) appendHistory(e *monitorEntry, rec *monitorRecord) error {
+	if m.historyDir == "" {
+		return nil
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(m.historyPath(e), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (e *monitorEntry) status() *monitorStatus {
+	s := &monitorStatus{
+		ID:       e.op.runbookID(),
+		Desc:     e.op.desc,
+		Path:     normalizePath(e.op.bookPath),
+		Schedule: e.op.schedule,
+		Running:  e.running,
+		NextRun:  e.next,
+	}
+	if len(e.history) > 0 {
+		s.Latest = e.history[len(e.history)-1]
+	}
+	return s
+}
+
+// parseSchedule parses the schedule of runbook runs.
+// The schedule is a duration string (e.g. `30sec`, `5min`) or a cron expression (e.g. `*/5 * * * *`, `@hourly`).
+func parseSchedule(s string) (cron.Schedule, error) {
+	if d, err := parseDuration(s); err == nil {
+		if d < time.Second {
+			return nil, fmt.Errorf("interval of schedule should be at least 1 second: %s", s)
+		}
+		return cron.Every(d), nil
+	}
+	return cron.ParseStandard(s)
+}
+
+// renewBrokenRunners renews the runners whose connections are broken so that they reconnect on the next run.
+func renewBrokenRunners(ctx context.Context, op *operator) {
+	for _, r := range op.grpcRunners {
+		if r.cc == nil || r.target == "" {
+			continue
+		}
+		switch r.cc.GetState() {
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			op.Debugln(fmt.Sprintf("Renew gRPC runner %s", r.name))
+			_ = r.Renew()
+		}
+	}
+	for _, r := range op.dbRunners {
+		if r.client == nil || r.dsn == "" {
+			continue
+		}
+		ndb, ok := r.client.(*nest.DB)
+		if !ok || ndb.DB() == nil {
+			continue
+		}
+		cctx, cancel := context.WithTimeout(ctx, monitorRenewTimeout)
+		err := ndb.DB().PingContext(cctx)
+		cancel()
+		if err != nil {
+			op.Debugln(fmt.Sprintf("Renew DB runner %s: %s", r.name, err))
+			_ = r.Renew()
+		}
+	}
+	for _, r := range op.sshRunners {
+		if r.client == nil || r.addr == "" {
+			continue
+		}
+		if !sshAlive(r.client) {
+			op.Debugln(fmt.Sprintf("Renew SSH runner %s", r.name))
+			_ = r.Renew()
+		}
+	}
+}
+
+func sshAlive(client *ssh.Client) bool {
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+	select {
+	case err := <-errc:
+		return err == nil
+	case <-time.After(monitorRenewTimeout):
+		return false
+	}
+}
+
+func writeMonitorJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
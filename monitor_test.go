@@ -0,0 +1,118 @@
+package runn
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/k1LoW/runn/testutil"
+)
+
+func TestMonitor(t *testing.T) {
+	ts := testutil.HTTPServer(t)
+	t.Setenv("HTTPBIN_END_POINT", ts.URL)
+	dir := t.TempDir()
+	o, err := Load("testdata/book/schedule*.yml", Stdout(io.Discard), Stderr(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMonitor(o, 2, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.entries); got != 1 {
+		t.Fatalf("got %v want %v", got, 1)
+	}
+	id := m.entries[0].op.runbookID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3500*time.Millisecond)
+	defer cancel()
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(m.Handler())
+	t.Cleanup(hs.Close)
+	var history []*monitorRecord
+	getJSON(t, hs.URL+"/runbooks/"+id+"/history", http.StatusOK, &history)
+	if got := len(history); got != 2 {
+		t.Fatalf("got %v want %v", got, 2)
+	}
+	for _, r := range history {
+		if r.Result != resultSuccess {
+			t.Errorf("got %v want %v", r.Result, resultSuccess)
+		}
+	}
+	var statuses []*monitorStatus
+	getJSON(t, hs.URL+"/status", http.StatusOK, &statuses)
+	if got := len(statuses); got != 1 {
+		t.Fatalf("got %v want %v", got, 1)
+	}
+	if statuses[0].Latest == nil || !statuses[0].Latest.StartedAt.Equal(history[1].StartedAt) {
+		t.Errorf("latest result should be the last result of history: %v", statuses[0].Latest)
+	}
+	getJSON(t, hs.URL+"/runbooks/notfound", http.StatusNotFound, &map[string]string{})
+
+	// History is loaded from the history directory
+	m2, err := NewMonitor(o, 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m2.entries[0].history); got < 3 {
+		t.Errorf("got %v want >= %v", got, 3)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"30sec", now.Add(30 * time.Second), false},
+		{"5min", now.Add(5 * time.Minute), false},
+		{"10", now.Add(10 * time.Second), false},
+		{"*/15 * * * *", now.Add(15 * time.Minute), false},
+		{"@hourly", now.Add(time.Hour), false},
+		{"@every 2h", now.Add(2 * time.Hour), false},
+		{"100ms", time.Time{}, true},
+		{"invalid", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			s, err := parseSchedule(tt.in)
+			if err != nil {
+				if !tt.wantErr {
+					t.Errorf("got err: %s", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Fatal("want error")
+			}
+			if got := s.Next(now); !got.Equal(tt.want) {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func getJSON(t *testing.T, u string, code int, v any) {
+	t.Helper()
+	res, err := http.Get(u) //nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != code {
+		t.Fatalf("got %v want %v", res.StatusCode, code)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/ryo-yamaoka/otchkiss"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -88,7 +89,8 @@ type operator struct {
 	thisT           *testing.T
 	parent          *step
 	force           bool
-	trace           bool // Enable tracing ( e.g. add trace header to HTTP request )
+	trace           bool   // Enable tracing ( e.g. add trace header to HTTP request )
+	schedule        string // Schedule of runbook runs in `runn serve`
 	waitTimeout     time.Duration
 	included        bool
 	ifCond          string
@@ -105,8 +107,10 @@ type operator struct {
 	capturers       capturers
 	runResult       *RunResult
 	dbg             *dbg
+	tracer          oteltrace.Tracer
 	hasRunnerRunner bool
 	maskRule        *maskedio.Rule
+	fixtures        *fixtures
 
 	mu sync.Mutex
 }
@@ -146,6 +150,7 @@ func New(opts ...Option) (*operator, error) {
 		thisT:          bk.t,
 		force:          bk.force,
 		trace:          bk.trace,
+		schedule:       bk.schedule,
 		waitTimeout:    bk.waitTimeout,
 		included:       bk.included,
 		ifCond:         bk.ifCond,
@@ -160,7 +165,9 @@ func New(opts ...Option) (*operator, error) {
 		capturers:      bk.capturers,
 		runResult:      newRunResult(bk.desc, bk.labels, bk.path, bk.included, st),
 		dbg:            newDBG(bk.attach),
+		tracer:         newTracer(bk.tracerProvider),
 		maskRule:       st.MaskRule(),
+		fixtures:       bk.fixtures,
 	}
 
 	if op.debug {
@@ -215,16 +222,26 @@ func New(opts ...Option) (*operator, error) {
 				break
 			}
 		}
-		if len(hostRules) > 0 {
-			tp, ok := v.client.Transport.(*http.Transport)
-			if !ok {
-				return nil, fmt.Errorf("failed to cast: %v", v.client.Transport)
-			}
-			tp.DialContext = hostRules.dialContextFunc()
+		if err := v.configureTransport(hostRules); err != nil {
+			return nil, err
 		}
 		if err := v.configureTLS(); err != nil {
 			return nil, err
 		}
+		if bk.cookieJar != "" && v.cookieJar == nil {
+			if err := v.setCookieJar(bk.cookieJar); err != nil {
+				return nil, err
+			}
+		}
+		if bk.fixtures != nil {
+			v.fixtures = bk.fixtures
+			if bk.fixtures.replaying() {
+				// Serve the recorded responses instead of sending requests to the endpoint.
+				v.handler = bk.fixtures.newHTTPReplayHandler()
+				v.client = nil
+				v.auth = nil
+			}
+		}
 		op.httpRunners[k] = v
 	}
 	for k, v := range bk.dbRunners {
@@ -251,6 +268,13 @@ func New(opts ...Option) (*operator, error) {
 			}
 			v.protos = append(v.protos, p)
 		}
+		for _, protoset := range bk.grpcProtosets {
+			key, p := fs.SplitKeyAndPath(protoset)
+			if key != "" && key != k {
+				continue
+			}
+			v.protosets = append(v.protosets, p)
+		}
 		for _, ip := range bk.grpcImportPaths {
 			key, p := fs.SplitKeyAndPath(ip)
 			if key != "" && key != k {
@@ -268,6 +292,22 @@ func New(opts ...Option) (*operator, error) {
 				return nil, err
 			}
 		}
+		if bk.fixtures != nil {
+			if bk.fixtures.recording() && (v.protocol == grpcProtocolGRPCWeb || v.protocol == grpcProtocolConnect) {
+				return nil, fmt.Errorf("recording fixtures is not supported with the %q protocol: %s", v.protocol, k)
+			}
+			v.fixtures = bk.fixtures
+			if bk.fixtures.replaying() {
+				v.auth = nil
+			}
+		}
+		if v.auth != nil {
+			hc, err := v.authHTTPClient()
+			if err != nil {
+				return nil, err
+			}
+			v.auth.client = hc
+		}
 		if v.operatorID == "" {
 			v.operatorID = op.id
 		}
@@ -409,7 +449,7 @@ func (op *operator) Store() map[string]any {
 }
 
 // Close closes all runners and their associated resources.
-// Reusable gRPC runners are always skipped; they are finalized via Terminate().
+// Reusable gRPC, SSH and DB runners are always skipped; they are finalized via Terminate().
 // If force is true, it will close resources even if there are errors.
 func (op *operator) Close(force bool) {
 	for _, r := range op.grpcRunners {
@@ -426,9 +466,15 @@ func (op *operator) Close(force bool) {
 		_ = r.Close()
 	}
 	for _, r := range op.sshRunners {
+		if r.reusable {
+			continue
+		}
 		_ = r.Close()
 	}
 	for _, r := range op.dbRunners {
+		if r.reusable {
+			continue
+		}
 		if !force && r.dsn == "" {
 			continue
 		}
@@ -564,7 +610,7 @@ func (op *operator) runbookID() string { //nolint:unused
 	return op.trails().runbookID()
 }
 
-func (op *operator) runStep(ctx context.Context, s *step) error {
+func (op *operator) runStep(ctx context.Context, s *step) (rerr error) {
 	idx := s.idx
 	if op.t != nil {
 		op.t.Helper()
@@ -574,6 +620,10 @@ func (op *operator) runStep(ctx context.Context, s *step) error {
 	}
 	trs := s.trails()
 	defer op.sw.Start(trs.toProfileIDs()...).Stop()
+	ctx, span := op.startSpan(ctx, trs)
+	defer func() {
+		endSpan(span, rerr)
+	}()
 	op.capturers.setCurrentTrails(trs)
 	if idx != 0 {
 		// interval:
@@ -602,7 +652,7 @@ func (op *operator) runStep(ctx context.Context, s *step) error {
 		op.Debugf(cyan("Run %q on %s\n"), s.runnerKey, op.stepName(idx))
 	}
 
-	stepFn := func(t *testing.T) error {
+	stepFn := func(ctx context.Context, t *testing.T) error {
 		s.clearResult()
 		if t != nil {
 			t.Helper()
@@ -697,6 +747,17 @@ func (op *operator) runStep(ctx context.Context, s *step) error {
 			}
 			run = true
 		}
+		// dbAssert runner
+		if s.dbAssertRunner != nil && s.dbAssertCond != nil {
+			if op.skipTest {
+				op.Debugf(yellow("Skip %q on %s\n"), dbAssertRunnerKey, op.stepName(idx))
+			} else {
+				op.Debugf(cyan("Run %q on %s\n"), dbAssertRunnerKey, op.stepName(idx))
+				if err := s.dbAssertRunner.Run(ctx, s, !run); err != nil {
+					return fmt.Errorf("dbAssert failed on %s: %w", op.stepName(idx), err)
+				}
+			}
+		}
 		// test runner
 		if s.testRunner != nil && s.testCond != "" {
 			if op.skipTest {
@@ -764,7 +825,9 @@ func (op *operator) runStep(ctx context.Context, s *step) error {
 			trs := s.trails()
 			op.capturers.setCurrentTrails(trs)
 			sw := op.sw.Start(trs.toProfileIDs()...)
-			err = stepFn(op.thisT)
+			lctx, lspan := op.startSpan(ctx, trs)
+			err = stepFn(lctx, op.thisT)
+			endSpan(lspan, err)
 			sw.Stop()
 			if err != nil {
 				ue := &ErrUnrecoverable{}
@@ -818,7 +881,7 @@ func (op *operator) runStep(ctx context.Context, s *step) error {
 			}
 		}
 	} else {
-		if err := stepFn(op.thisT); err != nil {
+		if err := stepFn(ctx, op.thisT); err != nil {
 			return err
 		}
 	}
@@ -984,6 +1047,15 @@ func (op *operator) appendStep(idx int, key string, s map[string]any) error {
 		st.bindCond = cond
 		delete(s, bindRunnerKey)
 	}
+	// dbAssert runner
+	if v, ok := s[dbAssertRunnerKey]; ok {
+		st.dbAssertRunner = newDBAssertRunner()
+		if err := validateDBAssertion(v); err != nil {
+			return err
+		}
+		st.dbAssertCond, _ = v.(map[string]any)
+		delete(s, dbAssertRunnerKey)
+	}
 
 	k, v, ok := pop(s)
 	if ok {
@@ -1114,8 +1186,15 @@ func (op *operator) clearResult() {
 }
 
 // run - Minimum unit to run one runbook.
-func (op *operator) run(ctx context.Context) error {
+func (op *operator) run(ctx context.Context) (rerr error) {
 	defer op.sw.Start(op.trails().toProfileIDs()...).Stop()
+	ctx, span := op.startSpan(ctx, op.trails())
+	defer func() {
+		if op.Skipped() {
+			span.SetAttributes(attrSkipped.Bool(true))
+		}
+		endSpan(span, rerr)
+	}()
 	defer func() {
 		// Results for `needs:` are not overwritten.
 		_ = op.nm.TrySet(op.bookPathOrID(), op.runResult.store)
@@ -1222,7 +1301,9 @@ func (op *operator) runLoop(ctx context.Context) error {
 		trs := op.trails()
 		op.capturers.setCurrentTrails(trs)
 		sw := op.sw.Start(trs.toProfileIDs()...)
-		err = op.runInternal(ctx)
+		lctx, lspan := op.startSpan(ctx, trs)
+		err = op.runInternal(lctx)
+		endSpan(lspan, err)
 		if err != nil {
 			sw.Stop()
 			looperr = errors.Join(looperr, fmt.Errorf("loop[%d]: %w", j, err))
@@ -1314,6 +1395,12 @@ func (op *operator) runInternal(ctx context.Context) (rerr error) {
 		}
 	}()
 
+	// Roll back transactions of DB runners left open and restore snapshots (after deferred steps).
+	// This is deferred so that it also runs when the run is included, returns early or is canceled.
+	defer func() {
+		rerr = errors.Join(rerr, op.endDBRunners(context.WithoutCancel(ctx)))
+	}()
+
 	// context done
 	select {
 	case <-ctx.Done():
@@ -1424,6 +1511,19 @@ func (op *operator) runInternal(ctx context.Context) (rerr error) {
 	return
 }
 
+// endDBRunners rolls back the transactions across steps and restores the snapshots of the DB runners defined in the runbook.
+// The runners reused from the parent runbook are left to the parent.
+func (op *operator) endDBRunners(ctx context.Context) error {
+	var err error
+	for _, r := range op.dbRunners {
+		if r.operatorID != op.id {
+			continue
+		}
+		err = errors.Join(err, r.endTx(), r.endSnapshot(ctx))
+	}
+	return err
+}
+
 func (op *operator) bookPathOrID() string {
 	if op.bookPath != "" {
 		return op.bookPath
@@ -1765,6 +1865,16 @@ func (opn *operatorN) Terminate() error {
 				_ = r.Close()
 			}
 		}
+		for _, r := range op.sshRunners {
+			if r.reusable {
+				_ = r.Close()
+			}
+		}
+		for _, r := range op.dbRunners {
+			if r.reusable {
+				_ = r.Close()
+			}
+		}
 	}
 	opn.Close()
 	return nil
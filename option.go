@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/k1LoW/runn/internal/scope"
 	"github.com/k1LoW/runn/internal/store"
 	"github.com/k1LoW/sshc/v4"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/ssh"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/reflect/protoreflect"
@@ -317,8 +319,38 @@ func HTTPRunner(name, endpoint string, client *http.Client, opts ...httpRunnerOp
 			}
 		}
 		r.useCookie = c.UseCookie
+		if c.CookieJar != "" {
+			p, err := fs.Path(c.CookieJar, root)
+			if err != nil {
+				return err
+			}
+			if err := r.setCookieJar(p); err != nil {
+				return err
+			}
+		}
 		r.trace = c.Trace.Enable
 		r.traceHeaderName = c.Trace.HeaderName
+		r.traceFormat = c.Trace.Format
+		r.codecs = c.codecs
+		if c.Auth != nil {
+			a, err := newAuthenticator(c.Auth)
+			if err != nil {
+				bk.runnerErrs[name] = err
+				return nil
+			}
+			a.client = r.client
+			r.auth = a
+		}
+		r.sign = c.Sign
+		if c.Proxy != "" {
+			r.proxy, err = parseProxyURL(c.Proxy)
+			if err != nil {
+				bk.runnerErrs[name] = err
+				return nil
+			}
+		}
+		r.socket = c.Socket
+		r.protocol = c.Protocol
 
 		hv, err := newHttpValidator(c)
 		if err != nil {
@@ -365,6 +397,14 @@ func HTTPRunnerWithHandler(name string, h http.Handler, opts ...httpRunnerOption
 				bk.runnerErrs[name] = errors.New("runn.HTTPRunnerWithHandler does not support option NotFollowRedirect")
 				return nil
 			}
+			if c.Proxy != "" || c.Socket != "" {
+				bk.runnerErrs[name] = errors.New("runn.HTTPRunnerWithHandler does not support option HTTPProxy and HTTPSocket")
+				return nil
+			}
+			if c.Protocol != "" {
+				bk.runnerErrs[name] = errors.New("runn.HTTPRunnerWithHandler does not support option HTTPProtocol")
+				return nil
+			}
 			r.multipartBoundary = c.MultipartBoundary
 			if c.Timeout != "" {
 				r.client.Timeout, err = duration.Parse(c.Timeout)
@@ -372,6 +412,29 @@ func HTTPRunnerWithHandler(name string, h http.Handler, opts ...httpRunnerOption
 					return fmt.Errorf("timeout in HttpRunnerConfig is invalid: %w", err)
 				}
 			}
+			r.codecs = c.codecs
+			if c.Auth != nil {
+				a, err := newAuthenticator(c.Auth)
+				if err != nil {
+					bk.runnerErrs[name] = err
+					return nil
+				}
+				r.auth = a
+			}
+			r.sign = c.Sign
+			if c.CookieJar != "" {
+				root, err := bk.generateOperatorRoot()
+				if err != nil {
+					return err
+				}
+				p, err := fs.Path(c.CookieJar, root)
+				if err != nil {
+					return err
+				}
+				if err := r.setCookieJar(p); err != nil {
+					return err
+				}
+			}
 			v, err := newHttpValidator(c)
 			if err != nil {
 				bk.runnerErrs[name] = err
@@ -420,6 +483,15 @@ func DBRunnerWithOptions(name, dsn string, opts ...dbRunnerOption) Option {
 				}
 			}
 			r.trace = c.Trace
+			r.transaction, err = parseDBTxOptions(c.Transaction)
+			if err != nil {
+				bk.runnerErrs[name] = err
+				return nil
+			}
+			if err := r.setAutoSnapshot(c.Snapshot); err != nil {
+				bk.runnerErrs[name] = err
+				return nil
+			}
 		}
 		bk.dbRunners[name] = r
 		return nil
@@ -498,6 +570,7 @@ func GrpcRunnerWithOptions(name, target string, opts ...grpcRunnerOption) Option
 			}
 			r.importPaths = c.ImportPaths
 			r.protos = c.Protos
+			r.protosets = c.Protosets
 			r.bufDirs = c.BufDirs
 			r.bufLocks = c.BufLocks
 			r.bufConfigs = c.BufConfigs
@@ -505,6 +578,37 @@ func GrpcRunnerWithOptions(name, target string, opts ...grpcRunnerOption) Option
 			r.skipVerify = c.SkipVerify
 			r.trace = c.Trace.Enable
 			r.traceHeaderName = c.Trace.HeaderName
+			r.traceFormat = c.Trace.Format
+			if c.Auth != nil {
+				a, err := newAuthenticator(c.Auth)
+				if err != nil {
+					bk.runnerErrs[name] = err
+					return nil
+				}
+				r.auth = a
+			}
+			if c.Proxy != "" {
+				u, err := parseProxyURL(c.Proxy)
+				if err != nil {
+					bk.runnerErrs[name] = err
+					return nil
+				}
+				r.proxy = u
+			}
+			r.socket = c.Socket
+			if err := validateGRPCProtocol(c.Protocol, c.Codec); err != nil {
+				bk.runnerErrs[name] = err
+				return nil
+			}
+			r.protocol = c.Protocol
+			r.codec = c.Codec
+			r.storeRequest = c.StoreRequest
+			co, err := newGRPCClientOptions(c)
+			if err != nil {
+				bk.runnerErrs[name] = err
+				return nil
+			}
+			r.clientOpts = co
 		}
 		bk.grpcRunners[name] = r
 		return nil
@@ -906,6 +1010,17 @@ func GRPCProtos(protos []string) Option {
 	}
 }
 
+// GRPCProtosets - Set the path to the descriptor set (protoset) for gRPC runners.
+func GRPCProtosets(protosets []string) Option {
+	return func(bk *book) error {
+		if bk == nil {
+			return ErrNilBook
+		}
+		bk.grpcProtosets = protosets
+		return nil
+	}
+}
+
 // GRPCImportPaths - Set the path to the directory where proto sources can be imported for gRPC runners.
 func GRPCImportPaths(paths []string) Option {
 	return func(bk *book) error {
@@ -1181,6 +1296,17 @@ func RunRandom(n int) Option { //nostyle:repetition
 	}
 }
 
+// TracerProvider - Set the OpenTelemetry TracerProvider to export runbook runs as spans.
+func TracerProvider(tp oteltrace.TracerProvider) Option {
+	return func(bk *book) error {
+		if bk == nil {
+			return ErrNilBook
+		}
+		bk.tracerProvider = tp
+		return nil
+	}
+}
+
 // Stdout - Set STDOUT.
 func Stdout(w io.Writer) Option {
 	return func(bk *book) error {
@@ -1240,6 +1366,62 @@ func HostRules(rules ...string) Option {
 	}
 }
 
+// CookieJar - Set the path of the cookie jar file to HTTP runners that do not have their own cookie jar (`cookieJar:`).
+// Cookies are loaded from the file and saved to the file (Netscape cookies.txt or JSON if the extension is .json).
+func CookieJar(path string) Option {
+	return func(bk *book) error {
+		if bk == nil {
+			return ErrNilBook
+		}
+		bk.cookieJar = path
+		return nil
+	}
+}
+
+// Record - Record HTTP/gRPC traffic of the runners to the directory as fixtures.
+func Record(dir string) Option {
+	return fixturesOption(fixtureModeRecord, dir)
+}
+
+// Replay - Replay HTTP/gRPC traffic of the runners from the fixtures in the directory instead of sending requests.
+func Replay(dir string) Option {
+	return fixturesOption(fixtureModeReplay, dir)
+}
+
+// fixturesOption returns the option to share the fixtures across all runbooks.
+func fixturesOption(mode fixtureMode, dir string) Option {
+	var (
+		fx   *fixtures
+		err  error
+		once sync.Once
+	)
+	return func(bk *book) error {
+		if bk == nil {
+			return ErrNilBook
+		}
+		once.Do(func() {
+			fx, err = newFixtures(mode, dir)
+		})
+		if err != nil {
+			return err
+		}
+		return withFixtures(fx)(bk)
+	}
+}
+
+func withFixtures(fx *fixtures) Option {
+	return func(bk *book) error {
+		if bk == nil {
+			return ErrNilBook
+		}
+		if bk.fixtures != nil && bk.fixtures != fx {
+			return errors.New("record and replay cannot be used at the same time")
+		}
+		bk.fixtures = fx
+		return nil
+	}
+}
+
 // bookWithStore - Load runbook with store.
 func bookWithStore(path string, store map[string]any) Option {
 	return func(bk *book) error {
@@ -0,0 +1,145 @@
+package runn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/k1LoW/runn/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/metadata"
+)
+
+const tracerName = "github.com/k1LoW/runn"
+
+// Attribute keys of spans of runbook runs.
+const (
+	attrRunbookID      = attribute.Key("runn.runbook.id")
+	attrRunbookPath    = attribute.Key("runn.runbook.path")
+	attrRunbookDesc    = attribute.Key("runn.runbook.desc")
+	attrStepIndex      = attribute.Key("runn.step.index")
+	attrStepKey        = attribute.Key("runn.step.key")
+	attrStepDesc       = attribute.Key("runn.step.desc")
+	attrStepRunnerType = attribute.Key("runn.step.runner_type")
+	attrStepRunnerKey  = attribute.Key("runn.step.runner_key")
+	attrLoopIndex      = attribute.Key("runn.loop.index")
+	attrSkipped        = attribute.Key("runn.skipped")
+)
+
+var traceContextPropagator = propagation.TraceContext{}
+
+func newTracer(tp oteltrace.TracerProvider) oteltrace.Tracer {
+	if tp == nil {
+		tp = noop.NewTracerProvider()
+	}
+	return tp.Tracer(tracerName, oteltrace.WithInstrumentationVersion(version.Version))
+}
+
+// startSpan starts the span of the last element of the trails.
+func (op *operator) startSpan(ctx context.Context, trs Trails) (context.Context, oteltrace.Span) {
+	tracer := op.tracer
+	if tracer == nil {
+		tracer = newTracer(nil)
+	}
+	tr := trs[len(trs)-1]
+	return tracer.Start(ctx, tr.spanName(), oteltrace.WithAttributes(tr.spanAttributes()...))
+}
+
+// endSpan ends the span with the result of the run.
+func endSpan(span oteltrace.Span, err error) {
+	switch {
+	case errors.Is(errStepSkipped, err):
+		span.SetAttributes(attrSkipped.Bool(true))
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (tr Trail) spanName() string { //nostyle:recvtype
+	switch tr.Type {
+	case TrailTypeRunbook:
+		if tr.Desc != "" {
+			return fmt.Sprintf("runbook[%s]", tr.Desc)
+		}
+		return tr.String()
+	case TrailTypeStep:
+		key := tr.StepRunnerKey
+		if key == "" {
+			key = string(tr.StepRunnerType)
+		}
+		if key == "" {
+			return tr.String()
+		}
+		return fmt.Sprintf("steps[%s].%s", tr.StepKey, key)
+	default:
+		return tr.String()
+	}
+}
+
+func (tr Trail) spanAttributes() []attribute.KeyValue { //nostyle:recvtype
+	var attrs []attribute.KeyValue
+	switch tr.Type {
+	case TrailTypeRunbook:
+		attrs = append(attrs, attrRunbookID.String(tr.RunbookID), attrRunbookPath.String(tr.RunbookPath))
+		if tr.Desc != "" {
+			attrs = append(attrs, attrRunbookDesc.String(tr.Desc))
+		}
+	case TrailTypeStep:
+		attrs = append(attrs, attrStepKey.String(tr.StepKey))
+		if tr.StepIndex != nil {
+			attrs = append(attrs, attrStepIndex.Int(*tr.StepIndex))
+		}
+		if tr.Desc != "" {
+			attrs = append(attrs, attrStepDesc.String(tr.Desc))
+		}
+		if tr.StepRunnerType != "" {
+			attrs = append(attrs, attrStepRunnerType.String(string(tr.StepRunnerType)))
+		}
+		if tr.StepRunnerKey != "" {
+			attrs = append(attrs, attrStepRunnerKey.String(tr.StepRunnerKey))
+		}
+	case TrailTypeLoop:
+		if tr.LoopIndex != nil {
+			attrs = append(attrs, attrLoopIndex.Int(*tr.LoopIndex))
+		}
+	}
+	return attrs
+}
+
+// injectTraceContext injects the span context in ctx into the carrier as W3C trace context.
+// A traceparent already set by the trace config ( which carries the span context of ctx too ) or by the step takes precedence.
+func injectTraceContext(ctx context.Context, carrier propagation.TextMapCarrier) {
+	if carrier.Get(w3cTraceparentHeaderName) != "" {
+		return
+	}
+	traceContextPropagator.Inject(ctx, carrier)
+}
+
+// metadataCarrier adapts metadata.MD to satisfy the propagation.TextMapCarrier interface.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	v := metadata.MD(c).Get(key)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,146 @@
+package runn
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/k1LoW/runn/testutil"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracerProvider(t *testing.T) {
+	ctx := context.Background()
+	ts, r := testutil.HTTPServerAndRouter(t)
+	t.Setenv("HTTPBIN_END_POINT", ts.URL)
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	t.Cleanup(func() {
+		_ = tp.Shutdown(ctx)
+	})
+	o, err := New(Book("testdata/book/otel.yml"), TracerProvider(tp), Stdout(io.Discard), Stderr(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := sr.Ended()
+	var root sdktrace.ReadOnlySpan
+	got := map[string]int{}
+	for _, s := range spans {
+		got[s.Name()]++
+		if !s.Parent().IsValid() {
+			if root != nil {
+				t.Fatalf("multiple root spans: %s and %s", root.Name(), s.Name())
+			}
+			root = s
+		}
+	}
+	want := map[string]int{
+		"runbook[Test for OpenTelemetry]": 1,
+		"steps[getUser].req":              1,
+		"steps[getUsersWithLoop].req":     1,
+		"loop[0]":                         1,
+		"loop[1]":                         1,
+	}
+	for name, n := range want {
+		if got[name] != n {
+			t.Errorf("got %d spans named %q, want %d (spans: %v)", got[name], name, n, got)
+		}
+	}
+	if root == nil {
+		t.Fatal("root span not found")
+	}
+	for _, s := range spans {
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %q has different trace ID", s.Name())
+		}
+	}
+
+	reqs := r.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(reqs))
+	}
+	for _, req := range reqs {
+		tp := req.Header.Get("traceparent")
+		if tp == "" {
+			t.Errorf("traceparent header is not set: %s", req.URL.Path)
+			continue
+		}
+		if want := root.SpanContext().TraceID().String(); tp[3:35] != want {
+			t.Errorf("got trace ID %s, want %s", tp[3:35], want)
+		}
+	}
+}
+
+func TestTracerProviderNotSet(t *testing.T) {
+	ctx := context.Background()
+	ts, r := testutil.HTTPServerAndRouter(t)
+	t.Setenv("HTTPBIN_END_POINT", ts.URL)
+	o, err := New(Book("testdata/book/otel.yml"), Stdout(io.Discard), Stderr(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range r.Requests() {
+		if got := req.Header.Get("traceparent"); got != "" {
+			t.Errorf("traceparent header should not be set: %s", got)
+		}
+	}
+}
+
+func TestTracerProviderWithW3CTraceFormat(t *testing.T) {
+	ctx := context.Background()
+	ts, r := testutil.HTTPServerAndRouter(t)
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	t.Cleanup(func() {
+		_ = tp.Shutdown(ctx)
+	})
+	o, err := New(
+		Book("testdata/book/trace_format.yml"),
+		HTTPRunner("req", ts.URL, ts.Client(), HTTPTrace(true), HTTPTraceFormat(traceFormatW3C)),
+		TracerProvider(tp),
+		Stdout(io.Discard),
+		Stderr(io.Discard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spanIDs := map[string]string{}
+	var traceID string
+	for _, s := range sr.Ended() {
+		spanIDs[s.SpanContext().SpanID().String()] = s.Name()
+		traceID = s.SpanContext().TraceID().String()
+	}
+	reqs := r.Requests()
+	if len(reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(reqs))
+	}
+	// The IDs of the exported spans win over the IDs derived from the trails
+	for _, req := range reqs {
+		tp := req.Header.Get("traceparent")
+		if len(tp) != 55 {
+			t.Errorf("invalid traceparent header: %q", tp)
+			continue
+		}
+		if got := tp[3:35]; got != traceID {
+			t.Errorf("got trace ID %s, want %s", got, traceID)
+		}
+		if got := tp[36:52]; spanIDs[got] == "" {
+			t.Errorf("span ID %s is not the ID of the exported spans", got)
+		}
+		if got := req.Header.Get("baggage"); got == "" {
+			t.Error("baggage header is not set")
+		}
+	}
+}
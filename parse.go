@@ -102,6 +102,28 @@ func parseHTTPRequest(v map[string]any) (*httpRequest, error) {
 					}
 				}
 			}
+			sm, ok := vvvvv["stream"]
+			if ok && sm != nil {
+				req.stream, err = newHTTPStream(sm)
+				if err != nil {
+					return nil, fmt.Errorf("invalid request: %w", err)
+				}
+			}
+			stm, ok := vvvvv["saveTo"]
+			if ok && stm != nil {
+				saveTo, ok := stm.(string)
+				if !ok || saveTo == "" {
+					return nil, fmt.Errorf("invalid request: %s", string(part))
+				}
+				req.saveTo = saveTo
+			}
+			sgm, ok := vvvvv["sign"]
+			if ok && sgm != nil {
+				req.sign, err = newSignConfig(sgm)
+				if err != nil {
+					return nil, fmt.Errorf("invalid request: %w", err)
+				}
+			}
 		}
 
 		break
@@ -118,8 +140,22 @@ func parseDBQuery(v map[string]any) (*dbQuery, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(v) != 1 {
-		return nil, fmt.Errorf("invalid query: %s", string(part))
+	for k := range v {
+		switch k {
+		case "query", "trace", "args", "namedArgs":
+		case dbTxBegin, dbTxCommit, dbTxRollback:
+			if len(v) != 1 {
+				return nil, fmt.Errorf("invalid query: %s cannot be used with other keys: %s", k, string(part))
+			}
+			return parseDBTxOp(k, v[k])
+		case dbFixtures, dbSnapshot, dbRestore:
+			if len(v) != 1 {
+				return nil, fmt.Errorf("invalid query: %s cannot be used with other keys: %s", k, string(part))
+			}
+			return parseDBFixtureOp(k, v[k])
+		default:
+			return nil, fmt.Errorf("invalid query: %s", string(part))
+		}
 	}
 	s, ok := v["query"]
 	if !ok {
@@ -141,6 +177,69 @@ func parseDBQuery(v map[string]any) (*dbQuery, error) {
 			}
 		}
 	}
+	if a, ok := v["args"]; ok && a != nil {
+		args, ok := a.([]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid query: args should be a list: %s", string(part))
+		}
+		q.args = args
+	}
+	if a, ok := v["namedArgs"]; ok && a != nil {
+		namedArgs, ok := a.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid query: namedArgs should be a map: %s", string(part))
+		}
+		q.namedArgs = namedArgs
+	}
+	return q, nil
+}
+
+// parseDBTxOp parses `begin:`, `commit:` or `rollback:` of the DB step.
+func parseDBTxOp(op string, v any) (*dbQuery, error) {
+	q := &dbQuery{txOp: op}
+	if op != dbTxBegin {
+		switch vv := v.(type) {
+		case nil:
+		case bool:
+			if !vv {
+				return nil, fmt.Errorf("invalid query: %s should be true", op)
+			}
+		default:
+			return nil, fmt.Errorf("invalid query: %s should be true: %v", op, v)
+		}
+		return q, nil
+	}
+	if b, ok := v.(bool); ok && !b {
+		return nil, fmt.Errorf("invalid query: %s should be true", op)
+	}
+	if v == nil {
+		v = true
+	}
+	opts, err := parseDBTxOptions(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	q.txOpts = opts
+	return q, nil
+}
+
+// parseDBFixtureOp parses `fixtures:`, `snapshot:` or `restore:` of the DB step.
+func parseDBFixtureOp(op string, v any) (*dbQuery, error) {
+	q := &dbQuery{fixtureOp: op}
+	var err error
+	switch op {
+	case dbFixtures:
+		q.fixtures, err = parseDBFixtureConfig(v)
+	case dbSnapshot:
+		q.tables, err = parseDBSnapshotTables(v)
+	case dbRestore:
+		if b, ok := v.(bool); v != nil && (!ok || !b) {
+			err = fmt.Errorf("%s should be true: %v", op, v)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
 	return q, nil
 }
 
@@ -165,6 +264,15 @@ func parseGrpcRequest(v map[string]any, s *step, expand func(any, *step) (any, e
 		if !ok {
 			return nil, fmt.Errorf("invalid request: %s", string(part))
 		}
+		if pes == grpcHealthKey {
+			// `health:` is the shorthand of the grpc.health.v1.Health/Check
+			vv, err = parseGrpcHealth(vv)
+			if err != nil {
+				return nil, fmt.Errorf("invalid request: %s: %w", string(part), err)
+			}
+			pes = grpcHealthCheckMethod
+			req.health = true
+		}
 		svc, mth, err := parseServiceAndMethod(pes)
 		if err != nil {
 			return nil, err
@@ -270,6 +378,14 @@ func parseGrpcRequest(v map[string]any, s *step, expand func(any, *step) (any, e
 							op: op,
 						})
 					case map[string]any:
+						if rv, ok := v[string(GRPCOpReceive)]; ok && len(v) == 1 {
+							m, err := parseGrpcReceive(rv)
+							if err != nil {
+								return nil, fmt.Errorf("invalid request: %s: %w", string(part), err)
+							}
+							req.messages = append(req.messages, m)
+							continue
+						}
 						req.messages = append(req.messages, &grpcMessage{
 							op:     GRPCOpMessage,
 							params: v,
@@ -295,6 +411,43 @@ func parseGrpcRequest(v map[string]any, s *step, expand func(any, *step) (any, e
 	return req, nil
 }
 
+// parseGrpcReceive parses the receive op with the options (e.g. `receive: {until: ..., timeout: ...}`).
+func parseGrpcReceive(v any) (*grpcMessage, error) {
+	m := &grpcMessage{
+		op: GRPCOpReceive,
+	}
+	if v == nil {
+		return m, nil
+	}
+	vv, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid receive: %v", v)
+	}
+	for k, o := range vv {
+		switch k {
+		case "until":
+			until, ok := o.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid receive until: %v", o)
+			}
+			m.until = until
+		case "timeout":
+			timeout, ok := o.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid receive timeout: %v", o)
+			}
+			d, err := parseDuration(timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid receive timeout: %w", err)
+			}
+			m.timeout = d
+		default:
+			return nil, fmt.Errorf("invalid receive option: %s", k)
+		}
+	}
+	return m, nil
+}
+
 func parseCDPActions(v map[string]any, s *step, expand func(any, *step) (any, error)) (CDPActions, error) {
 	v = trimDelimiter(v)
 	cas := CDPActions{}
@@ -379,6 +532,32 @@ func parseSSHCommand(v map[string]any, s *step, expand func(any, *step) (any, er
 	return sc, nil
 }
 
+// parseGrpcHealth converts the value of `health:` into the request of grpc.health.v1.Health/Check.
+// The value is empty, the service name or the map with `service:`, `headers:` and `timeout:`.
+func parseGrpcHealth(v any) (map[string]any, error) {
+	switch vv := v.(type) {
+	case nil:
+		return map[string]any{"message": map[string]any{"service": ""}}, nil
+	case string:
+		return map[string]any{"message": map[string]any{"service": vv}}, nil
+	case map[string]any:
+		hc := map[string]any{"message": map[string]any{"service": ""}}
+		for k, vvv := range vv {
+			switch k {
+			case "service":
+				hc["message"] = map[string]any{"service": vvv}
+			case "headers", "timeout":
+				hc[k] = vvv
+			default:
+				return nil, fmt.Errorf("unsupported key of health: %s", k)
+			}
+		}
+		return hc, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of health: %v", v)
+	}
+}
+
 func parseServiceAndMethod(in string) (string, string, error) {
 	splitted := strings.Split(strings.TrimPrefix(in, "/"), "/")
 	if len(splitted) < 2 {
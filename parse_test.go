@@ -1,6 +1,7 @@
 package runn
 
 import (
+	"database/sql"
 	"net/http"
 	"testing"
 	"time"
@@ -209,6 +210,129 @@ query: |
 			},
 			false,
 		},
+		{
+			`
+query: SELECT * FROM users WHERE name = ? AND age > ?;
+args:
+  - alice
+  - 20
+`,
+			&dbQuery{
+				stmt: "SELECT * FROM users WHERE name = ? AND age > ?;",
+				args: []any{"alice", uint64(20)},
+			},
+			false,
+		},
+		{
+			`
+query: SELECT * FROM users WHERE name = :name;
+namedArgs:
+  name: alice
+trace: true
+`,
+			&dbQuery{
+				stmt:      "SELECT * FROM users WHERE name = :name;",
+				namedArgs: map[string]any{"name": "alice"},
+				trace:     func() *bool { v := true; return &v }(),
+			},
+			false,
+		},
+		{
+			`
+query: SELECT * FROM users WHERE name = ?;
+args: alice
+`,
+			nil,
+			true,
+		},
+		{
+			`
+query: SELECT * FROM users;
+unknown: value
+`,
+			nil,
+			true,
+		},
+		{
+			`
+begin:
+`,
+			&dbQuery{txOp: dbTxBegin, txOpts: &sql.TxOptions{}},
+			false,
+		},
+		{
+			`
+begin:
+  isolationLevel: read committed
+  readOnly: true
+`,
+			&dbQuery{txOp: dbTxBegin, txOpts: &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true}},
+			false,
+		},
+		{
+			`
+rollback: true
+`,
+			&dbQuery{txOp: dbTxRollback},
+			false,
+		},
+		{
+			`
+commit: true
+query: SELECT 1;
+`,
+			nil,
+			true,
+		},
+		{
+			`
+begin:
+  isolationLevel: unknown
+`,
+			nil,
+			true,
+		},
+		{
+			`
+fixtures: fixtures/users.yml
+`,
+			&dbQuery{fixtureOp: dbFixtures, fixtures: &dbFixtureConfig{paths: []string{"fixtures/users.yml"}, truncate: true}},
+			false,
+		},
+		{
+			`
+fixtures:
+  paths:
+    - fixtures/users.yml
+    - fixtures/posts.csv
+  truncate: false
+`,
+			&dbQuery{fixtureOp: dbFixtures, fixtures: &dbFixtureConfig{paths: []string{"fixtures/users.yml", "fixtures/posts.csv"}}},
+			false,
+		},
+		{
+			`
+snapshot:
+  - users
+`,
+			&dbQuery{fixtureOp: dbSnapshot, tables: []string{"users"}},
+			false,
+		},
+		{
+			`
+restore: true
+`,
+			&dbQuery{fixtureOp: dbRestore},
+			false,
+		},
+		{
+			`
+fixtures:
+  truncate: true
+`,
+			nil,
+			true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -226,7 +350,7 @@ query: |
 		if tt.wantErr {
 			t.Error("want error")
 		}
-		opts := cmp.AllowUnexported(dbQuery{})
+		opts := cmp.AllowUnexported(dbQuery{}, dbFixtureConfig{})
 		if diff := cmp.Diff(got, tt.want, opts); diff != "" {
 			t.Error(diff)
 		}
@@ -241,6 +365,57 @@ func TestParseGrpcRequest(t *testing.T) {
 	}{
 		{
 			`
+health:
+`,
+			&grpcRequest{
+				service: "grpc.health.v1.Health",
+				method:  "Check",
+				headers: metadata.MD{},
+				messages: []*grpcMessage{
+					{
+						op:     GRPCOpMessage,
+						params: map[string]any{"service": ""},
+					},
+				},
+				health: true,
+			},
+			false,
+		},
+		{
+			`
+health:
+  service: myapp.MyService
+  headers:
+    authorization: "Bearer token"
+  timeout: 3sec
+`,
+			&grpcRequest{
+				service: "grpc.health.v1.Health",
+				method:  "Check",
+				headers: metadata.MD{
+					"authorization": []string{"Bearer token"},
+				},
+				messages: []*grpcMessage{
+					{
+						op:     GRPCOpMessage,
+						params: map[string]any{"service": "myapp.MyService"},
+					},
+				},
+				timeout: 3 * time.Second,
+				health:  true,
+			},
+			false,
+		},
+		{
+			`
+health:
+  unknown: value
+`,
+			nil,
+			true,
+		},
+		{
+			`
 my.custom.server.Service/Method:
   headers:
     user-agent: "runn/dev"
@@ -340,6 +515,61 @@ my.custom.server.Service/Method:
 		},
 		{
 			`
+my.custom.server.Service/Method:
+  messages:
+    -
+      key: value
+    -
+      receive:
+        until: current.res.message.done == true
+        timeout: 5sec
+    -
+      ack: "{{ current.res.message.seq }}"
+    -
+      close
+`,
+			&grpcRequest{
+				service: "my.custom.server.Service",
+				method:  "Method",
+				headers: metadata.MD{},
+				messages: []*grpcMessage{
+					{
+						op: GRPCOpMessage,
+						params: map[string]any{
+							"key": "value",
+						},
+					},
+					{
+						op:      GRPCOpReceive,
+						until:   "current.res.message.done == true",
+						timeout: 5 * time.Second,
+					},
+					{
+						op: GRPCOpMessage,
+						params: map[string]any{
+							"ack": "{{ current.res.message.seq }}",
+						},
+					},
+					{
+						op: GRPCOpClose,
+					},
+				},
+			},
+			false,
+		},
+		{
+			`
+my.custom.server.Service/Method:
+  messages:
+    -
+      receive:
+        count: 3
+`,
+			nil,
+			true,
+		},
+		{
+			`
 "{{ vars.path }}":
   headers:
     "{{ vars.one }}": "{{ vars.two }}"
@@ -0,0 +1,284 @@
+package runn
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	proxySchemeHTTP    = "http"
+	proxySchemeHTTPS   = "https"
+	proxySchemeSOCKS5  = "socks5"
+	proxySchemeSOCKS5H = "socks5h"
+)
+
+type contextDialerFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// DialContext implements proxy.ContextDialer.
+func (f contextDialerFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// Dial implements proxy.Dialer.
+func (f contextDialerFunc) Dial(network, addr string) (net.Conn, error) {
+	return f(context.Background(), network, addr)
+}
+
+// parseProxyURL parses the URL of the proxy (http://, https://, socks5:// or socks5h://).
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	switch u.Scheme {
+	case proxySchemeHTTP, proxySchemeHTTPS, proxySchemeSOCKS5, proxySchemeSOCKS5H:
+	default:
+		return nil, fmt.Errorf("invalid proxy: unsupported scheme %q (should be %q, %q, %q or %q)", u.Scheme, proxySchemeHTTP, proxySchemeHTTPS, proxySchemeSOCKS5, proxySchemeSOCKS5H)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy: host is required: %s", s)
+	}
+	return u, nil
+}
+
+// proxyAddr returns the address of the proxy with the default port of the scheme.
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case proxySchemeHTTPS:
+		return net.JoinHostPort(u.Hostname(), "443")
+	case proxySchemeSOCKS5, proxySchemeSOCKS5H:
+		return net.JoinHostPort(u.Hostname(), "1080")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
+
+// unixSocketDialContextFunc returns the DialContext that always connects to the Unix domain socket.
+func unixSocketDialContextFunc(socket string) contextDialerFunc {
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+}
+
+// configureTransport configures the proxy and the dialer of the HTTP transport.
+// The host rules are applied to the address of the target, not to the address of the proxy.
+// With the HTTP proxy, plain HTTP targets are requested through the proxy in absolute-form (see proxiedRequest) and the others are connected through the proxy (CONNECT).
+func (rnr *httpRunner) configureTransport(hr hostRules) error {
+	if rnr.client == nil || (len(hr) == 0 && rnr.proxy == nil && rnr.socket == "") {
+		return nil
+	}
+	if rnr.protocol == httpProtocolH3 {
+		return fmt.Errorf("protocol %q does not support proxy, socket and host rules", rnr.protocol)
+	}
+	tp, ok := rnr.client.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("failed to cast: %v", rnr.client.Transport)
+	}
+	switch {
+	case rnr.socket != "":
+		tp.DialContext = unixSocketDialContextFunc(rnr.socket)
+	case rnr.proxy != nil && len(hr) > 0:
+		rnr.hostRules = hr
+		var d net.Dialer
+		pd, err := proxyDialContextFunc(rnr.proxy, d.DialContext)
+		if err != nil {
+			return err
+		}
+		pa := proxyAddr(rnr.proxy)
+		if rnr.isHTTPProxy() {
+			tp.Proxy = func(req *http.Request) (*url.URL, error) {
+				if req.URL.Scheme != "http" {
+					return nil, nil
+				}
+				return rnr.proxy, nil
+			}
+		}
+		tp.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if tp.Proxy != nil && addr == pa {
+				// Connection to the HTTP proxy for plain HTTP targets
+				return d.DialContext(ctx, network, addr)
+			}
+			addr, err := hr.replaceAddr(addr)
+			if err != nil {
+				return nil, err
+			}
+			return pd(ctx, network, addr)
+		}
+		return nil
+	case len(hr) > 0:
+		tp.DialContext = hr.dialContextFunc()
+	}
+	if rnr.proxy != nil {
+		tp.Proxy = http.ProxyURL(rnr.proxy)
+	}
+	return nil
+}
+
+// isHTTPProxy reports whether the proxy of the runner is the HTTP proxy (http:// or https://).
+func (rnr *httpRunner) isHTTPProxy() bool {
+	return rnr.proxy != nil && (rnr.proxy.Scheme == proxySchemeHTTP || rnr.proxy.Scheme == proxySchemeHTTPS)
+}
+
+// proxiedRequest returns the request with the host rules applied if it is sent to the plain HTTP target through the HTTP proxy.
+// The HTTP proxy connects to the host of the request URL (absolute-form), so the host rules are applied to the URL and the Host header is kept.
+func (rnr *httpRunner) proxiedRequest(req *http.Request) (*http.Request, error) {
+	if len(rnr.hostRules) == 0 || !rnr.isHTTPProxy() || req.URL.Scheme != "http" {
+		return req, nil
+	}
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "80")
+	}
+	raddr, err := rnr.hostRules.replaceAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if raddr == addr {
+		return req, nil
+	}
+	r := req.Clone(req.Context())
+	if r.Host == "" {
+		r.Host = req.URL.Host
+	}
+	r.URL.Host = raddr
+	return r, nil
+}
+
+// do sends the request using the client with the host rules applied for the HTTP proxy.
+func (rnr *httpRunner) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	preq, err := rnr.proxiedRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(preq) //nolint:gosec
+}
+
+// contextDialerFunc returns the dialer for grpc.WithContextDialer.
+// The host rules are applied to the address of the target, not to the address of the proxy.
+// It returns nil if the default dialer of gRPC can be used.
+func (rnr *grpcRunner) contextDialerFunc() (func(ctx context.Context, address string) (net.Conn, error), error) {
+	if rnr.socket != "" {
+		d := unixSocketDialContextFunc(rnr.socket)
+		return func(ctx context.Context, _ string) (net.Conn, error) {
+			return d(ctx, "unix", "")
+		}, nil
+	}
+	if rnr.proxy == nil {
+		if len(rnr.hostRules) == 0 {
+			return nil, nil
+		}
+		return rnr.hostRules.contextDialerFunc(), nil
+	}
+	pd, err := proxyDialContextFunc(rnr.proxy, func(ctx context.Context, _, addr string) (net.Conn, error) {
+		var d net.Dialer
+		network, addr := parseDialTarget(addr)
+		return d.DialContext(ctx, network, addr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		if len(rnr.hostRules) > 0 {
+			var err error
+			address, err = rnr.hostRules.replaceAddr(address)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return pd(ctx, "tcp", address)
+	}, nil
+}
+
+// proxyDialContextFunc returns the DialContext that connects to the address through the proxy.
+// forward is used to connect to the proxy.
+func proxyDialContextFunc(u *url.URL, forward contextDialerFunc) (contextDialerFunc, error) {
+	switch u.Scheme {
+	case proxySchemeSOCKS5, proxySchemeSOCKS5H:
+		var auth *proxy.Auth
+		if u.User != nil {
+			p, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: p}
+		}
+		d, err := proxy.SOCKS5("tcp", proxyAddr(u), auth, forward)
+		if err != nil {
+			return nil, err
+		}
+		cd, ok := d.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("failed to cast: %v", d)
+		}
+		return cd.DialContext, nil
+	case proxySchemeHTTP, proxySchemeHTTPS:
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return httpConnect(ctx, u, forward, addr)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid proxy: unsupported scheme %q", u.Scheme)
+	}
+}
+
+// httpConnect connects to the address through the HTTP proxy using the CONNECT method.
+func httpConnect(ctx context.Context, u *url.URL, forward contextDialerFunc, addr string) (_ net.Conn, err error) {
+	conn, err := forward(ctx, "tcp", proxyAddr(u))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+		}
+	}()
+	if u.Scheme == proxySchemeHTTPS {
+		tc := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return nil, err
+		}
+		conn = tc
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() {
+			_ = conn.SetDeadline(time.Time{})
+		}()
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		p, _ := u.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+p)))
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to connect through the proxy: %s", res.Status)
+	}
+	if br.Buffered() > 0 {
+		return nil, errors.New("unexpected data from the proxy")
+	}
+	return conn, nil
+}
@@ -0,0 +1,440 @@
+package runn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/k1LoW/runn/internal/expr"
+)
+
+type resultKind string
+
+const (
+	resultKindLoadt resultKind = "loadt"
+	resultKindRunN  resultKind = "run"
+)
+
+// resultSummary is the common form of a load test result and a run result for comparison.
+type resultSummary struct {
+	kind      resultKind
+	total     int64
+	succeeded int64
+	failed    int64
+	skipped   int64
+	errorRate float64
+	rps       float64
+	// latencies in milliseconds
+	max float64
+	min float64
+	avg float64
+	med float64
+	p90 float64
+	p95 float64
+	p99 float64
+	// results of runbooks keyed by resultKey ( run result only )
+	results map[string]*runResultSimplified
+}
+
+type resultDiff struct {
+	base         *resultSummary
+	head         *resultSummary
+	newlyFailing []*runResultSimplified
+	newlyPassing []*runResultSimplified
+	newlyAdded   []*runResultSimplified
+	newlyRemoved []*runResultSimplified
+}
+
+type resultDiffJSON struct {
+	Kind         string             `json:"kind"`
+	Base         map[string]any     `json:"base"`
+	Head         map[string]any     `json:"head"`
+	Diff         map[string]any     `json:"diff"`
+	NewlyFailing []*resultDiffEntry `json:"newly_failing,omitempty"`
+	NewlyPassing []*resultDiffEntry `json:"newly_passing,omitempty"`
+	Added        []*resultDiffEntry `json:"added,omitempty"`
+	Removed      []*resultDiffEntry `json:"removed,omitempty"`
+}
+
+type resultDiffEntry struct {
+	ID   string `json:"id"`
+	Desc string `json:"desc,omitempty"`
+	Path string `json:"path"`
+}
+
+const diffReportTemplate = `
+Base...........................: total={{ .Base.total }} succeeded={{ .Base.succeeded }} failed={{ .Base.failed }}
+Head...........................: total={{ .Head.total }} succeeded={{ .Head.succeeded }} failed={{ .Head.failed }}
+
+Error rate.....................: {{ .ErrorRate }}
+{{- if .RPS }}
+RunN per second................: {{ .RPS }}
+{{- end }}
+Latency max....................: {{ .Max }}
+Latency min....................: {{ .Min }}
+Latency avg....................: {{ .Avg }}
+Latency med....................: {{ .Med }}
+Latency p(90)..................: {{ .P90 }}
+Latency p(95)..................: {{ .P95 }}
+Latency p(99)..................: {{ .P99 }}
+{{- if .ShowRunbooks }}
+
+Newly failing runbooks.........: {{ len .NewlyFailing }}
+{{- range .NewlyFailing }}
+  {{ . }}
+{{- end }}
+Newly passing runbooks.........: {{ len .NewlyPassing }}
+{{- range .NewlyPassing }}
+  {{ . }}
+{{- end }}
+{{- if .Added }}
+Added runbooks.................: {{ len .Added }}
+{{- range .Added }}
+  {{ . }}
+{{- end }}
+{{- end }}
+{{- if .Removed }}
+Removed runbooks...............: {{ len .Removed }}
+{{- range .Removed }}
+  {{ . }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+`
+
+// NewResultDiff compares two results output in JSON format ( `runn loadt --format json` or `runn run --format json` ).
+func NewResultDiff(base, head []byte) (*resultDiff, error) {
+	bs, err := parseResultSummary(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base result: %w", err)
+	}
+	hs, err := parseResultSummary(head)
+	if err != nil {
+		return nil, fmt.Errorf("invalid head result: %w", err)
+	}
+	if bs.kind != hs.kind {
+		return nil, fmt.Errorf("cannot compare different kinds of results: base=%s head=%s", bs.kind, hs.kind)
+	}
+	d := &resultDiff{
+		base: bs,
+		head: hs,
+	}
+	if bs.kind != resultKindRunN {
+		return d, nil
+	}
+	for _, k := range sortedResultKeys(hs.results) {
+		hr := hs.results[k]
+		br, ok := bs.results[k]
+		if !ok {
+			d.newlyAdded = append(d.newlyAdded, hr)
+			continue
+		}
+		switch {
+		case br.Result != resultFailure && hr.Result == resultFailure:
+			d.newlyFailing = append(d.newlyFailing, hr)
+		case br.Result == resultFailure && hr.Result == resultSuccess:
+			d.newlyPassing = append(d.newlyPassing, hr)
+		}
+	}
+	for _, k := range sortedResultKeys(bs.results) {
+		if _, ok := hs.results[k]; !ok {
+			d.newlyRemoved = append(d.newlyRemoved, bs.results[k])
+		}
+	}
+	return d, nil
+}
+
+func parseResultSummary(b []byte) (*resultSummary, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	switch {
+	case keys["results"] != nil:
+		var r runNResultSimplified
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+		return summarizeRunNResult(&r), nil
+	case keys["rps"] != nil:
+		var r loadtResultJSON
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+		return summarizeLoadtResult(&r), nil
+	default:
+		return nil, errors.New("unknown result format")
+	}
+}
+
+func summarizeLoadtResult(r *loadtResultJSON) *resultSummary {
+	return &resultSummary{
+		kind:      resultKindLoadt,
+		total:     r.Total,
+		succeeded: r.Succeeded,
+		failed:    r.Failed,
+		errorRate: r.ErrorRate,
+		rps:       r.RPS,
+		max:       r.LatencyMaxMs,
+		min:       r.LatencyMinMs,
+		avg:       r.LatencyAvgMs,
+		med:       r.LatencyMedMs,
+		p90:       r.LatencyP90Ms,
+		p95:       r.LatencyP95Ms,
+		p99:       r.LatencyP99Ms,
+	}
+}
+
+func summarizeRunNResult(r *runNResultSimplified) *resultSummary {
+	s := &resultSummary{
+		kind:      resultKindRunN,
+		total:     r.Total,
+		succeeded: r.Success,
+		failed:    r.Failure,
+		skipped:   r.Skipped,
+		results:   map[string]*runResultSimplified{},
+	}
+	var ll []float64
+	occurrences := map[string]int{}
+	for _, rr := range r.Results {
+		s.results[resultKey(rr.ID, occurrences[rr.ID])] = rr
+		occurrences[rr.ID]++
+		if rr.Result == resultSkipped {
+			continue
+		}
+		ll = append(ll, float64(rr.Elapsed)/float64(time.Millisecond))
+	}
+	if ran := s.succeeded + s.failed; ran > 0 {
+		s.errorRate = float64(s.failed) / float64(ran) * 100
+	}
+	if len(ll) == 0 {
+		return s
+	}
+	sort.Float64s(ll)
+	var sum float64
+	for _, l := range ll {
+		sum += l
+	}
+	s.max = ll[len(ll)-1]
+	s.min = ll[0]
+	s.avg = sum / float64(len(ll))
+	s.med = percentile(ll, 50)
+	s.p90 = percentile(ll, 90)
+	s.p95 = percentile(ll, 95)
+	s.p99 = percentile(ll, 99)
+	return s
+}
+
+// resultKey returns the key of the n-th (0-origin) result of the runbook.
+// The same runbook can run more than once ( loop, --shuffle, --sample or the same path listed twice ).
+func resultKey(id string, n int) string {
+	return fmt.Sprintf("%s#%d", id, n)
+}
+
+// percentile returns the p-th percentile of sorted values using the nearest-rank method.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func sortedResultKeys(m map[string]*runResultSimplified) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (s *resultSummary) toMap() map[string]any {
+	m := map[string]any{
+		"total":      s.total,
+		"succeeded":  s.succeeded,
+		"failed":     s.failed,
+		"error_rate": s.errorRate,
+		"max":        s.max,
+		"mid":        s.med,
+		"min":        s.min,
+		"p90":        s.p90,
+		"p95":        s.p95,
+		"p99":        s.p99,
+		"avg":        s.avg,
+	}
+	switch s.kind {
+	case resultKindLoadt:
+		m["rps"] = s.rps
+	case resultKindRunN:
+		m["skipped"] = s.skipped
+	}
+	return m
+}
+
+// deltaMap returns the differences of the values of head from base.
+func (d *resultDiff) deltaMap() map[string]any {
+	bm := d.base.toMap()
+	hm := d.head.toMap()
+	dm := map[string]any{}
+	for k, hv := range hm {
+		switch v := hv.(type) {
+		case int64:
+			dm[k] = v - bm[k].(int64)
+		case float64:
+			dm[k] = v - bm[k].(float64)
+		}
+	}
+	return dm
+}
+
+// ratioMap returns the ratios of the latency values of head to base.
+func (d *resultDiff) ratioMap() map[string]any {
+	ratio := func(b, h float64) float64 {
+		if b == 0 {
+			if h == 0 {
+				return 1
+			}
+			return math.Inf(1)
+		}
+		return h / b
+	}
+	return map[string]any{
+		"max": ratio(d.base.max, d.head.max),
+		"mid": ratio(d.base.med, d.head.med),
+		"min": ratio(d.base.min, d.head.min),
+		"p90": ratio(d.base.p90, d.head.p90),
+		"p95": ratio(d.base.p95, d.head.p95),
+		"p99": ratio(d.base.p99, d.head.p99),
+		"avg": ratio(d.base.avg, d.head.avg),
+	}
+}
+
+func resultIDs(rs []*runResultSimplified) []string {
+	ids := []string{}
+	for _, r := range rs {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func toResultDiffEntries(rs []*runResultSimplified) []*resultDiffEntry {
+	var es []*resultDiffEntry
+	for _, r := range rs {
+		es = append(es, &resultDiffEntry{ID: r.ID, Desc: r.Desc, Path: r.Path})
+	}
+	return es
+}
+
+func (d *resultDiff) Report(w io.Writer) error {
+	tmpl, err := template.New("diff").Parse(diffReportTemplate)
+	if err != nil {
+		return err
+	}
+	entry := func(r *runResultSimplified) string {
+		return fmt.Sprintf("%s  %s  %s", r.ID[:min(len(r.ID), 7)], r.Desc, r.Path)
+	}
+	entries := func(rs []*runResultSimplified) []string {
+		var s []string
+		for _, r := range rs {
+			s = append(s, entry(r))
+		}
+		return s
+	}
+	ms := func(b, h float64) string {
+		return fmt.Sprintf("%sms -> %sms (%s)", humanize.CommafWithDigits(b, 1), humanize.CommafWithDigits(h, 1), signed(h-b, "ms"))
+	}
+	data := map[string]any{
+		"Base":         d.base.toMap(),
+		"Head":         d.head.toMap(),
+		"ErrorRate":    fmt.Sprintf("%s%% -> %s%% (%s)", humanize.CommafWithDigits(d.base.errorRate, 1), humanize.CommafWithDigits(d.head.errorRate, 1), signed(d.head.errorRate-d.base.errorRate, "%")),
+		"Max":          ms(d.base.max, d.head.max),
+		"Min":          ms(d.base.min, d.head.min),
+		"Avg":          ms(d.base.avg, d.head.avg),
+		"Med":          ms(d.base.med, d.head.med),
+		"P90":          ms(d.base.p90, d.head.p90),
+		"P95":          ms(d.base.p95, d.head.p95),
+		"P99":          ms(d.base.p99, d.head.p99),
+		"ShowRunbooks": d.base.kind == resultKindRunN,
+		"NewlyFailing": entries(d.newlyFailing),
+		"NewlyPassing": entries(d.newlyPassing),
+		"Added":        entries(d.newlyAdded),
+		"Removed":      entries(d.newlyRemoved),
+	}
+	if d.base.kind == resultKindLoadt {
+		data["RPS"] = fmt.Sprintf("%s -> %s (%s)", humanize.CommafWithDigits(d.base.rps, 1), humanize.CommafWithDigits(d.head.rps, 1), signed(d.head.rps-d.base.rps, ""))
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func signed(v float64, unit string) string {
+	if v >= 0 {
+		return fmt.Sprintf("+%s%s", humanize.CommafWithDigits(v, 1), unit)
+	}
+	return fmt.Sprintf("%s%s", humanize.CommafWithDigits(v, 1), unit)
+}
+
+// ReportJSON writes the comparison result as JSON.
+func (d *resultDiff) ReportJSON(w io.Writer) error {
+	j := resultDiffJSON{
+		Kind:         string(d.base.kind),
+		Base:         d.base.toMap(),
+		Head:         d.head.toMap(),
+		Diff:         d.deltaMap(),
+		NewlyFailing: toResultDiffEntries(d.newlyFailing),
+		NewlyPassing: toResultDiffEntries(d.newlyPassing),
+		Added:        toResultDiffEntries(d.newlyAdded),
+		Removed:      toResultDiffEntries(d.newlyRemoved),
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, string(b)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckTolerance evaluates the tolerance condition against the comparison result.
+func (d *resultDiff) CheckTolerance(tolerance string) error {
+	if tolerance == "" {
+		return nil
+	}
+	store := map[string]any{
+		"base":          d.base.toMap(),
+		"head":          d.head.toMap(),
+		"diff":          d.deltaMap(),
+		"ratio":         d.ratioMap(),
+		"newly_failing": resultIDs(d.newlyFailing),
+		"newly_passing": resultIDs(d.newlyPassing),
+		"added":         resultIDs(d.newlyAdded),
+		"removed":       resultIDs(d.newlyRemoved),
+	}
+	tf, err := expr.EvalWithTrace(tolerance, store)
+	if err != nil {
+		return err
+	}
+	if !tf.OutputAsBool() {
+		bt, err := tf.FormatTraceTree()
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("(%s) is not true\n%s", tolerance, bt)
+	}
+	return nil
+}
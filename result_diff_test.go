@@ -0,0 +1,152 @@
+package runn
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResultDiffLoadt(t *testing.T) {
+	base := loadtResultJSON{Total: 100, Succeeded: 100, RPS: 10, LatencyP90Ms: 100, LatencyP99Ms: 200}
+	head := loadtResultJSON{Total: 100, Succeeded: 95, Failed: 5, ErrorRate: 5, RPS: 9, LatencyP90Ms: 120, LatencyP99Ms: 300}
+	d, err := NewResultDiff(mustMarshal(t, base), mustMarshal(t, head))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tolerance string
+		wantErr   bool
+	}{
+		{"", false},
+		{"diff.p90 <= 20", false},
+		{"diff.p99 <= 20", true},
+		{"ratio.p99 < 1.6", false},
+		{"head.error_rate < 1", true},
+		{"diff.failed == 5 && base.rps == 10", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tolerance, func(t *testing.T) {
+			err := d.CheckTolerance(tt.tolerance)
+			if err != nil {
+				if tt.wantErr {
+					return
+				}
+				t.Errorf("got err: %s", err)
+			}
+			if tt.wantErr {
+				t.Error("want error")
+			}
+		})
+	}
+}
+
+func TestResultDiffRunN(t *testing.T) {
+	base := runNResultSimplified{
+		Total:   3,
+		Success: 2,
+		Failure: 1,
+		Results: []*runResultSimplified{
+			{ID: "a", Path: "a.yml", Result: resultSuccess, Elapsed: 100 * time.Millisecond},
+			{ID: "b", Path: "b.yml", Result: resultFailure, Elapsed: 200 * time.Millisecond},
+			{ID: "c", Path: "c.yml", Result: resultSuccess, Elapsed: 300 * time.Millisecond},
+		},
+	}
+	head := runNResultSimplified{
+		Total:   3,
+		Success: 2,
+		Failure: 1,
+		Results: []*runResultSimplified{
+			{ID: "a", Path: "a.yml", Result: resultFailure, Elapsed: 100 * time.Millisecond},
+			{ID: "b", Path: "b.yml", Result: resultSuccess, Elapsed: 200 * time.Millisecond},
+			{ID: "d", Path: "d.yml", Result: resultSuccess, Elapsed: 600 * time.Millisecond},
+		},
+	}
+	d, err := NewResultDiff(mustMarshal(t, base), mustMarshal(t, head))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"a"}, resultIDs(d.newlyFailing)); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"b"}, resultIDs(d.newlyPassing)); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"d"}, resultIDs(d.newlyAdded)); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"c"}, resultIDs(d.newlyRemoved)); diff != "" {
+		t.Error(diff)
+	}
+	if got := d.head.max; got != 600 {
+		t.Errorf("got %v want %v", got, 600)
+	}
+	if err := d.CheckTolerance("len(newly_failing) == 0"); err == nil {
+		t.Error("want error")
+	}
+	if err := d.CheckTolerance(`"b" in newly_passing && diff.max == 300`); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err := d.Report(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Newly failing runbooks.........: 1") {
+		t.Errorf("Report output should contain newly failing runbooks: %s", buf.String())
+	}
+}
+
+func TestResultDiffRunNRepeatedRunbooks(t *testing.T) {
+	base := runNResultSimplified{
+		Total:   2,
+		Success: 2,
+		Results: []*runResultSimplified{
+			{ID: "a", Path: "a.yml", Result: resultSuccess},
+			{ID: "a", Path: "a.yml", Result: resultSuccess},
+		},
+	}
+	head := runNResultSimplified{
+		Total:   3,
+		Success: 2,
+		Failure: 1,
+		Results: []*runResultSimplified{
+			{ID: "a", Path: "a.yml", Result: resultSuccess},
+			{ID: "a", Path: "a.yml", Result: resultFailure},
+			{ID: "a", Path: "a.yml", Result: resultSuccess},
+		},
+	}
+	d, err := NewResultDiff(mustMarshal(t, base), mustMarshal(t, head))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"a"}, resultIDs(d.newlyFailing)); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{"a"}, resultIDs(d.newlyAdded)); diff != "" {
+		t.Error(diff)
+	}
+	if diff := cmp.Diff([]string{}, resultIDs(d.newlyRemoved)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestResultDiffDifferentKinds(t *testing.T) {
+	base := loadtResultJSON{Total: 1, RPS: 1}
+	head := runNResultSimplified{Total: 1, Results: []*runResultSimplified{}}
+	if _, err := NewResultDiff(mustMarshal(t, base), mustMarshal(t, head)); err == nil {
+		t.Error("want error")
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
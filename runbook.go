@@ -54,6 +54,7 @@ type runbook struct {
 	Concurrency any               `yaml:"concurrency,omitempty"`
 	Force       bool              `yaml:"force,omitempty"`
 	Trace       bool              `yaml:"trace,omitempty"`
+	Schedule    string            `yaml:"schedule,omitempty"`
 
 	useMap   bool
 	stepKeys []string
@@ -79,6 +80,7 @@ type runbookMapped struct {
 	Concurrency any               `yaml:"concurrency,omitempty"`
 	Force       bool              `yaml:"force,omitempty"`
 	Trace       bool              `yaml:"trace,omitempty"`
+	Schedule    string            `yaml:"schedule,omitempty"`
 }
 
 var decOpts = []yaml.DecodeOption{
@@ -160,6 +162,7 @@ func parseRunbookAsMapped(b []byte, rb *runbook) error {
 	rb.Concurrency = m.Concurrency
 	rb.Force = m.Force
 	rb.Trace = m.Trace
+	rb.Schedule = m.Schedule
 
 	keys := map[string]struct{}{}
 	for _, s := range m.Steps {
@@ -224,6 +227,7 @@ func (rb *runbook) MarshalYAML() (any, error) {
 			Concurrency: rb.Concurrency,
 			Force:       rb.Force,
 			Trace:       rb.Trace,
+			Schedule:    rb.Schedule,
 
 			useMap:   rb.useMap,
 			stepKeys: rb.stepKeys,
@@ -248,6 +252,7 @@ func (rb *runbook) MarshalYAML() (any, error) {
 	m.Concurrency = rb.Concurrency
 	m.Force = rb.Force
 	m.Trace = rb.Trace
+	m.Schedule = rb.Schedule
 	ms := yaml.MapSlice{}
 	for i, k := range rb.stepKeys {
 		ms = append(ms, yaml.MapItem{
@@ -482,6 +487,7 @@ func (rb *runbook) toBook() (*book, error) {
 	bk.skipTest = rb.SkipTest
 	bk.force = rb.Force
 	bk.trace = rb.Trace
+	bk.schedule = rb.Schedule
 	if rb.Loop != nil {
 		bk.loop, err = newLoop(rb.Loop)
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/k1LoW/runn/internal/deprecation"
@@ -27,13 +28,27 @@ type httpRunnerConfig struct {
 	Timeout                    string `yaml:"timeout,omitempty"`
 	UseCookie                  *bool  `yaml:"useCookie,omitempty"`
 	Trace                      traceConfig
+	Auth                       *AuthConfig `yaml:"auth,omitempty"`
+	Sign                       *SignConfig `yaml:"sign,omitempty"`
+	Proxy                      string      `yaml:"proxy,omitempty"`
+	Socket                     string      `yaml:"socket,omitempty"`
+	Protocol                   string      `yaml:"protocol,omitempty"`
+	CookieJar                  string      `yaml:"cookieJar,omitempty"`
 
 	openAPI3Doc libopenapi.Document
+	codecs      map[string]HTTPBodyCodec
 }
 
 type traceConfig struct {
 	Enable     *bool  `yaml:"enable"`
 	HeaderName string `yaml:"headerName,omitempty"`
+	Format     string `yaml:"format,omitempty"`
+}
+
+type grpcKeepaliveConfig struct {
+	Time                string `yaml:"time,omitempty"`
+	Timeout             string `yaml:"timeout,omitempty"`
+	PermitWithoutStream bool   `yaml:"permitWithoutStream,omitempty"`
 }
 
 type grpcRunnerConfig struct {
@@ -45,11 +60,26 @@ type grpcRunnerConfig struct {
 	SkipVerify  bool     `yaml:"skipVerify,omitempty"`
 	ImportPaths []string `yaml:"importPaths,omitempty"`
 	Protos      []string `yaml:"protos,omitempty"`
+	Protosets   []string `yaml:"protosets,omitempty"`
 	BufDirs     []string `yaml:"bufDirs,omitempty"`
 	BufLocks    []string `yaml:"bufLocks,omitempty"`
 	BufConfigs  []string `yaml:"bufConfigs,omitempty"`
 	BufModules  []string `yaml:"bufModules,omitempty"`
 	Trace       traceConfig
+	Auth        *AuthConfig `yaml:"auth,omitempty"`
+	Proxy       string      `yaml:"proxy,omitempty"`
+	Socket      string      `yaml:"socket,omitempty"`
+	Protocol    string      `yaml:"protocol,omitempty"`
+	Codec       string      `yaml:"codec,omitempty"`
+	// StoreRequest - Store the request messages with default values as `req`
+	StoreRequest bool `yaml:"storeRequest,omitempty"`
+	// Options of the gRPC client
+	Compression    string               `yaml:"compression,omitempty"`
+	Keepalive      *grpcKeepaliveConfig `yaml:"keepalive,omitempty"`
+	MaxSendMsgSize any                  `yaml:"maxSendMsgSize,omitempty"`
+	MaxRecvMsgSize any                  `yaml:"maxRecvMsgSize,omitempty"`
+	Authority      string               `yaml:"authority,omitempty"`
+	ServiceConfig  any                  `yaml:"serviceConfig,omitempty"`
 
 	cacert []byte
 	cert   []byte
@@ -59,6 +89,10 @@ type grpcRunnerConfig struct {
 type dbRunnerConfig struct {
 	DSN   string `yaml:"dsn"`
 	Trace *bool  `yaml:"trace,omitempty"`
+	// Transaction - true or the options of the transaction (`isolationLevel:` and `readOnly:`)
+	Transaction any `yaml:"transaction,omitempty"`
+	// Snapshot - true (all tables) or the list of tables to be restored at the end of the runbook
+	Snapshot any `yaml:"snapshot,omitempty"`
 }
 
 type sshRunnerConfig struct {
@@ -254,6 +288,89 @@ func HTTPTrace(trace bool) httpRunnerOption {
 	}
 }
 
+// HTTPCodec sets the codec to encode request bodies and decode response bodies of the media type.
+// It takes precedence over the built-in codecs.
+func HTTPCodec(mediaType string, codec HTTPBodyCodec) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		if c.codecs == nil {
+			c.codecs = map[string]HTTPBodyCodec{}
+		}
+		c.codecs[strings.ToLower(mediaType)] = codec
+		return nil
+	}
+}
+
+// HTTPAuth sets the authentication of requests.
+func HTTPAuth(a *AuthConfig) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		if err := a.validate(); err != nil {
+			return err
+		}
+		c.Auth = a
+		return nil
+	}
+}
+
+// HTTPSign sets the signing of requests.
+func HTTPSign(sign *SignConfig) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		if err := sign.validate(); err != nil {
+			return err
+		}
+		c.Sign = sign
+		return nil
+	}
+}
+
+// HTTPProxy sets the proxy (http://, https://, socks5:// or socks5h://) of requests.
+func HTTPProxy(proxy string) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		if _, err := parseProxyURL(proxy); err != nil {
+			return err
+		}
+		c.Proxy = proxy
+		return nil
+	}
+}
+
+// HTTPSocket sets the path of the Unix domain socket to connect to instead of the endpoint.
+func HTTPSocket(socket string) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		c.Socket = socket
+		return nil
+	}
+}
+
+// HTTPProtocol sets the protocol of requests ("http1", "h2", "h2c" or "h3").
+func HTTPProtocol(protocol string) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		if err := validateHTTPProtocol(protocol); err != nil {
+			return err
+		}
+		c.Protocol = protocol
+		return nil
+	}
+}
+
+// HTTPCookieJar sets the path of the cookie jar file to load and save cookies (Netscape cookies.txt or JSON if the extension is .json).
+func HTTPCookieJar(path string) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		c.CookieJar = path
+		return nil
+	}
+}
+
+// HTTPTraceFormat sets the format of the trace header ("runn", "w3c", "b3" or "b3multi").
+func HTTPTraceFormat(format string) httpRunnerOption {
+	return func(c *httpRunnerConfig) error {
+		if err := validateTraceFormat(format); err != nil {
+			return err
+		}
+		c.Trace.Format = format
+		return nil
+	}
+}
+
 func TLS(useTLS bool) grpcRunnerOption {
 	return func(c *grpcRunnerConfig) error {
 		c.TLS = &useTLS
@@ -311,6 +428,14 @@ func Protos(protos []string) grpcRunnerOption {
 	}
 }
 
+// Protosets append descriptor sets (protoset).
+func Protosets(protosets []string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.Protosets = sliceutil.Unique(append(c.Protosets, protosets...))
+		return nil
+	}
+}
+
 // ImportPaths set import paths.
 func ImportPaths(paths []string) grpcRunnerOption {
 	return func(c *grpcRunnerConfig) error {
@@ -326,6 +451,131 @@ func GRPCTrace(trace bool) grpcRunnerOption {
 	}
 }
 
+// GRPCTraceFormat sets the format of the trace metadata ("runn", "w3c", "b3" or "b3multi").
+func GRPCTraceFormat(format string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		if err := validateTraceFormat(format); err != nil {
+			return err
+		}
+		c.Trace.Format = format
+		return nil
+	}
+}
+
+// GRPCAuth sets the authentication of requests.
+// The credentials are sent as the `authorization` metadata. Digest authentication is not supported.
+func GRPCAuth(a *AuthConfig) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		if err := validateGRPCAuth(a); err != nil {
+			return err
+		}
+		c.Auth = a
+		return nil
+	}
+}
+
+// GRPCProxy sets the proxy (http://, https://, socks5:// or socks5h://) of connections.
+func GRPCProxy(proxy string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		if _, err := parseProxyURL(proxy); err != nil {
+			return err
+		}
+		c.Proxy = proxy
+		return nil
+	}
+}
+
+// GRPCSocket sets the path of the Unix domain socket to connect to instead of the address.
+func GRPCSocket(socket string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.Socket = socket
+		return nil
+	}
+}
+
+// GRPCProtocol sets the protocol of RPCs ("grpc", "grpcweb" or "connect").
+func GRPCProtocol(protocol string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		if err := validateGRPCProtocol(protocol, c.Codec); err != nil {
+			return err
+		}
+		c.Protocol = protocol
+		return nil
+	}
+}
+
+// GRPCCodec sets the codec of messages of the gRPC-Web or Connect protocol ("proto" or "json").
+func GRPCCodec(codec string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.Codec = codec
+		return nil
+	}
+}
+
+// GRPCCompression sets the compressor of messages ("gzip").
+func GRPCCompression(name string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.Compression = name
+		return nil
+	}
+}
+
+// GRPCKeepalive sets the keepalive parameters of connections.
+func GRPCKeepalive(t, timeout time.Duration, permitWithoutStream bool) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.Keepalive = &grpcKeepaliveConfig{
+			PermitWithoutStream: permitWithoutStream,
+		}
+		if t > 0 {
+			c.Keepalive.Time = t.String()
+		}
+		if timeout > 0 {
+			c.Keepalive.Timeout = timeout.String()
+		}
+		return nil
+	}
+}
+
+// GRPCMaxSendMsgSize sets the maximum size of messages to send in bytes.
+func GRPCMaxSendMsgSize(size int) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.MaxSendMsgSize = size
+		return nil
+	}
+}
+
+// GRPCMaxRecvMsgSize sets the maximum size of messages to receive in bytes.
+func GRPCMaxRecvMsgSize(size int) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.MaxRecvMsgSize = size
+		return nil
+	}
+}
+
+// GRPCAuthority sets the authority (:authority pseudo-header) of requests.
+func GRPCAuthority(authority string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.Authority = authority
+		return nil
+	}
+}
+
+// GRPCServiceConfig sets the service config in JSON (e.g. retry policy and load balancing).
+func GRPCServiceConfig(serviceConfig string) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.ServiceConfig = serviceConfig
+		return nil
+	}
+}
+
+// GRPCStoreRequest stores the request messages sent with proto default values as `req.message` and `req.messages`.
+func GRPCStoreRequest(enable bool) grpcRunnerOption {
+	return func(c *grpcRunnerConfig) error {
+		c.StoreRequest = enable
+		return nil
+	}
+}
+
 func BufDir(dirs ...string) grpcRunnerOption {
 	return func(c *grpcRunnerConfig) error {
 		c.BufDirs = sliceutil.Unique(append(c.BufDirs, dirs...))
@@ -361,6 +611,35 @@ func DBTrace(trace bool) dbRunnerOption {
 	}
 }
 
+// DBTransaction - Run all steps of the runner in one transaction that is rolled back at the end of the runbook.
+// isolationLevel is the name of the isolation level (e.g. "read committed", "serializable"). Empty means the default of the driver.
+func DBTransaction(isolationLevel string, readOnly bool) dbRunnerOption {
+	return func(c *dbRunnerConfig) error {
+		if _, err := parseIsolationLevel(isolationLevel); err != nil {
+			return err
+		}
+		c.Transaction = &dbTxConfig{IsolationLevel: isolationLevel, ReadOnly: readOnly}
+		return nil
+	}
+}
+
+// DBSnapshot - Take the snapshot of the tables before the first step of the runner and restore it at the end of the runbook.
+// If no tables are specified, all tables are captured.
+func DBSnapshot(tables ...string) dbRunnerOption {
+	return func(c *dbRunnerConfig) error {
+		if len(tables) == 0 {
+			c.Snapshot = true
+			return nil
+		}
+		l := make([]any, 0, len(tables))
+		for _, t := range tables {
+			l = append(l, t)
+		}
+		c.Snapshot = l
+		return nil
+	}
+}
+
 func SSHConfig(p string) sshRunnerOption {
 	return func(c *sshRunnerConfig) error {
 		c.SSHConfig = p
@@ -454,8 +733,12 @@ func (t *traceConfig) UnmarshalYAML(b []byte) error {
 		return err
 	}
 
+	if err := validateTraceFormat(s.Format); err != nil {
+		return err
+	}
 	t.Enable = s.Enable
 	t.HeaderName = s.HeaderName
+	t.Format = s.Format
 
 	return nil
 }
@@ -0,0 +1,610 @@
+package runn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/k1LoW/maskedio"
+)
+
+const (
+	signTypeSigV4   = "sigv4"
+	signTypeHMAC    = "hmac"
+	signTypeRFC9421 = "rfc9421"
+)
+
+const (
+	defaultHMACSignHeader      = "X-Signature"
+	defaultHMACTimestampHeader = "X-Timestamp"
+	defaultRFC9421Label        = "sig1"
+)
+
+const (
+	hmacPartMethod     = "method"
+	hmacPartPath       = "path"
+	hmacPartQuery      = "query"
+	hmacPartURI        = "uri"
+	hmacPartHost       = "host"
+	hmacPartBody       = "body"
+	hmacPartBodySHA256 = "bodySHA256"
+	hmacPartTimestamp  = "timestamp"
+	hmacPartHeader     = "header:"
+)
+
+var defaultHMACParts = []string{hmacPartMethod, hmacPartURI, hmacPartTimestamp, hmacPartBodySHA256}
+
+// SignConfig is the configuration for signing HTTP requests.
+type SignConfig struct {
+	// Type is the type of the signature ("sigv4", "hmac" or "rfc9421").
+	Type string `yaml:"type"`
+
+	// AccessKeyID is the access key ID of AWS Signature Version 4.
+	AccessKeyID string `yaml:"accessKeyID,omitempty"`
+	// SecretAccessKey is the secret access key of AWS Signature Version 4.
+	SecretAccessKey string `yaml:"secretAccessKey,omitempty"`
+	// SessionToken is the session token of AWS Signature Version 4.
+	SessionToken string `yaml:"sessionToken,omitempty"`
+	Region       string `yaml:"region,omitempty"`
+	Service      string `yaml:"service,omitempty"`
+
+	// Key is the secret of HMAC or the key of HTTP Message Signatures (the secret of hmac-sha256 or the PEM encoded private key).
+	Key string `yaml:"key,omitempty"`
+	// KeyID is the key ID of HTTP Message Signatures.
+	KeyID string `yaml:"keyID,omitempty"`
+	// Algorithm is the algorithm of HMAC ("sha256", "sha512" or "sha1") or HTTP Message Signatures ("hmac-sha256", "ed25519", "ecdsa-p256-sha256", "rsa-pss-sha512" or "rsa-v1_5-sha256").
+	Algorithm string `yaml:"algorithm,omitempty"`
+
+	// Header is the header to set the signature of HMAC.
+	Header string `yaml:"header,omitempty"`
+	// Prefix is the prefix of the header value of HMAC (e.g. "HMAC ").
+	Prefix string `yaml:"prefix,omitempty"`
+	// Parts is the parts of the request to sign with HMAC.
+	Parts []string `yaml:"parts,omitempty"`
+	// Separator is the separator of the parts of HMAC.
+	Separator *string `yaml:"separator,omitempty"`
+	// Encoding is the encoding of the signature of HMAC ("hex" or "base64").
+	Encoding string `yaml:"encoding,omitempty"`
+	// TimestampHeader is the header to set the timestamp (Unix time) signed with HMAC.
+	TimestampHeader string `yaml:"timestampHeader,omitempty"`
+
+	// Components is the components to sign with HTTP Message Signatures.
+	Components []string `yaml:"components,omitempty"`
+	// Label is the label of the signature of HTTP Message Signatures.
+	Label string `yaml:"label,omitempty"`
+}
+
+func newSignConfig(v any) (*SignConfig, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	c := &SignConfig{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("invalid sign: %w", err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *SignConfig) validate() error {
+	switch c.Type {
+	case signTypeSigV4:
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return errors.New("sign: accessKeyID and secretAccessKey are required for sigv4")
+		}
+		if c.Region == "" || c.Service == "" {
+			return errors.New("sign: region and service are required for sigv4")
+		}
+	case signTypeHMAC:
+		if c.Key == "" {
+			return errors.New("sign: key is required for hmac")
+		}
+		if _, err := hmacHash(c.Algorithm); err != nil {
+			return err
+		}
+		switch c.Encoding {
+		case "", "hex", "base64":
+		default:
+			return fmt.Errorf("sign: invalid encoding: %q (should be \"hex\" or \"base64\")", c.Encoding)
+		}
+		for _, p := range c.Parts {
+			switch p {
+			case hmacPartMethod, hmacPartPath, hmacPartQuery, hmacPartURI, hmacPartHost, hmacPartBody, hmacPartBodySHA256, hmacPartTimestamp:
+			default:
+				if !strings.HasPrefix(p, hmacPartHeader) {
+					return fmt.Errorf("sign: invalid part: %q", p)
+				}
+			}
+		}
+	case signTypeRFC9421:
+		if c.Key == "" {
+			return errors.New("sign: key is required for rfc9421")
+		}
+		switch c.Algorithm {
+		case "hmac-sha256", "ed25519", "ecdsa-p256-sha256", "rsa-pss-sha512", "rsa-v1_5-sha256":
+		default:
+			return fmt.Errorf("sign: invalid algorithm of rfc9421: %q", c.Algorithm)
+		}
+	default:
+		return fmt.Errorf("sign: invalid type: %q (should be %q, %q or %q)", c.Type, signTypeSigV4, signTypeHMAC, signTypeRFC9421)
+	}
+	return nil
+}
+
+// expand expands the values of the config (e.g. `{{ vars.key }}`) with the store of the step.
+func (c *SignConfig) expand(s *step) (*SignConfig, error) {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	e, err := s.parent.expandBeforeRecord(m, s)
+	if err != nil {
+		return nil, err
+	}
+	return newSignConfig(e)
+}
+
+// sign signs the request with the config.
+func (c *SignConfig) sign(req *http.Request, now time.Time, mr *maskedio.Rule) error {
+	if mr != nil {
+		for _, s := range []string{c.SecretAccessKey, c.SessionToken, c.Key} {
+			if s != "" {
+				mr.SetKeyword(s)
+			}
+		}
+	}
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	switch c.Type {
+	case signTypeSigV4:
+		return c.signSigV4(req, body, now)
+	case signTypeHMAC:
+		return c.signHMAC(req, body, now)
+	case signTypeRFC9421:
+		return c.signRFC9421(req, body, now)
+	default:
+		return fmt.Errorf("sign: invalid type: %q", c.Type)
+	}
+}
+
+// signBody is the request body to be signed.
+// The body streamed from files is not read into memory, so only its size and SHA-256 hash are available.
+type signBody struct {
+	b        []byte
+	sum      []byte
+	size     int64
+	streamed bool
+}
+
+// readRequestBody reads the body of the request and sets it again so that the request can be sent.
+// The body streamed from files is hashed while reading the files again through GetBody.
+func readRequestBody(req *http.Request) (*signBody, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		sum := sha256.Sum256(nil)
+		return &signBody{sum: sum[:]}, nil
+	}
+	if _, ok := req.Body.(*sizedBody); ok && req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		h := sha256.New()
+		size, err := io.Copy(h, rc)
+		if err != nil {
+			return nil, err
+		}
+		return &signBody{sum: h.Sum(nil), size: size, streamed: true}, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	req.ContentLength = int64(len(b))
+	sum := sha256.Sum256(b)
+	return &signBody{b: b, sum: sum[:], size: int64(len(b))}, nil
+}
+
+// signSigV4 signs the request with AWS Signature Version 4.
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func (c *SignConfig) signSigV4(req *http.Request, body *signBody, now time.Time) error {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := hex.EncodeToString(body.sum)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	if c.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	// Canonical headers
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "authorization" || lk == "user-agent" || lk == "content-length" {
+			continue
+		}
+		vv := make([]string, len(v))
+		for i, s := range v {
+			vv[i] = strings.Join(strings.Fields(s), " ")
+		}
+		headers[lk] = strings.Join(vv, ",")
+	}
+	var names []string
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var ch strings.Builder
+	for _, k := range names {
+		ch.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if c.Service != "s3" {
+		// Each path segment is URI-encoded twice except for Amazon S3.
+		segs := strings.Split(path, "/")
+		for i, seg := range segs {
+			segs[i] = sigV4Escape(seg)
+		}
+		path = strings.Join(segs, "/")
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		sigV4CanonicalQuery(req.URL.Query()),
+		ch.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, c.Region, c.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+	k := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), date)
+	k = hmacSHA256(k, c.Region)
+	k = hmacSHA256(k, c.Service)
+	k = hmacSHA256(k, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(k, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func sigV4CanonicalQuery(q url.Values) string {
+	var keys []string
+	for k := range q {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var kv []string
+	for _, k := range keys {
+		vs := slices.Clone(q[k])
+		slices.Sort(vs)
+		for _, v := range vs {
+			kv = append(kv, sigV4Escape(k)+"="+sigV4Escape(v))
+		}
+	}
+	return strings.Join(kv, "&")
+}
+
+// sigV4Escape escapes the string except for the unreserved characters (RFC 3986).
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// signHMAC signs the parts of the request with HMAC and sets the signature to the header.
+func (c *SignConfig) signHMAC(req *http.Request, body *signBody, now time.Time) error {
+	h, err := hmacHash(c.Algorithm)
+	if err != nil {
+		return err
+	}
+	parts := c.Parts
+	if len(parts) == 0 {
+		parts = defaultHMACParts
+	}
+	tsHeader := c.TimestampHeader
+	if tsHeader == "" && slices.Contains(parts, hmacPartTimestamp) {
+		tsHeader = defaultHMACTimestampHeader
+	}
+	if tsHeader != "" && req.Header.Get(tsHeader) == "" {
+		req.Header.Set(tsHeader, strconv.FormatInt(now.Unix(), 10))
+	}
+	values := make([]string, 0, len(parts))
+	for _, p := range parts {
+		switch p {
+		case hmacPartMethod:
+			values = append(values, req.Method)
+		case hmacPartPath:
+			values = append(values, req.URL.EscapedPath())
+		case hmacPartQuery:
+			values = append(values, req.URL.RawQuery)
+		case hmacPartURI:
+			values = append(values, req.URL.RequestURI())
+		case hmacPartHost:
+			if req.Host != "" {
+				values = append(values, req.Host)
+			} else {
+				values = append(values, req.URL.Host)
+			}
+		case hmacPartBody:
+			if body.streamed {
+				return fmt.Errorf("sign: the body streamed from files cannot be signed as %q part (use %q instead)", hmacPartBody, hmacPartBodySHA256)
+			}
+			values = append(values, string(body.b))
+		case hmacPartBodySHA256:
+			values = append(values, hex.EncodeToString(body.sum))
+		case hmacPartTimestamp:
+			values = append(values, req.Header.Get(tsHeader))
+		default:
+			values = append(values, req.Header.Get(strings.TrimPrefix(p, hmacPartHeader)))
+		}
+	}
+	sep := "\n"
+	if c.Separator != nil {
+		sep = *c.Separator
+	}
+	mac := hmac.New(h, []byte(c.Key))
+	_, _ = mac.Write([]byte(strings.Join(values, sep)))
+	sum := mac.Sum(nil)
+	var signature string
+	if c.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(sum)
+	} else {
+		signature = hex.EncodeToString(sum)
+	}
+	header := c.Header
+	if header == "" {
+		header = defaultHMACSignHeader
+	}
+	req.Header.Set(header, c.Prefix+signature)
+	return nil
+}
+
+// signRFC9421 signs the request with HTTP Message Signatures.
+// https://www.rfc-editor.org/rfc/rfc9421
+func (c *SignConfig) signRFC9421(req *http.Request, body *signBody, now time.Time) error {
+	components := c.Components
+	if len(components) == 0 {
+		components = []string{"@method", "@target-uri"}
+		if body.size > 0 {
+			components = append(components, "content-digest")
+			if req.Header.Get("Content-Type") != "" {
+				components = append(components, "content-type")
+			}
+		}
+	}
+	if slices.Contains(components, "content-digest") && req.Header.Get("Content-Digest") == "" {
+		// https://www.rfc-editor.org/rfc/rfc9530
+		req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(body.sum)+":")
+	}
+	quoted := make([]string, len(components))
+	for i, comp := range components {
+		quoted[i] = strconv.Quote(strings.ToLower(comp))
+	}
+	params := fmt.Sprintf("(%s);created=%d", strings.Join(quoted, " "), now.Unix())
+	if c.KeyID != "" {
+		params += ";keyid=" + strconv.Quote(c.KeyID)
+	}
+	params += ";alg=" + strconv.Quote(c.Algorithm)
+	base, err := rfc9421SignatureBase(req, components, params)
+	if err != nil {
+		return err
+	}
+	sig, err := rfc9421Sign(c.Algorithm, c.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+	label := c.Label
+	if label == "" {
+		label = defaultRFC9421Label
+	}
+	req.Header.Set("Signature-Input", label+"="+params)
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// rfc9421SignatureBase returns the signature base of the request.
+func rfc9421SignatureBase(req *http.Request, components []string, params string) (string, error) {
+	var lines []string
+	for _, comp := range components {
+		comp = strings.ToLower(comp)
+		var v string
+		switch comp {
+		case "@method":
+			v = req.Method
+		case "@target-uri":
+			v = req.URL.String()
+		case "@authority":
+			v = req.Host
+			if v == "" {
+				v = req.URL.Host
+			}
+			v = strings.ToLower(v)
+		case "@scheme":
+			v = strings.ToLower(req.URL.Scheme)
+		case "@request-target":
+			v = req.URL.RequestURI()
+		case "@path":
+			v = req.URL.EscapedPath()
+			if v == "" {
+				v = "/"
+			}
+		case "@query":
+			v = "?" + req.URL.RawQuery
+		default:
+			if strings.HasPrefix(comp, "@") {
+				return "", fmt.Errorf("sign: unsupported component: %s", comp)
+			}
+			vs := req.Header.Values(comp)
+			if len(vs) == 0 {
+				return "", fmt.Errorf("sign: header not found: %s", comp)
+			}
+			for i, vv := range vs {
+				vs[i] = strings.TrimSpace(vv)
+			}
+			v = strings.Join(vs, ", ")
+		}
+		lines = append(lines, fmt.Sprintf("%q: %s", comp, v))
+	}
+	lines = append(lines, fmt.Sprintf("%q: %s", "@signature-params", params))
+	return strings.Join(lines, "\n"), nil
+}
+
+func rfc9421Sign(alg, key string, base []byte) ([]byte, error) {
+	if alg == "hmac-sha256" {
+		return hmacSHA256([]byte(key), string(base)), nil
+	}
+	pk, err := parsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	switch alg {
+	case "ed25519":
+		k, ok := pk.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("sign: ed25519 private key is required")
+		}
+		return ed25519.Sign(k, base), nil
+	case "ecdsa-p256-sha256":
+		k, ok := pk.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("sign: ECDSA private key is required")
+		}
+		sum := sha256.Sum256(base)
+		r, s, err := ecdsa.Sign(rand.Reader, k, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		// The signature is the concatenation of r and s.
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case "rsa-pss-sha512":
+		k, ok := pk.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("sign: RSA private key is required")
+		}
+		sum := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, k, crypto.SHA512, sum[:], &rsa.PSSOptions{SaltLength: 64})
+	case "rsa-v1_5-sha256":
+		k, ok := pk.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("sign: RSA private key is required")
+		}
+		sum := sha256.Sum256(base)
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	default:
+		return nil, fmt.Errorf("sign: invalid algorithm of rfc9421: %q", alg)
+	}
+}
+
+func parsePrivateKey(key string) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, errors.New("sign: failed to decode the PEM encoded private key")
+	}
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	return nil, errors.New("sign: unsupported private key")
+}
+
+func hmacHash(alg string) (func() hash.Hash, error) {
+	switch alg {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	case "sha1":
+		return sha1.New, nil
+	default:
+		return nil, fmt.Errorf("sign: invalid algorithm of hmac: %q (should be \"sha256\", \"sha512\" or \"sha1\")", alg)
+	}
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// signRequest signs the request with the sign setting of the step, or of the runner if the step does not have it.
+func (rnr *httpRunner) signRequest(req *http.Request, r *httpRequest, s *step) error {
+	c := r.sign
+	if c == nil {
+		if rnr.sign == nil {
+			return nil
+		}
+		var err error
+		c, err = rnr.sign.expand(s)
+		if err != nil {
+			return err
+		}
+	}
+	return c.sign(req, time.Now(), s.parent.maskRule)
+}
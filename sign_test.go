@@ -0,0 +1,294 @@
+package runn
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/k1LoW/httpstub"
+)
+
+func TestSignSigV4(t *testing.T) {
+	// https://github.com/awslabs/aws-c-auth/tree/main/tests/aws-signing-test-suite/v4
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	c := &SignConfig{
+		Type:            "sigv4",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         "service",
+	}
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			"get-vanilla",
+			"https://example.amazonaws.com/",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			"get-vanilla-query-order-key-case",
+			"https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.sign(req, now, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.want {
+				t.Errorf("got %s\nwant %s", got, tt.want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("got %s", got)
+			}
+		})
+	}
+}
+
+func TestSignHMAC(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	sep := "|"
+	c := &SignConfig{
+		Type:     "hmac",
+		Key:      "secret",
+		Header:   "X-Gateway-Signature",
+		Prefix:   "HMAC ",
+		Parts:    []string{"method", "path", "query", "timestamp", "header:X-Request-Id", "body"},
+		Encoding: "base64",
+
+		Separator: &sep,
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/users?page=1", strings.NewReader(`{"name":"alice"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-Id", "abc")
+	if err := c.sign(req, now, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Timestamp"); got != "1700000000" {
+		t.Errorf("got %s", got)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	_, _ = mac.Write([]byte(`POST|/users|page=1|1700000000|abc|{"name":"alice"}`))
+	want := "HMAC " + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if got := req.Header.Get("X-Gateway-Signature"); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// The body can be read after signing.
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"name":"alice"}` {
+		t.Errorf("got %s", string(b))
+	}
+}
+
+func TestSignStreamedBody(t *testing.T) {
+	dummy, err := os.ReadFile("testdata/dummy.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(dummy)
+	newReq := func(t *testing.T) *http.Request {
+		t.Helper()
+		body, err := openSizedBody([]*sizedBodyPart{{path: "testdata/dummy.png"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = body.Close()
+		})
+		req, err := http.NewRequest(http.MethodPut, "https://examplebucket.s3.amazonaws.com/dummy.png", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setSizedBody(req, body)
+		return req
+	}
+
+	t.Run("sigv4", func(t *testing.T) {
+		c := &SignConfig{
+			Type:            "sigv4",
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			Region:          "us-east-1",
+			Service:         "s3",
+		}
+		req := newReq(t)
+		if err := c.sign(req, time.Now(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := req.Header.Get("X-Amz-Content-Sha256"), hex.EncodeToString(sum[:]); got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+		// The body is not read into memory, and it is still streamed from the file.
+		if _, ok := req.Body.(*sizedBody); !ok {
+			t.Errorf("got %T", req.Body)
+		}
+		if req.ContentLength != int64(len(dummy)) {
+			t.Errorf("got %v want %v", req.ContentLength, len(dummy))
+		}
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, dummy) {
+			t.Error("body is changed")
+		}
+	})
+
+	t.Run("hmac bodySHA256", func(t *testing.T) {
+		c := &SignConfig{Type: "hmac", Key: "secret", Parts: []string{"bodySHA256"}}
+		req := newReq(t)
+		if err := c.sign(req, time.Now(), nil); err != nil {
+			t.Fatal(err)
+		}
+		mac := hmac.New(sha256.New, []byte("secret"))
+		_, _ = mac.Write([]byte(hex.EncodeToString(sum[:])))
+		if got, want := req.Header.Get("X-Signature"), hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	})
+
+	t.Run("hmac body", func(t *testing.T) {
+		c := &SignConfig{Type: "hmac", Key: "secret", Parts: []string{"body"}}
+		req := newReq(t)
+		if err := c.sign(req, time.Now(), nil); err == nil {
+			t.Error("want error")
+		}
+	})
+}
+
+func TestSignRFC9421(t *testing.T) {
+	now := time.Unix(1618884473, 0)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &SignConfig{
+		Type:      "rfc9421",
+		Key:       string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		KeyID:     "test-key-ed25519",
+		Algorithm: "ed25519",
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := c.sign(req, now, nil); err != nil {
+		t.Fatal(err)
+	}
+	wantInput := `sig1=("@method" "@target-uri" "content-digest" "content-type");created=1618884473;keyid="test-key-ed25519";alg="ed25519"`
+	if got := req.Header.Get("Signature-Input"); got != wantInput {
+		t.Errorf("got %s\nwant %s", got, wantInput)
+	}
+	// https://www.rfc-editor.org/rfc/rfc9530#appendix-B.1
+	wantDigest := "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"
+	if got := req.Header.Get("Content-Digest"); got != wantDigest {
+		t.Errorf("got %s, want %s", got, wantDigest)
+	}
+	base, err := rfc9421SignatureBase(req, []string{"@method", "@target-uri", "content-digest", "content-type"}, strings.TrimPrefix(wantInput, "sig1="))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBase := `"@method": POST
+"@target-uri": https://example.com/foo?param=Value&Pet=dog
+"content-digest": sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:
+"content-type": application/json
+"@signature-params": ("@method" "@target-uri" "content-digest" "content-type");created=1618884473;keyid="test-key-ed25519";alg="ed25519"`
+	if base != wantBase {
+		t.Errorf("got %s\nwant %s", base, wantBase)
+	}
+	sig := strings.TrimSuffix(strings.TrimPrefix(req.Header.Get("Signature"), "sig1=:"), ":")
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.Verify(pub, []byte(base), b) {
+		t.Error("invalid signature")
+	}
+}
+
+func TestHTTPSignRunbook(t *testing.T) {
+	ts := httpstub.NewServer(t)
+	t.Cleanup(func() {
+		ts.Close()
+	})
+	ts.Path("/hmac").Handler(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(b)
+		mac := hmac.New(sha256.New, []byte("hmac-secret"))
+		_, _ = mac.Write([]byte(strings.Join([]string{r.Method, r.URL.RequestURI(), r.Header.Get("X-Timestamp"), hex.EncodeToString(sum[:])}, "\n")))
+		if r.Header.Get("X-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts.Path("/rfc9421").Handler(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Signature-Input"), `sig1=("@method" "@path");created=`) || !strings.HasPrefix(r.Header.Get("Signature"), "sig1=:") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	t.Setenv("TEST_HTTP_ENDPOINT", ts.Server().URL)
+	o, err := New(Book("testdata/book/http_sign.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignConfigValidate(t *testing.T) {
+	tests := []struct {
+		c       *SignConfig
+		wantErr bool
+	}{
+		{&SignConfig{Type: "sigv4", AccessKeyID: "id", SecretAccessKey: "secret", Region: "us-east-1", Service: "execute-api"}, false},
+		{&SignConfig{Type: "sigv4", AccessKeyID: "id", SecretAccessKey: "secret"}, true},
+		{&SignConfig{Type: "hmac", Key: "secret"}, false},
+		{&SignConfig{Type: "hmac", Key: "secret", Algorithm: "md5"}, true},
+		{&SignConfig{Type: "hmac", Key: "secret", Parts: []string{"method", "header:Date"}}, false},
+		{&SignConfig{Type: "hmac", Key: "secret", Parts: []string{"fragment"}}, true},
+		{&SignConfig{Type: "rfc9421", Key: "secret", Algorithm: "hmac-sha256"}, false},
+		{&SignConfig{Type: "rfc9421", Key: "secret"}, true},
+		{&SignConfig{Type: "jws"}, true},
+	}
+	for _, tt := range tests {
+		err := tt.c.validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%#v: got %v, wantErr %v", tt.c, err, tt.wantErr)
+		}
+	}
+}
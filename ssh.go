@@ -45,6 +45,8 @@ type sshRunner struct {
 	hostRules    hostRules
 	// operatorID - The id of the operator for which the runner is defined.
 	operatorID string
+	// reusable - When true, the runner is shared across runs and should not be closed between them.
+	reusable bool
 }
 
 type sshLocalForward struct {
@@ -233,7 +235,7 @@ func (rnr *sshRunner) run(ctx context.Context, c *sshCommand, s *step) error {
 				return err
 			}
 		}
-		if rnr.addr != "" {
+		if rnr.addr != "" && !rnr.reusable {
 			if err := donegroup.Cleanup(ctx, func() error {
 				// In the case of Reused runners, leave the cleanup to the main cleanup
 				if o.id != rnr.operatorID {
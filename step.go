@@ -34,6 +34,8 @@ type step struct {
 	dumpRequest      *dumpRequest
 	bindRunner       *bindRunner
 	bindCond         map[string]any
+	dbAssertRunner   *dbAssertRunner
+	dbAssertCond     map[string]any
 	includeRunner    *includeRunner
 	includeConfig    *includeConfig
 	runnerRunner     *runnerRunner
@@ -95,6 +97,8 @@ func (s *step) runnerType() RunnerType {
 		return RunnerTypeDump
 	case s.bindRunner != nil && s.bindCond != nil:
 		return RunnerTypeBind
+	case s.dbAssertRunner != nil && s.dbAssertCond != nil:
+		return RunnerTypeDBAssert
 	case s.testRunner != nil && s.testCond != "":
 		return RunnerTypeTest
 	case s.runnerRunner != nil && s.runnerDefinition != nil:
@@ -1,7 +1,39 @@
 package runn
 
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
 const DefaultTraceHeaderName = "X-Runn-Trace"
 
+// Trace propagation formats.
+const (
+	traceFormatRunn    = "runn"
+	traceFormatW3C     = "w3c"
+	traceFormatB3      = "b3"
+	traceFormatB3Multi = "b3multi"
+)
+
+const (
+	w3cTraceparentHeaderName = "traceparent"
+	w3cTracestateHeaderName  = "tracestate"
+	w3cBaggageHeaderName     = "baggage"
+	b3HeaderName             = "b3"
+	b3TraceIDHeaderName      = "X-B3-TraceId"
+	b3SpanIDHeaderName       = "X-B3-SpanId"
+	b3ParentSpanIDHeaderName = "X-B3-ParentSpanId"
+	b3SampledHeaderName      = "X-B3-Sampled"
+)
+
 type trace struct {
 	RunID string `json:"id"`
 }
@@ -11,3 +43,138 @@ func newTrace(s *step) trace {
 		RunID: s.runbookID(),
 	}
 }
+
+func validateTraceFormat(format string) error {
+	switch format {
+	case "", traceFormatRunn, traceFormatW3C, traceFormatB3, traceFormatB3Multi:
+		return nil
+	default:
+		return fmt.Errorf("invalid trace format: %s (should be %q, %q, %q or %q)", format, traceFormatRunn, traceFormatW3C, traceFormatB3, traceFormatB3Multi)
+	}
+}
+
+// traceHeaders returns the headers to propagate the trace of the step in the format.
+// With the W3C format, the span of OpenTelemetry in ctx ( when a TracerProvider is set ) wins over the derived IDs,
+// so that the backend spans join the trace exported by runn.
+func traceHeaders(ctx context.Context, s *step, format, headerName string) (map[string]string, error) {
+	trs := s.trails()
+	switch format {
+	case "", traceFormatRunn:
+		tj, err := json.Marshal(newTrace(s))
+		if err != nil {
+			return nil, err
+		}
+		if headerName == "" {
+			headerName = DefaultTraceHeaderName
+		}
+		return map[string]string{headerName: string(tj)}, nil
+	case traceFormatW3C:
+		traceID, spanID, _ := trs.traceIDs()
+		parentID, flags := spanID, "01"
+		if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+			traceID, parentID, flags = sc.TraceID().String(), sc.SpanID().String(), sc.TraceFlags().String()
+		}
+		b, err := trs.baggage()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{
+			w3cTraceparentHeaderName: fmt.Sprintf("00-%s-%s-%s", traceID, parentID, flags),
+			w3cTracestateHeaderName:  fmt.Sprintf("runn=%s", spanID),
+			w3cBaggageHeaderName:     b,
+		}, nil
+	case traceFormatB3:
+		traceID, spanID, parentSpanID := trs.traceIDs()
+		v := fmt.Sprintf("%s-%s-1", traceID, spanID)
+		if parentSpanID != "" {
+			v = fmt.Sprintf("%s-%s", v, parentSpanID)
+		}
+		return map[string]string{b3HeaderName: v}, nil
+	case traceFormatB3Multi:
+		traceID, spanID, parentSpanID := trs.traceIDs()
+		h := map[string]string{
+			b3TraceIDHeaderName: traceID,
+			b3SpanIDHeaderName:  spanID,
+			b3SampledHeaderName: "1",
+		}
+		if parentSpanID != "" {
+			h[b3ParentSpanIDHeaderName] = parentSpanID
+		}
+		return h, nil
+	default:
+		return nil, validateTraceFormat(format)
+	}
+}
+
+// traceIDs returns the trace ID, the span ID and the parent span ID derived from the trails.
+// The trace ID is derived from the ID of the root runbook, and the span IDs are derived from the trails.
+// So the same step of the same runbook always has the same IDs.
+func (trs Trails) traceIDs() (traceID, spanID, parentSpanID string) { //nostyle:recvtype
+	id := trs.rootRunbookID()
+	th := sha256.Sum256([]byte(id))
+	traceID = hex.EncodeToString(th[:16])
+	keys := trs.traceKeys()
+	sh := sha256.Sum256([]byte(id + "?" + strings.Join(keys, "&")))
+	spanID = hex.EncodeToString(sh[:8])
+	if len(keys) > 0 {
+		ph := sha256.Sum256([]byte(id + "?" + strings.Join(keys[:len(keys)-1], "&")))
+		parentSpanID = hex.EncodeToString(ph[:8])
+	}
+	return traceID, spanID, parentSpanID
+}
+
+// baggage returns the baggage that carries the runbook ID and the position of the step.
+// The members are encoded in a fixed order because baggage.Baggage does not keep the order.
+func (trs Trails) baggage() (string, error) { //nostyle:recvtype
+	var members []string
+	add := func(k, v string) error {
+		m, err := baggage.NewMemberRaw(k, v)
+		if err != nil {
+			return err
+		}
+		members = append(members, m.String())
+		return nil
+	}
+	if err := add(string(attrRunbookID), trs.runbookID()); err != nil {
+		return "", err
+	}
+	tr := trs[len(trs)-1]
+	if tr.StepIndex != nil {
+		if err := add(string(attrStepIndex), strconv.Itoa(*tr.StepIndex)); err != nil {
+			return "", err
+		}
+	}
+	if tr.StepKey != "" {
+		if err := add(string(attrStepKey), tr.StepKey); err != nil {
+			return "", err
+		}
+	}
+	if tr.LoopIndex != nil {
+		if err := add(string(attrLoopIndex), strconv.Itoa(*tr.LoopIndex)); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(members, ","), nil
+}
+
+func (trs Trails) rootRunbookID() string { //nostyle:recvtype
+	for _, tr := range trs {
+		if tr.Type == TrailTypeRunbook {
+			return tr.RunbookID
+		}
+	}
+	return ""
+}
+
+func (trs Trails) traceKeys() []string { //nostyle:recvtype
+	var keys []string
+	for _, tr := range trs {
+		switch tr.Type {
+		case TrailTypeStep:
+			keys = append(keys, fmt.Sprintf("step=%d", *tr.StepIndex))
+		case TrailTypeLoop:
+			keys = append(keys, fmt.Sprintf("loop=%d", *tr.LoopIndex))
+		}
+	}
+	return keys
+}
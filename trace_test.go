@@ -0,0 +1,154 @@
+package runn
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/k1LoW/runn/testutil"
+)
+
+func TestTraceFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		headers map[string]*regexp.Regexp
+	}{
+		{
+			"",
+			map[string]*regexp.Regexp{
+				DefaultTraceHeaderName: regexp.MustCompile(`^{"id":"[0-9a-f]+\?step=\d+"}$`),
+			},
+		},
+		{
+			traceFormatW3C,
+			map[string]*regexp.Regexp{
+				"traceparent": regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`),
+				"tracestate":  regexp.MustCompile(`^runn=[0-9a-f]{16}$`),
+				"baggage":     regexp.MustCompile(`^runn.runbook.id=[0-9a-f]+\?step=\d+,runn.step.index=\d+,runn.step.key=\w+`),
+			},
+		},
+		{
+			traceFormatB3,
+			map[string]*regexp.Regexp{
+				"b3": regexp.MustCompile(`^[0-9a-f]{32}-[0-9a-f]{16}-1-[0-9a-f]{16}$`),
+			},
+		},
+		{
+			traceFormatB3Multi,
+			map[string]*regexp.Regexp{
+				"X-B3-TraceId":      regexp.MustCompile(`^[0-9a-f]{32}$`),
+				"X-B3-SpanId":       regexp.MustCompile(`^[0-9a-f]{16}$`),
+				"X-B3-ParentSpanId": regexp.MustCompile(`^[0-9a-f]{16}$`),
+				"X-B3-Sampled":      regexp.MustCompile(`^1$`),
+			},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			run := func() []*http.Request {
+				ts, r := testutil.HTTPServerAndRouter(t)
+				o, err := Load(
+					"testdata/book/trace_format.yml",
+					HTTPRunner("req", ts.URL, ts.Client(), HTTPTrace(true), HTTPTraceFormat(tt.format)),
+					Stdout(io.Discard),
+					Stderr(io.Discard),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := o.RunN(ctx); err != nil {
+					t.Fatal(err)
+				}
+				return r.Requests()
+			}
+			reqs := run()
+			if len(reqs) != 3 {
+				t.Fatalf("got %d requests, want 3", len(reqs))
+			}
+			for _, req := range reqs {
+				for k, re := range tt.headers {
+					if got := req.Header.Get(k); !re.MatchString(got) {
+						t.Errorf("got %s: %q, want match %s", k, got, re)
+					}
+				}
+			}
+
+			// IDs are derived deterministically from the runbook ID and the trail
+			again := run()
+			seen := map[string]struct{}{}
+			for i, req := range reqs {
+				for k := range tt.headers {
+					if got, want := again[i].Header.Get(k), req.Header.Get(k); got != want {
+						t.Errorf("got %s: %q, want %q", k, got, want)
+					}
+				}
+				v := req.Header.Get("traceparent") + req.Header.Get("b3") + req.Header.Get("X-B3-SpanId")
+				if v == "" {
+					continue
+				}
+				if _, ok := seen[v]; ok {
+					t.Errorf("duplicate trace header: %s", v)
+				}
+				seen[v] = struct{}{}
+			}
+		})
+	}
+}
+
+func TestTraceIDs(t *testing.T) {
+	i0, i1, l0 := 0, 1, 0
+	rb := Trail{Type: TrailTypeRunbook, RunbookID: "abcdef"}
+	step0 := Trails{rb, {Type: TrailTypeStep, StepIndex: &i0}}
+	step1 := Trails{rb, {Type: TrailTypeStep, StepIndex: &i1}}
+	loop := Trails{rb, {Type: TrailTypeStep, StepIndex: &i1}, {Type: TrailTypeLoop, StepIndex: &i1, LoopIndex: &l0}}
+
+	tid0, sid0, pid0 := step0.traceIDs()
+	tid1, sid1, _ := step1.traceIDs()
+	tidl, _, pidl := loop.traceIDs()
+	if tid0 != tid1 || tid0 != tidl {
+		t.Errorf("trace IDs of the same runbook should be the same: %s, %s, %s", tid0, tid1, tidl)
+	}
+	if sid0 == sid1 {
+		t.Errorf("span IDs of different steps should be different: %s", sid0)
+	}
+	if pidl != sid1 {
+		t.Errorf("parent span ID of the loop should be the span ID of the step: got %s, want %s", pidl, sid1)
+	}
+	if _, rbsid, _ := (Trails{rb}).traceIDs(); pid0 != rbsid {
+		t.Errorf("parent span ID of the step should be the span ID of the runbook: got %s, want %s", pid0, rbsid)
+	}
+}
+
+func TestTraceConfigFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"true", "", false},
+		{"enable: true\nformat: w3c", traceFormatW3C, false},
+		{"enable: true\nformat: b3multi", traceFormatB3Multi, false},
+		{"enable: true\nformat: jaeger", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			c := traceConfig{}
+			if err := yaml.Unmarshal([]byte(tt.in), &c); err != nil {
+				if !tt.wantErr {
+					t.Errorf("got error: %v", err)
+				}
+				return
+			}
+			if tt.wantErr {
+				t.Error("want error")
+			}
+			if c.Format != tt.want {
+				t.Errorf("got %q, want %q", c.Format, tt.want)
+			}
+		})
+	}
+}
@@ -13,23 +13,25 @@ const (
 	TrailTypeBeforeFunc TrailType = "beforeFunc"
 	TrailTypeAfterFunc  TrailType = "afterFunc"
 	TrailTypeLoop       TrailType = "loop"
+	TrailTypePhase      TrailType = "phase"
 )
 
 type RunnerType string
 
 const (
-	RunnerTypeHTTP    RunnerType = "http"
-	RunnerTypeDB      RunnerType = "db"
-	RunnerTypeGRPC    RunnerType = "grpc"
-	RunnerTypeCDP     RunnerType = "cdp"
-	RunnerTypeSSH     RunnerType = "ssh"
-	RunnerTypeExec    RunnerType = "exec"
-	RunnerTypeTest    RunnerType = "test"
-	RunnerTypeDump    RunnerType = "dump"
-	RunnerTypeInclude RunnerType = "include"
-	RunnerTypeBind    RunnerType = "bind"
-	RunnerTypeRunner  RunnerType = "runner"
-	RunnerTypeAgent   RunnerType = "agent"
+	RunnerTypeHTTP     RunnerType = "http"
+	RunnerTypeDB       RunnerType = "db"
+	RunnerTypeGRPC     RunnerType = "grpc"
+	RunnerTypeCDP      RunnerType = "cdp"
+	RunnerTypeSSH      RunnerType = "ssh"
+	RunnerTypeExec     RunnerType = "exec"
+	RunnerTypeTest     RunnerType = "test"
+	RunnerTypeDump     RunnerType = "dump"
+	RunnerTypeInclude  RunnerType = "include"
+	RunnerTypeBind     RunnerType = "bind"
+	RunnerTypeDBAssert RunnerType = "dbAssert"
+	RunnerTypeRunner   RunnerType = "runner"
+	RunnerTypeAgent    RunnerType = "agent"
 )
 
 // Trail - The trail of elements in the runbook at runtime.
@@ -45,6 +47,7 @@ type Trail struct {
 	StepRunnerKey  string     `json:"step_runner_key,omitempty"`
 	FuncIndex      *int       `json:"func_index,omitempty"`
 	LoopIndex      *int       `json:"loop_index,omitempty"`
+	Phase          string     `json:"phase,omitempty"`
 }
 
 type Trails []Trail
@@ -61,6 +64,8 @@ func (tr Trail) String() string { //nostyle:recvtype
 		return fmt.Sprintf("afterFunc[%d]", *tr.FuncIndex)
 	case TrailTypeLoop:
 		return fmt.Sprintf("loop[%d]", *tr.LoopIndex)
+	case TrailTypePhase:
+		return tr.Phase
 	default:
 		return "invalid"
 	}